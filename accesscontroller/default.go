@@ -2,6 +2,8 @@
 package accesscontroller // import "berty.tech/go-ipfs-log/accesscontroller"
 
 import (
+	"context"
+
 	"berty.tech/go-ipfs-log/identityprovider"
 )
 
@@ -14,4 +16,10 @@ func (d *Default) CanAppend(LogEntry, identityprovider.Interface, CanAppendAddit
 	return nil
 }
 
+// CanAppendV2 allows anyone to write to the log.
+func (d *Default) CanAppendV2(context.Context, LogEntry, identityprovider.Interface, LogView) error {
+	return nil
+}
+
 var _ Interface = &Default{}
+var _ InterfaceV2 = &Default{}
@@ -0,0 +1,539 @@
+package accesscontroller // import "berty.tech/go-ipfs-log/accesscontroller"
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"math"
+	"strconv"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/ipfs/go-cid"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	"github.com/libp2p/go-libp2p/core/crypto"
+
+	"berty.tech/go-ipfs-log/errmsg"
+	"berty.tech/go-ipfs-log/identityprovider"
+)
+
+const (
+	// DelegationChainKey is the additional data key of a base64 encoded
+	// delegation chain, see EncodeDelegationChain.
+	DelegationChainKey = "delegation_chain"
+
+	// DelegationChainCIDKey is the additional data key of the CID of a
+	// delegation chain stored by SaveDelegationChain.
+	DelegationChainCIDKey = "delegation_chain_cid"
+
+	// DelegationTimeKey is the additional data key of the time an entry was
+	// written at, as a decimal Unix time in seconds. It is required by the
+	// chains which expire, and can't precede the times of the entries it
+	// follows.
+	DelegationTimeKey = "delegation_time"
+
+	// DelegationChainType is the type of the stored delegation chains.
+	DelegationChainType = "delegationchain"
+
+	// DelegationScopeAll is the scope of a delegation valid for any log.
+	DelegationScopeAll = "*"
+)
+
+const (
+	defaultDelegationCacheSize = 1000
+	defaultDelegationTimesSize = 10000
+)
+
+// Delegation allows its audience to write in the logs of its scope until it
+// expires. The audience is the hex encoded public key of an identity, which
+// may delegate in turn.
+type Delegation struct {
+	// Issuer is the public key signing the delegation, encoded as the
+	// public key of an identity.
+	Issuer   []byte `json:"issuer"`
+	Audience string `json:"audience"`
+
+	// Scope are the log IDs the delegation is valid for.
+	Scope []string `json:"scope"`
+
+	// Expiry is a Unix time in seconds, zero never expires.
+	Expiry int64 `json:"expiry,omitempty"`
+
+	Signature []byte `json:"signature,omitempty"`
+}
+
+// Delegate creates a delegation signed by the issuer key, a zero expiry
+// never expires.
+func Delegate(issuer crypto.PrivKey, audience string, scope []string, expiry time.Time) (*Delegation, error) {
+	issuerBytes, err := identityprovider.MarshalPublicKey(issuer.GetPublic())
+	if err != nil {
+		return nil, errmsg.ErrPubKeySerialization.Wrap(err)
+	}
+
+	d := &Delegation{
+		Issuer:   issuerBytes,
+		Audience: audience,
+		Scope:    scope,
+	}
+
+	if !expiry.IsZero() {
+		d.Expiry = expiry.Unix()
+	}
+
+	payload, err := d.payload()
+	if err != nil {
+		return nil, err
+	}
+
+	d.Signature, err = issuer.Sign(payload)
+	if err != nil {
+		return nil, errmsg.ErrSigSign.Wrap(err)
+	}
+
+	return d, nil
+}
+
+// Verify checks that the delegation has been signed by its issuer.
+func (d *Delegation) Verify() error {
+	issuer, err := identityprovider.UnmarshalPublicKey(d.Issuer)
+	if err != nil {
+		return errmsg.ErrDelegationInvalid.Wrap(err)
+	}
+
+	payload, err := d.payload()
+	if err != nil {
+		return err
+	}
+
+	ok, err := issuer.Verify(payload, d.Signature)
+	if err != nil {
+		return errmsg.ErrDelegationInvalid.Wrap(err)
+	}
+
+	if !ok {
+		return errmsg.ErrDelegationInvalid
+	}
+
+	return nil
+}
+
+// payload returns the signed content of the delegation.
+func (d *Delegation) payload() ([]byte, error) {
+	payload, err := json.Marshal(&Delegation{
+		Issuer:   d.Issuer,
+		Audience: d.Audience,
+		Scope:    d.Scope,
+		Expiry:   d.Expiry,
+	})
+	if err != nil {
+		return nil, errmsg.ErrDelegationInvalid.Wrap(err)
+	}
+
+	return payload, nil
+}
+
+// EncodeDelegationChain encodes a chain, rooted at an owner delegation, as
+// the DelegationChainKey additional data value.
+func EncodeDelegationChain(chain []*Delegation) (string, error) {
+	data, err := json.Marshal(chain)
+	if err != nil {
+		return "", errmsg.ErrDelegationInvalid.Wrap(err)
+	}
+
+	return base64.StdEncoding.EncodeToString(data), nil
+}
+
+// DecodeDelegationChain decodes a chain encoded by EncodeDelegationChain.
+func DecodeDelegationChain(value string) ([]*Delegation, error) {
+	data, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, errmsg.ErrDelegationInvalid.Wrap(err)
+	}
+
+	var chain []*Delegation
+	if err := json.Unmarshal(data, &chain); err != nil {
+		return nil, errmsg.ErrDelegationInvalid.Wrap(err)
+	}
+
+	return chain, nil
+}
+
+// SaveDelegationChain stores a chain and returns its CID, to be used as the
+// DelegationChainCIDKey additional data value.
+func SaveDelegationChain(ctx context.Context, storage Storage, chain []*Delegation) (cid.Cid, error) {
+	data, err := json.Marshal(chain)
+	if err != nil {
+		return cid.Undef, errmsg.ErrDelegationInvalid.Wrap(err)
+	}
+
+	node, err := cbornode.WrapObject(map[string]interface{}{
+		"type":  DelegationChainType,
+		"chain": data,
+	}, math.MaxUint64, -1)
+	if err != nil {
+		return cid.Undef, errmsg.ErrCBOROperationFailed.Wrap(err)
+	}
+
+	if err := storage.Put(ctx, node); err != nil {
+		return cid.Undef, errmsg.ErrIPFSOperationFailed.Wrap(err)
+	}
+
+	return node.Cid(), nil
+}
+
+// LoadDelegationChain reads a chain stored by SaveDelegationChain.
+func LoadDelegationChain(ctx context.Context, storage Storage, c cid.Cid) ([]*Delegation, error) {
+	node, err := storage.Get(ctx, c)
+	if err != nil {
+		return nil, errmsg.ErrIPFSOperationFailed.Wrap(err)
+	}
+
+	manifest := map[string]interface{}{}
+	if err := cbornode.DecodeInto(node.RawData(), &manifest); err != nil {
+		return nil, errmsg.ErrCBOROperationFailed.Wrap(err)
+	}
+
+	data, ok := manifest["chain"].([]byte)
+	if manifest["type"] != DelegationChainType || !ok {
+		return nil, errmsg.ErrManifestInvalid
+	}
+
+	var chain []*Delegation
+	if err := json.Unmarshal(data, &chain); err != nil {
+		return nil, errmsg.ErrDelegationInvalid.Wrap(err)
+	}
+
+	return chain, nil
+}
+
+// DelegatedLogEntry is a LogEntry exposing its log ID and additional data,
+// it is implemented by the log entries.
+type DelegatedLogEntry interface {
+	LogEntry
+	GetLogID() string
+	GetAdditionalData() map[string]string
+}
+
+// DelegatedOptions are the options of a Delegated access controller.
+type DelegatedOptions struct {
+	// Storage resolves the chains referenced by CID.
+	Storage Storage
+
+	// CacheSize is the number of proven chains kept, defaults to 1000.
+	CacheSize int
+}
+
+// Delegated is an access controller allowing the owners, and the identities
+// proving a chain of delegations rooted at an owner, to append entries.
+//
+// Each delegation of a chain is issued by the audience of the previous one
+// and can only narrow its scope and expiry. The chain is carried by the
+// additional data of the entries, see DelegationChainKey and
+// DelegationChainCIDKey.
+//
+// Expiries are checked against the time the entries commit to, see
+// DelegationTimeKey, so that all the replicas take the same decision. That
+// time is bounded below by the times of the entries they follow, an expired
+// delegate can't backdate an entry following a later one.
+type Delegated struct {
+	owners  map[string]bool
+	options DelegatedOptions
+	proven  *lru.Cache
+
+	// times are the latest times committed to by the accepted entries or
+	// the entries they follow
+	times *lru.Cache
+}
+
+// provenChain is the result of the verification of a chain.
+type provenChain struct {
+	audience string
+	scope    []string
+	expiry   int64
+}
+
+// NewDelegated creates a delegated access controller, the owners are hex
+// encoded public keys.
+func NewDelegated(owners []string, options *DelegatedOptions) *Delegated {
+	if options == nil {
+		options = &DelegatedOptions{}
+	}
+
+	d := &Delegated{
+		owners:  map[string]bool{},
+		options: *options,
+	}
+
+	for _, owner := range owners {
+		d.owners[owner] = true
+	}
+
+	if d.options.CacheSize <= 0 {
+		d.options.CacheSize = defaultDelegationCacheSize
+	}
+
+	// lru.New only fails on a non-positive size
+	d.proven, _ = lru.New(d.options.CacheSize)
+	d.times, _ = lru.New(defaultDelegationTimesSize)
+
+	return d
+}
+
+// CanAppend checks that the author of the entry is an owner or proves a
+// valid delegation chain for the log of the entry.
+func (d *Delegated) CanAppend(entry LogEntry, _ identityprovider.Interface, additionalContext CanAppendAdditionalContext) error {
+	var entries map[cid.Cid]CausalLogEntry
+
+	// the entries are only copied if a time is missing from the cache
+	return d.canAppend(context.Background(), entry, func(c cid.Cid) (CausalLogEntry, bool) {
+		if entries == nil {
+			entries = map[cid.Cid]CausalLogEntry{}
+
+			if additionalContext != nil {
+				for _, e := range additionalContext.GetLogEntries() {
+					if causal, ok := e.(CausalLogEntry); ok {
+						entries[causal.GetHash()] = causal
+					}
+				}
+			}
+		}
+
+		e, ok := entries[c]
+		return e, ok
+	})
+}
+
+// CanAppendV2 checks that the author of the entry is an owner or proves a
+// valid delegation chain for the log of the entry.
+func (d *Delegated) CanAppendV2(ctx context.Context, entry LogEntry, _ identityprovider.Interface, view LogView) error {
+	if view == nil {
+		return d.canAppend(ctx, entry, func(cid.Cid) (CausalLogEntry, bool) { return nil, false })
+	}
+
+	return d.canAppend(ctx, entry, view.GetEntry)
+}
+
+func (d *Delegated) canAppend(ctx context.Context, entry LogEntry, get func(c cid.Cid) (CausalLogEntry, bool)) error {
+	followed := d.followedTime(entry, get)
+
+	if err := d.check(ctx, entry, followed); err != nil {
+		return err
+	}
+
+	if causal, ok := entry.(CausalLogEntry); ok {
+		if written := entryTime(entry); written > followed {
+			followed = written
+		}
+
+		d.times.Add(causal.GetHash(), followed)
+	}
+
+	return nil
+}
+
+func (d *Delegated) check(ctx context.Context, entry LogEntry, followed int64) error {
+	identity := entry.GetIdentity()
+	if identity == nil {
+		return errmsg.ErrIdentityNotDefined
+	}
+
+	if err := identityprovider.VerifyIdentity(identity); err != nil {
+		return errmsg.ErrIdentityUnknown.Wrap(err)
+	}
+
+	publicKey := hex.EncodeToString(identity.PublicKey)
+	if d.owners[publicKey] {
+		return nil
+	}
+
+	delegated, ok := entry.(DelegatedLogEntry)
+	if !ok {
+		return errmsg.ErrLogAppendDenied
+	}
+
+	proven, err := d.prove(ctx, delegated.GetAdditionalData())
+	if err != nil {
+		return err
+	}
+
+	if proven.audience != publicKey {
+		return errmsg.ErrLogAppendDenied
+	}
+
+	if !inScope(proven.scope, delegated.GetLogID()) {
+		return errmsg.ErrLogAppendDenied
+	}
+
+	if proven.expiry == 0 {
+		return nil
+	}
+
+	writtenAt, err := strconv.ParseInt(delegated.GetAdditionalData()[DelegationTimeKey], 10, 64)
+	if err != nil {
+		return errmsg.ErrDelegationInvalid.Wrap(err)
+	}
+
+	if writtenAt < followed {
+		return errmsg.ErrDelegationBackdated
+	}
+
+	if writtenAt >= proven.expiry {
+		return errmsg.ErrDelegationExpired
+	}
+
+	return nil
+}
+
+// followedTime returns the latest time committed to by the entries an entry
+// follows, as far as they are known.
+func (d *Delegated) followedTime(entry LogEntry, get func(c cid.Cid) (CausalLogEntry, bool)) int64 {
+	causal, ok := entry.(CausalLogEntry)
+	if !ok {
+		return 0
+	}
+
+	var latest int64
+	for _, n := range causal.GetNext() {
+		var t int64
+		if cached, ok := d.times.Get(n); ok {
+			t = cached.(int64)
+		} else if e, ok := get(n); ok {
+			t = entryTime(e)
+		}
+
+		if t > latest {
+			latest = t
+		}
+	}
+
+	return latest
+}
+
+// entryTime returns the time an entry commits to, zero if none.
+func entryTime(entry LogEntry) int64 {
+	delegated, ok := entry.(DelegatedLogEntry)
+	if !ok {
+		return 0
+	}
+
+	t, err := strconv.ParseInt(delegated.GetAdditionalData()[DelegationTimeKey], 10, 64)
+	if err != nil {
+		return 0
+	}
+
+	return t
+}
+
+// prove returns the verified chain of the additional data of an entry.
+func (d *Delegated) prove(ctx context.Context, additionalData map[string]string) (*provenChain, error) {
+	var (
+		key   string
+		chain []*Delegation
+		err   error
+	)
+
+	switch {
+	case additionalData[DelegationChainCIDKey] != "":
+		c, err := cid.Decode(additionalData[DelegationChainCIDKey])
+		if err != nil {
+			return nil, errmsg.ErrDelegationInvalid.Wrap(err)
+		}
+
+		key = c.String()
+		if proven, ok := d.proven.Get(key); ok {
+			return proven.(*provenChain), nil
+		}
+
+		if d.options.Storage == nil {
+			return nil, errmsg.ErrIPFSNotDefined
+		}
+
+		if chain, err = LoadDelegationChain(ctx, d.options.Storage, c); err != nil {
+			return nil, err
+		}
+
+	case additionalData[DelegationChainKey] != "":
+		sum := sha256.Sum256([]byte(additionalData[DelegationChainKey]))
+		key = hex.EncodeToString(sum[:])
+		if proven, ok := d.proven.Get(key); ok {
+			return proven.(*provenChain), nil
+		}
+
+		if chain, err = DecodeDelegationChain(additionalData[DelegationChainKey]); err != nil {
+			return nil, err
+		}
+
+	default:
+		return nil, errmsg.ErrLogAppendDenied
+	}
+
+	proven, err := d.verifyChain(chain)
+	if err != nil {
+		return nil, err
+	}
+
+	d.proven.Add(key, proven)
+
+	return proven, nil
+}
+
+// verifyChain checks the signatures and the attenuation of a chain rooted at
+// an owner.
+func (d *Delegated) verifyChain(chain []*Delegation) (*provenChain, error) {
+	if len(chain) == 0 || chain[0] == nil || !d.owners[hex.EncodeToString(chain[0].Issuer)] {
+		return nil, errmsg.ErrDelegationInvalid
+	}
+
+	for i, delegation := range chain {
+		if delegation == nil {
+			return nil, errmsg.ErrDelegationInvalid
+		}
+
+		if err := delegation.Verify(); err != nil {
+			return nil, err
+		}
+
+		if i == 0 {
+			continue
+		}
+
+		parent := chain[i-1]
+
+		if parent.Audience != hex.EncodeToString(delegation.Issuer) {
+			return nil, errmsg.ErrDelegationInvalid
+		}
+
+		for _, logID := range delegation.Scope {
+			if !inScope(parent.Scope, logID) {
+				return nil, errmsg.ErrDelegationInvalid
+			}
+		}
+
+		if parent.Expiry != 0 && (delegation.Expiry == 0 || delegation.Expiry > parent.Expiry) {
+			return nil, errmsg.ErrDelegationInvalid
+		}
+	}
+
+	last := chain[len(chain)-1]
+
+	return &provenChain{
+		audience: last.Audience,
+		scope:    last.Scope,
+		expiry:   last.Expiry,
+	}, nil
+}
+
+func inScope(scope []string, logID string) bool {
+	for _, s := range scope {
+		if s == DelegationScopeAll || s == logID {
+			return true
+		}
+	}
+
+	return false
+}
+
+var _ Interface = &Delegated{}
+var _ InterfaceV2 = &Delegated{}
@@ -0,0 +1,442 @@
+package accesscontroller // import "berty.tech/go-ipfs-log/accesscontroller"
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/ipfs/go-cid"
+
+	"berty.tech/go-ipfs-log/errmsg"
+	"berty.tech/go-ipfs-log/identityprovider"
+)
+
+// Role is a permission granted to a key by an InLog access controller.
+type Role string
+
+const (
+	// RoleWrite allows to append entries.
+	RoleWrite Role = "write"
+
+	// RoleAdmin allows to append entries and to grant or revoke roles.
+	RoleAdmin Role = "admin"
+)
+
+const (
+	capabilityGrant  = "grant"
+	capabilityRevoke = "revoke"
+)
+
+// Capability is the payload of the entries granting or revoking a role, keys
+// are identity IDs or hex encoded public keys.
+type Capability struct {
+	Capability string `json:"capability"`
+	Key        string `json:"key"`
+	Role       Role   `json:"role,omitempty"`
+}
+
+// Grant returns the payload of an entry granting a role to a key.
+func Grant(key string, role Role) ([]byte, error) {
+	if role != RoleWrite && role != RoleAdmin {
+		return nil, errmsg.ErrCapabilityInvalid
+	}
+
+	return json.Marshal(&Capability{Capability: capabilityGrant, Key: key, Role: role})
+}
+
+// Revoke returns the payload of an entry revoking the role of a key.
+func Revoke(key string) ([]byte, error) {
+	return json.Marshal(&Capability{Capability: capabilityRevoke, Key: key})
+}
+
+// parseCapability returns the capability of an entry payload, if any.
+func parseCapability(payload []byte) (*Capability, bool) {
+	c := &Capability{}
+	if err := json.Unmarshal(payload, c); err != nil || c.Key == "" {
+		return nil, false
+	}
+
+	switch {
+	case c.Capability == capabilityGrant && (c.Role == RoleWrite || c.Role == RoleAdmin):
+	case c.Capability == capabilityRevoke:
+	default:
+		return nil, false
+	}
+
+	return c, true
+}
+
+// InLog is an access controller reading the grant and revoke capabilities
+// from the log itself. Capability entries can only be appended by admins.
+//
+// An entry is checked against the capabilities it causally follows, a
+// capability replaces the ones on the same key it follows. Concurrent
+// capabilities on a key resolve to a revocation if any, to the highest
+// granted role otherwise.
+//
+// The ancestors of the entries must be known by the log, an entry denied
+// while some of them are unknown is reported with ErrLogAncestorsNotKnown,
+// so that the fetcher checks it again once they are loaded. The capabilities
+// following each entry are cached, so that an entry is checked from the state
+// of the entries it references.
+type InLog struct {
+	admins []string
+	states *lru.Cache
+}
+
+const defaultInLogCacheSize = 10000
+
+// NewInLog creates an in-log access controller, the admins are the initial
+// admin keys.
+func NewInLog(admins ...string) *InLog {
+	// lru.New only fails on a non-positive size
+	states, _ := lru.New(defaultInLogCacheSize)
+
+	return &InLog{
+		admins: admins,
+		states: states,
+	}
+}
+
+// CanAppend checks the entry against the capabilities it causally follows.
+func (a *InLog) CanAppend(entry LogEntry, _ identityprovider.Interface, additionalContext CanAppendAdditionalContext) error {
+	var entries map[cid.Cid]CausalLogEntry
+
+	// the entries are only copied if a state is missing from the cache
+	return a.canAppend(context.Background(), entry, func(c cid.Cid) (CausalLogEntry, bool) {
+		if entries == nil {
+			entries = map[cid.Cid]CausalLogEntry{}
+
+			if additionalContext != nil {
+				for _, e := range additionalContext.GetLogEntries() {
+					if causal, ok := e.(CausalLogEntry); ok {
+						entries[causal.GetHash()] = causal
+					}
+				}
+			}
+		}
+
+		e, ok := entries[c]
+		return e, ok
+	})
+}
+
+// CanAppendV2 checks the entry against the capabilities it causally follows,
+// looking up its ancestors in the view.
+func (a *InLog) CanAppendV2(ctx context.Context, entry LogEntry, _ identityprovider.Interface, view LogView) error {
+	if view == nil {
+		return a.canAppend(ctx, entry, func(cid.Cid) (CausalLogEntry, bool) { return nil, false })
+	}
+
+	return a.canAppend(ctx, entry, view.GetEntry)
+}
+
+func (a *InLog) canAppend(ctx context.Context, entry LogEntry, get func(c cid.Cid) (CausalLogEntry, bool)) error {
+	identity := entry.GetIdentity()
+	if identity == nil {
+		return errmsg.ErrIdentityNotDefined
+	}
+
+	if err := identityprovider.VerifyIdentity(identity); err != nil {
+		return errmsg.ErrIdentityUnknown.Wrap(err)
+	}
+
+	var next []cid.Cid
+	if causal, ok := entry.(CausalLogEntry); ok {
+		next = causal.GetNext()
+	}
+
+	s, complete, err := a.followingState(ctx, next, get)
+	if err != nil {
+		return err
+	}
+
+	role := a.role(s, identity)
+
+	allowed := role == RoleWrite || role == RoleAdmin
+	if _, ok := parseCapability(entry.GetPayload()); ok {
+		allowed = role == RoleAdmin
+	}
+
+	switch {
+	case allowed:
+		return nil
+	case !complete:
+		// the unknown ancestors may grant the role
+		return fmt.Errorf("%w: %w", errmsg.ErrLogAppendDenied, errmsg.ErrLogAncestorsNotKnown)
+	default:
+		return errmsg.ErrLogAppendDenied
+	}
+}
+
+// capabilityState holds the valid capabilities causally preceding an entry,
+// including the entry itself. States are shared between entries and must not
+// be modified.
+type capabilityState struct {
+	capabilities map[cid.Cid]*Capability
+
+	// latest are, for each key, the capabilities which are not followed by
+	// another one on the key
+	latest map[string][]cid.Cid
+}
+
+var emptyCapabilityState = &capabilityState{}
+
+// resolvedState is the state of an entry, complete if all its ancestors
+// were known. Only complete states are cached.
+type resolvedState struct {
+	state    *capabilityState
+	complete bool
+}
+
+// followingState returns the merged state of the given entries.
+func (a *InLog) followingState(ctx context.Context, next []cid.Cid, get func(c cid.Cid) (CausalLogEntry, bool)) (*capabilityState, bool, error) {
+	resolved := map[cid.Cid]*resolvedState{}
+
+	for _, n := range next {
+		if err := a.resolve(ctx, n, get, resolved); err != nil {
+			return nil, false, err
+		}
+	}
+
+	return mergeStates(next, resolved)
+}
+
+// resolve computes the state of an entry and of its ancestors missing from
+// the cache, ancestors first.
+func (a *InLog) resolve(ctx context.Context, root cid.Cid, get func(c cid.Cid) (CausalLogEntry, bool), resolved map[cid.Cid]*resolvedState) error {
+	type frame struct {
+		entry    CausalLogEntry
+		hash     cid.Cid
+		expanded bool
+	}
+
+	known := func(c cid.Cid) bool {
+		if _, ok := resolved[c]; ok {
+			return true
+		}
+
+		if s, ok := a.states.Get(c); ok {
+			resolved[c] = &resolvedState{state: s.(*capabilityState), complete: true}
+			return true
+		}
+
+		return false
+	}
+
+	stack := []*frame{{hash: root}}
+
+	for len(stack) > 0 {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		f := stack[len(stack)-1]
+
+		if !f.expanded {
+			if known(f.hash) {
+				stack = stack[:len(stack)-1]
+				continue
+			}
+
+			e, ok := get(f.hash)
+			if !ok {
+				resolved[f.hash] = &resolvedState{state: emptyCapabilityState}
+				stack = stack[:len(stack)-1]
+				continue
+			}
+
+			f.entry, f.expanded = e, true
+			for _, n := range e.GetNext() {
+				if !known(n) {
+					stack = append(stack, &frame{hash: n})
+				}
+			}
+
+			continue
+		}
+
+		stack = stack[:len(stack)-1]
+
+		if _, ok := resolved[f.hash]; ok {
+			continue
+		}
+
+		s, complete, err := mergeStates(f.entry.GetNext(), resolved)
+		if err != nil {
+			return err
+		}
+
+		s = a.apply(s, f.entry)
+
+		resolved[f.hash] = &resolvedState{state: s, complete: complete}
+		if complete {
+			a.states.Add(f.hash, s)
+		}
+	}
+
+	return nil
+}
+
+// apply returns the state following a resolved state and an entry.
+func (a *InLog) apply(s *capabilityState, e CausalLogEntry) *capabilityState {
+	c, ok := parseCapability(e.GetPayload())
+	if !ok {
+		return s
+	}
+
+	identity := e.GetIdentity()
+	if identity == nil || identityprovider.VerifyIdentity(identity) != nil || a.role(s, identity) != RoleAdmin {
+		return s
+	}
+
+	following := &capabilityState{
+		capabilities: make(map[cid.Cid]*Capability, len(s.capabilities)+1),
+		latest:       make(map[string][]cid.Cid, len(s.latest)+1),
+	}
+
+	for h, capability := range s.capabilities {
+		following.capabilities[h] = capability
+	}
+
+	for key, latest := range s.latest {
+		following.latest[key] = latest
+	}
+
+	following.capabilities[e.GetHash()] = c
+	following.latest[c.Key] = []cid.Cid{e.GetHash()}
+
+	return following
+}
+
+// mergeStates returns the state following several resolved entries.
+func mergeStates(hashes []cid.Cid, resolved map[cid.Cid]*resolvedState) (*capabilityState, bool, error) {
+	complete := true
+
+	var states []*capabilityState
+	for _, h := range hashes {
+		r, ok := resolved[h]
+		if !ok {
+			return nil, false, errmsg.ErrLogTraverseFailed
+		}
+
+		complete = complete && r.complete
+
+		shared := false
+		for _, s := range states {
+			shared = shared || s == r.state
+		}
+
+		if !shared {
+			states = append(states, r.state)
+		}
+	}
+
+	switch len(states) {
+	case 0:
+		return emptyCapabilityState, complete, nil
+	case 1:
+		return states[0], complete, nil
+	}
+
+	merged := &capabilityState{
+		capabilities: map[cid.Cid]*Capability{},
+		latest:       map[string][]cid.Cid{},
+	}
+
+	for _, s := range states {
+		for h, c := range s.capabilities {
+			merged.capabilities[h] = c
+		}
+	}
+
+	// a capability remains the latest on its key unless a state knows it
+	// without it being one of its latest
+	for _, s := range states {
+		for key, latest := range s.latest {
+			for _, h := range latest {
+				if containsCID(merged.latest[key], h) || superseded(states, key, h) {
+					continue
+				}
+
+				merged.latest[key] = append(merged.latest[key], h)
+			}
+		}
+	}
+
+	return merged, complete, nil
+}
+
+func superseded(states []*capabilityState, key string, h cid.Cid) bool {
+	for _, s := range states {
+		if _, ok := s.capabilities[h]; ok && !containsCID(s.latest[key], h) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func containsCID(hashes []cid.Cid, h cid.Cid) bool {
+	for _, c := range hashes {
+		if c.Equals(h) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// role returns the role of an identity in a state.
+func (a *InLog) role(s *capabilityState, identity *identityprovider.Identity) Role {
+	var role Role
+	for _, key := range []string{identity.ID, hex.EncodeToString(identity.PublicKey)} {
+		role = maxRole(role, a.keyRole(s, key))
+	}
+
+	return role
+}
+
+// keyRole resolves the role of a key from its latest capabilities.
+func (a *InLog) keyRole(s *capabilityState, key string) Role {
+	latest := s.latest[key]
+
+	if len(latest) == 0 {
+		for _, admin := range a.admins {
+			if admin == key {
+				return RoleAdmin
+			}
+		}
+
+		return ""
+	}
+
+	var role Role
+	for _, h := range latest {
+		c := s.capabilities[h]
+		if c.Capability == capabilityRevoke {
+			return ""
+		}
+
+		role = maxRole(role, c.Role)
+	}
+
+	return role
+}
+
+func maxRole(a, b Role) Role {
+	if a == RoleAdmin || b == RoleAdmin {
+		return RoleAdmin
+	}
+
+	if a == RoleWrite || b == RoleWrite {
+		return RoleWrite
+	}
+
+	return ""
+}
+
+var _ Interface = &InLog{}
+var _ InterfaceV2 = &InLog{}
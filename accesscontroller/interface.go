@@ -1,6 +1,10 @@
 package accesscontroller // import "berty.tech/go-ipfs-log/accesscontroller"
 
 import (
+	"context"
+
+	"github.com/ipfs/go-cid"
+
 	"berty.tech/go-ipfs-log/identityprovider"
 )
 
@@ -9,6 +13,14 @@ type LogEntry interface {
 	GetIdentity() *identityprovider.Identity
 }
 
+// CausalLogEntry is a LogEntry exposing its hash and the entries it
+// references, it is implemented by the log entries.
+type CausalLogEntry interface {
+	LogEntry
+	GetHash() cid.Cid
+	GetNext() []cid.Cid
+}
+
 type CanAppendAdditionalContext interface {
 	GetLogEntries() []LogEntry
 }
@@ -16,3 +28,27 @@ type CanAppendAdditionalContext interface {
 type Interface interface {
 	CanAppend(LogEntry, identityprovider.Interface, CanAppendAdditionalContext) error
 }
+
+// LogView is a read-only view of the log given to InterfaceV2 controllers.
+type LogView interface {
+	// GetLogEntries copies all the entries of the log, prefer the lookups.
+	CanAppendAdditionalContext
+
+	// GetLogID returns the ID of the log.
+	GetLogID() string
+
+	// GetEntry returns a known entry from its CID.
+	GetEntry(c cid.Cid) (CausalLogEntry, bool)
+
+	// GetAncestors returns the known entries causally preceding an entry.
+	GetAncestors(ctx context.Context, entry CausalLogEntry) ([]CausalLogEntry, error)
+
+	// GetHeads returns the current heads of the log.
+	GetHeads() []CausalLogEntry
+}
+
+// InterfaceV2 is an access controller aware of the context of the check, see
+// FromV1 to use an Interface controller.
+type InterfaceV2 interface {
+	CanAppendV2(ctx context.Context, entry LogEntry, identityProvider identityprovider.Interface, view LogView) error
+}
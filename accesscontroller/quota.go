@@ -0,0 +1,464 @@
+package accesscontroller // import "berty.tech/go-ipfs-log/accesscontroller"
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/ipfs/go-cid"
+
+	"berty.tech/go-ipfs-log/errmsg"
+	"berty.tech/go-ipfs-log/identityprovider"
+)
+
+// TimedLogEntry is a LogEntry exposing the time of its Lamport clock, it is
+// implemented by the log entries.
+type TimedLogEntry interface {
+	LogEntry
+	GetClockTime() int
+}
+
+// QuotaLimit is a limit enforced by a Quota access controller.
+type QuotaLimit int
+
+const (
+	// QuotaLimitRate limits the number of entries of an author within a
+	// window of Lamport time.
+	QuotaLimitRate QuotaLimit = iota
+
+	// QuotaLimitTotalBytes limits the payload bytes of an author.
+	QuotaLimitTotalBytes
+
+	// QuotaLimitEntrySize limits the payload size of an entry.
+	QuotaLimitEntrySize
+)
+
+func (l QuotaLimit) String() string {
+	switch l {
+	case QuotaLimitRate:
+		return "rate"
+	case QuotaLimitTotalBytes:
+		return "total bytes"
+	case QuotaLimitEntrySize:
+		return "entry size"
+	default:
+		return "unknown"
+	}
+}
+
+// QuotaError is returned by a Quota access controller for an entry exceeding
+// a limit, it matches errmsg.ErrQuotaExceeded.
+type QuotaError struct {
+	Limit  QuotaLimit
+	Author string
+	Max    int
+	Value  int
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("%s: %s of %s is %d, the maximum is %d", errmsg.ErrQuotaExceeded, e.Limit, e.Author, e.Value, e.Max)
+}
+
+func (e *QuotaError) Unwrap() error {
+	return errmsg.ErrQuotaExceeded
+}
+
+// QuotaOptions are the limits of a Quota access controller, zero values are
+// unlimited.
+type QuotaOptions struct {
+	// MaxEntries is the maximum number of entries of an author whose clock
+	// time is within Window of the checked entry, or of all its entries
+	// when Window is zero.
+	MaxEntries int
+	Window     int
+
+	// MaxTotalBytes is the maximum sum of the payload sizes of the entries
+	// of an author, up to the checked entry.
+	MaxTotalBytes int
+
+	// MaxEntrySize is the maximum payload size of an entry.
+	MaxEntrySize int
+}
+
+// Quota is an access controller enforcing limits per author before calling
+// the access controller it wraps.
+//
+// The entries of an author are counted from the view of the log: the entries
+// reachable from its heads, which are committed, and the known ancestors of
+// the checked entry, such as the entries being joined. They are counted up to
+// the clock time of the checked entry, joined and fetched entries are checked
+// in causal order.
+//
+// The counts of the committed entries are cached per heads and updated when
+// the heads of a log move forward. The ancestors are counted once per view,
+// views are compared to tell the checks of a join apart.
+type Quota struct {
+	next    Interface
+	options QuotaOptions
+
+	lock sync.Mutex
+
+	// states are the counts of the entries reachable from some heads, and
+	// latest the heads of the latest counts of each log
+	states *lru.Cache
+	latest *lru.Cache
+
+	// pending are the counts of the uncommitted ancestors of the entries
+	// checked with the latest view
+	pending *quotaPending
+}
+
+const defaultQuotaCacheSize = 64
+
+// quotaLog holds counted entries.
+type quotaLog struct {
+	heads   []cid.Cid
+	seen    map[cid.Cid]struct{}
+	authors map[string]*quotaAuthor
+}
+
+// quotaPending holds the entries counted for a view on top of its committed
+// entries.
+type quotaPending struct {
+	view      LogView
+	committed string
+	counts    *quotaLog
+}
+
+// quotaAuthor holds the clock times of the entries of an author in order,
+// along with the cumulated sizes of their payloads.
+type quotaAuthor struct {
+	times []int
+	sums  []int
+}
+
+// add counts an entry.
+func (a *quotaAuthor) add(t, size int) {
+	i := sort.SearchInts(a.times, t+1)
+
+	a.times = append(a.times, 0)
+	copy(a.times[i+1:], a.times[i:])
+	a.times[i] = t
+
+	a.sums = append(a.sums, 0)
+	for j := len(a.sums) - 1; j > i; j-- {
+		a.sums[j] = a.sums[j-1] + size
+	}
+
+	a.sums[i] = size
+	if i > 0 {
+		a.sums[i] += a.sums[i-1]
+	}
+}
+
+// upTo returns the number of entries until a clock time, and their size.
+func (a *quotaAuthor) upTo(t int) (int, int) {
+	i := sort.SearchInts(a.times, t+1)
+	if i == 0 {
+		return 0, 0
+	}
+
+	return i, a.sums[i-1]
+}
+
+// NewQuota wraps an access controller with limits, next defaults to
+// Default.
+func NewQuota(next Interface, options *QuotaOptions) *Quota {
+	if next == nil {
+		next = &Default{}
+	}
+
+	if options == nil {
+		options = &QuotaOptions{}
+	}
+
+	// lru.New only fails on a non-positive size
+	states, _ := lru.New(defaultQuotaCacheSize)
+	latest, _ := lru.New(defaultQuotaCacheSize)
+
+	return &Quota{
+		next:    next,
+		options: *options,
+		states:  states,
+		latest:  latest,
+	}
+}
+
+// CanAppend checks the limits and calls the wrapped access controller. The
+// entries are counted from the copy of the log entries when the context is
+// not a LogView.
+func (q *Quota) CanAppend(entry LogEntry, identityProvider identityprovider.Interface, additionalContext CanAppendAdditionalContext) error {
+	if err := q.check(context.Background(), entry, additionalContext); err != nil {
+		return err
+	}
+
+	return q.next.CanAppend(entry, identityProvider, additionalContext)
+}
+
+// CanAppendV2 checks the limits and calls the wrapped access controller.
+func (q *Quota) CanAppendV2(ctx context.Context, entry LogEntry, identityProvider identityprovider.Interface, view LogView) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	var additionalContext CanAppendAdditionalContext
+	if view != nil {
+		additionalContext = view
+	}
+
+	if err := q.check(ctx, entry, additionalContext); err != nil {
+		return err
+	}
+
+	return FromV1(q.next).CanAppendV2(ctx, entry, identityProvider, view)
+}
+
+func (q *Quota) check(ctx context.Context, entry LogEntry, additionalContext CanAppendAdditionalContext) error {
+	identity := entry.GetIdentity()
+	if identity == nil {
+		return errmsg.ErrIdentityNotDefined
+	}
+
+	if err := identityprovider.VerifyIdentity(identity); err != nil {
+		return errmsg.ErrIdentityUnknown.Wrap(err)
+	}
+
+	size := len(entry.GetPayload())
+	if q.options.MaxEntrySize > 0 && size > q.options.MaxEntrySize {
+		return &QuotaError{Limit: QuotaLimitEntrySize, Author: identity.ID, Max: q.options.MaxEntrySize, Value: size}
+	}
+
+	checkRate := q.options.MaxEntries > 0
+	checkBytes := q.options.MaxTotalBytes > 0
+
+	if !checkRate && !checkBytes {
+		return nil
+	}
+
+	counted, err := q.counted(ctx, entry, additionalContext)
+	if err != nil {
+		return err
+	}
+
+	entryTime := clockTime(entry)
+
+	// the checked entry may already be counted
+	count, total := 1, size
+	for _, l := range counted {
+		if l.has(entryHash(entry)) {
+			count, total = count-1, total-size
+		}
+
+		c, t := l.upTo(identity.ID, entryTime, q.options.Window)
+		count, total = count+c, total+t
+	}
+
+	if checkRate && count > q.options.MaxEntries {
+		return &QuotaError{Limit: QuotaLimitRate, Author: identity.ID, Max: q.options.MaxEntries, Value: count}
+	}
+
+	if checkBytes && total > q.options.MaxTotalBytes {
+		return &QuotaError{Limit: QuotaLimitTotalBytes, Author: identity.ID, Max: q.options.MaxTotalBytes, Value: total}
+	}
+
+	return nil
+}
+
+// counted returns the entries counted for a check, they don't overlap.
+func (q *Quota) counted(ctx context.Context, entry LogEntry, additionalContext CanAppendAdditionalContext) ([]*quotaLog, error) {
+	view, ok := additionalContext.(LogView)
+	if !ok {
+		l := newQuotaLog()
+		if additionalContext != nil {
+			for _, e := range additionalContext.GetLogEntries() {
+				l.add(e)
+			}
+		}
+
+		return []*quotaLog{l}, nil
+	}
+
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	key, committed, err := q.committed(ctx, view)
+	if err != nil {
+		return nil, err
+	}
+
+	if q.pending == nil || q.pending.view != view || q.pending.committed != key {
+		q.pending = &quotaPending{view: view, committed: key, counts: newQuotaLog()}
+	}
+
+	var next []cid.Cid
+	if causal, ok := entry.(CausalLogEntry); ok {
+		next = causal.GetNext()
+	}
+
+	pending := q.pending.counts
+	if err := pending.addReachable(ctx, view, next, committed.has); err != nil {
+		return nil, err
+	}
+
+	return []*quotaLog{committed, pending}, nil
+}
+
+// committed returns the counts of the entries reachable from the heads of a
+// view, the latest counts of the log are updated when its heads moved forward.
+func (q *Quota) committed(ctx context.Context, view LogView) (string, *quotaLog, error) {
+	// q.lock must be Locked
+
+	var heads []cid.Cid
+	for _, h := range view.GetHeads() {
+		heads = append(heads, h.GetHash())
+	}
+
+	key := quotaStateKey(view.GetLogID(), heads)
+	if l, ok := q.states.Get(key); ok {
+		return key, l.(*quotaLog), nil
+	}
+
+	l := newQuotaLog()
+	if previous, ok := q.latest.Get(view.GetLogID()); ok {
+		if s, ok := q.states.Get(previous); ok && s.(*quotaLog).within(view) {
+			l = s.(*quotaLog)
+			q.states.Remove(previous)
+		}
+	}
+
+	if err := l.addReachable(ctx, view, heads, nil); err != nil {
+		// the counts may be incomplete
+		q.latest.Remove(view.GetLogID())
+		return "", nil, err
+	}
+
+	l.heads = heads
+	q.states.Add(key, l)
+	q.latest.Add(view.GetLogID(), key)
+
+	return key, l, nil
+}
+
+func quotaStateKey(logID string, heads []cid.Cid) string {
+	keys := make([]string, len(heads))
+	for i, h := range heads {
+		keys[i] = h.String()
+	}
+
+	sort.Strings(keys)
+
+	return logID + "/" + strings.Join(keys, ",")
+}
+
+func newQuotaLog() *quotaLog {
+	return &quotaLog{
+		seen:    map[cid.Cid]struct{}{},
+		authors: map[string]*quotaAuthor{},
+	}
+}
+
+// within returns true if the counted heads are entries of a view, so are the
+// counted entries.
+func (l *quotaLog) within(view LogView) bool {
+	for _, h := range l.heads {
+		if _, ok := view.GetEntry(h); !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (l *quotaLog) has(h cid.Cid) bool {
+	_, ok := l.seen[h]
+	return ok
+}
+
+// upTo returns the number of entries of an author until a clock time, within
+// a window if not zero, and the size of all of them.
+func (l *quotaLog) upTo(author string, t, window int) (int, int) {
+	a, ok := l.authors[author]
+	if !ok {
+		return 0, 0
+	}
+
+	count, total := a.upTo(t)
+	if window > 0 {
+		before, _ := a.upTo(t - window)
+		count -= before
+	}
+
+	return count, total
+}
+
+// addReachable counts the entries of a view reachable from some hashes,
+// skipping the counted ones.
+func (l *quotaLog) addReachable(ctx context.Context, view LogView, hashes []cid.Cid, skip func(c cid.Cid) bool) error {
+	stack := append([]cid.Cid(nil), hashes...)
+
+	for len(stack) > 0 {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		h := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		if l.has(h) || (skip != nil && skip(h)) {
+			continue
+		}
+
+		e, ok := view.GetEntry(h)
+		if !ok {
+			continue
+		}
+
+		l.add(e)
+		stack = append(stack, e.GetNext()...)
+	}
+
+	return nil
+}
+
+func (l *quotaLog) add(e LogEntry) {
+	h := entryHash(e)
+	if l.has(h) || e.GetIdentity() == nil {
+		return
+	}
+
+	if h.Defined() {
+		l.seen[h] = struct{}{}
+	}
+
+	a, ok := l.authors[e.GetIdentity().ID]
+	if !ok {
+		a = &quotaAuthor{}
+		l.authors[e.GetIdentity().ID] = a
+	}
+
+	a.add(clockTime(e), len(e.GetPayload()))
+}
+
+// entryHash returns the hash of an entry, if it is exposed.
+func entryHash(entry LogEntry) cid.Cid {
+	if causal, ok := entry.(CausalLogEntry); ok {
+		return causal.GetHash()
+	}
+
+	return cid.Undef
+}
+
+// clockTime returns the clock time of an entry, or zero if it isn't exposed.
+func clockTime(entry LogEntry) int {
+	if timed, ok := entry.(TimedLogEntry); ok {
+		return timed.GetClockTime()
+	}
+
+	return 0
+}
+
+var _ Interface = &Quota{}
+var _ InterfaceV2 = &Quota{}
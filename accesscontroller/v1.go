@@ -0,0 +1,73 @@
+package accesscontroller // import "berty.tech/go-ipfs-log/accesscontroller"
+
+import (
+	"context"
+
+	"github.com/ipfs/go-cid"
+
+	"berty.tech/go-ipfs-log/identityprovider"
+)
+
+// v1Adapter calls an Interface controller as an InterfaceV2 one.
+type v1Adapter struct {
+	controller Interface
+}
+
+// FromV1 returns an InterfaceV2 calling an Interface controller, controllers
+// implementing both are returned as is.
+func FromV1(controller Interface) InterfaceV2 {
+	if controller == nil {
+		return nil
+	}
+
+	if v2, ok := controller.(InterfaceV2); ok {
+		return v2
+	}
+
+	return &v1Adapter{controller: controller}
+}
+
+// CanAppendV2 calls the Interface controller unless ctx is done.
+func (a *v1Adapter) CanAppendV2(ctx context.Context, entry LogEntry, identityProvider identityprovider.Interface, view LogView) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return a.controller.CanAppend(entry, identityProvider, view)
+}
+
+// CollectAncestors returns the entries reachable from the next entries of an
+// entry using a lookup function, unknown entries are skipped. It can be used
+// to implement LogView.GetAncestors.
+func CollectAncestors(ctx context.Context, get func(c cid.Cid) (CausalLogEntry, bool), entry CausalLogEntry) ([]CausalLogEntry, error) {
+	var ancestors []CausalLogEntry
+
+	seen := map[cid.Cid]struct{}{}
+	stack := append([]cid.Cid(nil), entry.GetNext()...)
+
+	for len(stack) > 0 {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		h := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		if _, ok := seen[h]; ok {
+			continue
+		}
+		seen[h] = struct{}{}
+
+		e, ok := get(h)
+		if !ok {
+			continue
+		}
+
+		ancestors = append(ancestors, e)
+		stack = append(stack, e.GetNext()...)
+	}
+
+	return ancestors, nil
+}
+
+var _ InterfaceV2 = &v1Adapter{}
@@ -0,0 +1,117 @@
+package accesscontroller // import "berty.tech/go-ipfs-log/accesscontroller"
+
+import (
+	"context"
+	"encoding/hex"
+	"math"
+
+	"github.com/ipfs/go-cid"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	format "github.com/ipfs/go-ipld-format"
+
+	"berty.tech/go-ipfs-log/errmsg"
+	"berty.tech/go-ipfs-log/identityprovider"
+)
+
+// WriteListType is the type of the write-list manifests.
+const WriteListType = "writelist"
+
+// WriteListWildcard allows anyone to write when present in a write list.
+const WriteListWildcard = "*"
+
+// Storage stores access controller manifests, it is satisfied by
+// iface.Storage.
+type Storage interface {
+	Put(ctx context.Context, node format.Node) error
+	Get(ctx context.Context, c cid.Cid) (format.Node, error)
+}
+
+// WriteList allows the identities whose ID or hex encoded public key is
+// listed to append entries.
+type WriteList struct {
+	Write []string `json:"write"`
+}
+
+// NewWriteList creates a write-list access controller.
+func NewWriteList(write ...string) *WriteList {
+	return &WriteList{
+		Write: write,
+	}
+}
+
+// CanAppend checks that the verified identity of the entry is listed.
+func (w *WriteList) CanAppend(entry LogEntry, _ identityprovider.Interface, _ CanAppendAdditionalContext) error {
+	identity := entry.GetIdentity()
+	if identity == nil {
+		return errmsg.ErrIdentityNotDefined
+	}
+
+	if err := identityprovider.VerifyIdentity(identity); err != nil {
+		return errmsg.ErrIdentityUnknown.Wrap(err)
+	}
+
+	publicKey := hex.EncodeToString(identity.PublicKey)
+
+	for _, allowed := range w.Write {
+		if allowed == WriteListWildcard || allowed == identity.ID || allowed == publicKey {
+			return nil
+		}
+	}
+
+	return errmsg.ErrLogAppendDenied
+}
+
+// Save stores the write list manifest and returns its CID.
+func (w *WriteList) Save(ctx context.Context, storage Storage) (cid.Cid, error) {
+	write := w.Write
+	if write == nil {
+		write = []string{}
+	}
+
+	node, err := cbornode.WrapObject(map[string]interface{}{
+		"type":  WriteListType,
+		"write": write,
+	}, math.MaxUint64, -1)
+	if err != nil {
+		return cid.Undef, errmsg.ErrCBOROperationFailed.Wrap(err)
+	}
+
+	if err := storage.Put(ctx, node); err != nil {
+		return cid.Undef, errmsg.ErrIPFSOperationFailed.Wrap(err)
+	}
+
+	return node.Cid(), nil
+}
+
+// LoadWriteList reads a write list manifest stored by Save.
+func LoadWriteList(ctx context.Context, storage Storage, c cid.Cid) (*WriteList, error) {
+	node, err := storage.Get(ctx, c)
+	if err != nil {
+		return nil, errmsg.ErrIPFSOperationFailed.Wrap(err)
+	}
+
+	manifest := map[string]interface{}{}
+	if err := cbornode.DecodeInto(node.RawData(), &manifest); err != nil {
+		return nil, errmsg.ErrCBOROperationFailed.Wrap(err)
+	}
+
+	if manifest["type"] != WriteListType {
+		return nil, errmsg.ErrManifestInvalid
+	}
+
+	write, ok := manifest["write"].([]interface{})
+	if !ok {
+		return nil, errmsg.ErrManifestInvalid
+	}
+
+	w := &WriteList{Write: make([]string, len(write))}
+	for i, allowed := range write {
+		if w.Write[i], ok = allowed.(string); !ok {
+			return nil, errmsg.ErrManifestInvalid
+		}
+	}
+
+	return w, nil
+}
+
+var _ Interface = &WriteList{}
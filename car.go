@@ -0,0 +1,192 @@
+package ipfslog // import "berty.tech/go-ipfs-log"
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/ipfs/boxo/ipld/merkledag"
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	format "github.com/ipfs/go-ipld-format"
+	carv2 "github.com/ipld/go-car/v2"
+	carstorage "github.com/ipld/go-car/v2/storage"
+
+	"berty.tech/go-ipfs-log/entry"
+	"berty.tech/go-ipfs-log/errmsg"
+	"berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/iface"
+	"berty.tech/go-ipfs-log/io/cbor"
+)
+
+// ExportCAR writes the log to w as a CAR file, its root being the JSONLog
+// of the log, followed by every entry block.
+//
+// A CARv2 file is written when w implements io.WriterAt, a CARv1 otherwise.
+func ExportCAR(ctx context.Context, log *IPFSLog, w io.Writer) error {
+	if log == nil {
+		return errmsg.ErrLogNotDefined
+	}
+
+	root, err := log.ToMultihash(ctx)
+	if err != nil {
+		return errmsg.ErrCARExportFailed.Wrap(err)
+	}
+
+	var opts []carv2.Option
+	if _, ok := w.(io.WriterAt); !ok {
+		opts = append(opts, carv2.WriteAsCarV1(true))
+	}
+
+	car, err := carstorage.NewWritable(w, []cid.Cid{root}, opts...)
+	if err != nil {
+		return errmsg.ErrCARExportFailed.Wrap(err)
+	}
+
+	hashes := append([]cid.Cid{root}, entrySliceToCids(log.Values().Slice())...)
+	for _, c := range hashes {
+		node, err := log.Storage.Get(ctx, c)
+		if err != nil {
+			return errmsg.ErrCARExportFailed.Wrap(err)
+		}
+
+		if err := car.Put(ctx, c.KeyString(), node.RawData()); err != nil {
+			return errmsg.ErrCARExportFailed.Wrap(err)
+		}
+	}
+
+	if err := car.Finalize(); err != nil {
+		return errmsg.ErrCARExportFailed.Wrap(err)
+	}
+
+	return nil
+}
+
+// ImportCAR loads the blocks of a CAR file written by ExportCAR into the
+// storage and creates the log from its root.
+//
+// Every entry reachable from the heads, including the ones referenced by
+// Next and Refs, must be present in the CAR.
+func ImportCAR(ctx context.Context, services iface.Storage, identity *identityprovider.Identity, r io.Reader, logOptions *LogOptions, fetchOptions *FetchOptions) (*IPFSLog, error) {
+	if services == nil {
+		return nil, errmsg.ErrIPFSNotDefined
+	}
+
+	if identity == nil {
+		return nil, errmsg.ErrIdentityNotDefined
+	}
+
+	if logOptions == nil {
+		return nil, errmsg.ErrLogOptionsNotDefined
+	}
+
+	if fetchOptions == nil {
+		fetchOptions = &FetchOptions{}
+	}
+
+	if logOptions.IO == nil {
+		io, err := cbor.IO(&entry.Entry{}, &entry.LamportClock{})
+		if err != nil {
+			return nil, errmsg.ErrLogOptionsNotDefined
+		}
+
+		logOptions.IO = io
+	}
+
+	reader, err := carv2.NewBlockReader(r)
+	if err != nil {
+		return nil, errmsg.ErrCARImportFailed.Wrap(err)
+	}
+
+	if len(reader.Roots) != 1 {
+		return nil, errmsg.ErrCARImportFailed.Wrap(fmt.Errorf("expected a single root, got %d", len(reader.Roots)))
+	}
+
+	root := reader.Roots[0]
+	present := map[cid.Cid]struct{}{}
+
+	for {
+		block, err := reader.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, errmsg.ErrCARImportFailed.Wrap(err)
+		}
+
+		node, err := decodeCARBlock(block)
+		if err != nil {
+			return nil, errmsg.ErrCARImportFailed.Wrap(err)
+		}
+
+		if err := services.Put(ctx, node); err != nil {
+			return nil, errmsg.ErrCARImportFailed.Wrap(err)
+		}
+
+		present[block.Cid()] = struct{}{}
+	}
+
+	if err := verifyCARLinks(ctx, services, identity, root, present, logOptions.IO); err != nil {
+		return nil, err
+	}
+
+	return NewFromMultihash(ctx, services, identity, root, logOptions, fetchOptions)
+}
+
+// verifyCARLinks walks the log from its root and checks that every linked
+// block has been imported, so that creating the log does not hit the network.
+func verifyCARLinks(ctx context.Context, services iface.Storage, identity *identityprovider.Identity, root cid.Cid, present map[cid.Cid]struct{}, ioInterface iface.IO) error {
+	if _, ok := present[root]; !ok {
+		return errmsg.ErrCARMissingBlock.Wrap(fmt.Errorf("root %s", root))
+	}
+
+	result, err := ioInterface.Read(ctx, services, root)
+	if err != nil {
+		return errmsg.ErrCARImportFailed.Wrap(err)
+	}
+
+	jsonLog, err := ioInterface.DecodeRawJSONLog(result)
+	if err != nil {
+		return errmsg.ErrCARImportFailed.Wrap(err)
+	}
+
+	seen := map[cid.Cid]struct{}{}
+	queue := append([]cid.Cid{}, jsonLog.Heads...)
+
+	for len(queue) > 0 {
+		c := queue[0]
+		queue = queue[1:]
+
+		if _, ok := seen[c]; ok {
+			continue
+		}
+		seen[c] = struct{}{}
+
+		if _, ok := present[c]; !ok {
+			return errmsg.ErrCARMissingBlock.Wrap(fmt.Errorf("entry %s", c))
+		}
+
+		e, err := entry.FromMultihashWithIO(ctx, services, c, identity.Provider, ioInterface)
+		if err != nil {
+			return errmsg.ErrCARImportFailed.Wrap(err)
+		}
+
+		queue = append(queue, e.GetNext()...)
+		queue = append(queue, e.GetRefs()...)
+	}
+
+	return nil
+}
+
+func decodeCARBlock(block blocks.Block) (format.Node, error) {
+	switch block.Cid().Prefix().Codec {
+	case cid.DagCBOR:
+		return cbornode.DecodeBlock(block)
+	case cid.DagProtobuf:
+		return merkledag.DecodeProtobufBlock(block)
+	case cid.Raw:
+		return merkledag.DecodeRawBlock(block)
+	default:
+		return nil, fmt.Errorf("unsupported codec %d", block.Cid().Prefix().Codec)
+	}
+}
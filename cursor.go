@@ -0,0 +1,198 @@
+package ipfslog // import "berty.tech/go-ipfs-log"
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"sort"
+
+	"github.com/ipfs/go-cid"
+
+	"berty.tech/go-ipfs-log/entry"
+	"berty.tech/go-ipfs-log/errmsg"
+	"berty.tech/go-ipfs-log/iface"
+)
+
+const cursorTokenVersion = 1
+
+type CursorOptions struct {
+	// Reverse iterates from the newest entries to the oldest ones.
+	Reverse bool
+
+	// Token resumes the iteration after the entry it has been issued for,
+	// see Cursor.Token.
+	Token string
+}
+
+// Cursor is a pull-based iterator over the entries of a log.
+//
+// A cursor iterates over the entries of the log as they were when it has been
+// created, in the order of Values, or in the opposite order when Reverse is set.
+// It shares the cached order of the log, nothing is copied.
+type Cursor struct {
+	values  []iface.IPFSLogEntry
+	reverse bool
+	pos     int
+	current iface.IPFSLogEntry
+	last    iface.IPFSLogEntry
+	token   string
+	err     error
+}
+
+type cursorToken struct {
+	Version   int     `json:"v"`
+	Hash      cid.Cid `json:"hash"`
+	ClockID   []byte  `json:"clock_id,omitempty"`
+	ClockTime int     `json:"clock_time,omitempty"`
+}
+
+// NewCursor creates a cursor over the entries of the log.
+func (l *IPFSLog) NewCursor(options *CursorOptions) (*Cursor, error) {
+	if options == nil {
+		options = &CursorOptions{}
+	}
+
+	var token *cursorToken
+	if options.Token != "" {
+		var err error
+		if token, err = decodeCursorToken(options.Token); err != nil {
+			return nil, err
+		}
+	}
+
+	c := &Cursor{
+		reverse: options.Reverse,
+		token:   options.Token,
+	}
+
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+
+	if token == nil {
+		c.values, _ = l.linearized()
+		c.pos = -1
+		if options.Reverse {
+			c.pos = len(c.values)
+		}
+
+		return c, nil
+	}
+
+	values, pos, ok := l.linearPosition(token.Hash.String())
+	c.values, c.pos = values, pos
+
+	if ok {
+		return c, nil
+	}
+
+	// the entry is not in the log anymore, find where it would be when the
+	// entries are in the sort order
+	if !l.linear.merge {
+		return nil, errmsg.ErrCursorTokenNotFound
+	}
+
+	ref := &entry.Entry{
+		Hash:  token.Hash,
+		Clock: entry.NewLamportClock(token.ClockID, token.ClockTime),
+	}
+
+	next := sort.Search(len(values), func(i int) bool {
+		ret, err := l.SortFn(values[i], ref)
+		return err == nil && ret > 0
+	})
+
+	if c.reverse {
+		c.pos = next
+	} else {
+		c.pos = next - 1
+	}
+
+	return c, nil
+}
+
+// Next moves the cursor to the next entry, it returns false when there are no
+// more entries or when an error occurred.
+func (c *Cursor) Next(ctx context.Context) bool {
+	if c.err != nil {
+		return false
+	}
+
+	if err := ctx.Err(); err != nil {
+		c.err = err
+		return false
+	}
+
+	if c.reverse {
+		if c.pos <= 0 {
+			c.pos = -1
+			c.current = nil
+			return false
+		}
+		c.pos--
+	} else {
+		if c.pos >= len(c.values)-1 {
+			c.pos = len(c.values)
+			c.current = nil
+			return false
+		}
+		c.pos++
+	}
+
+	c.current = c.values[c.pos]
+	c.last = c.current
+
+	return true
+}
+
+// Entry returns the current entry of the cursor.
+func (c *Cursor) Entry() iface.IPFSLogEntry {
+	return c.current
+}
+
+// Err returns the error which stopped the cursor, if any.
+func (c *Cursor) Err() error {
+	return c.err
+}
+
+// Token returns an opaque token to resume the iteration with a new cursor
+// after the last entry returned.
+func (c *Cursor) Token() string {
+	if c.last == nil {
+		return c.token
+	}
+
+	token := &cursorToken{
+		Version: cursorTokenVersion,
+		Hash:    c.last.GetHash(),
+	}
+
+	if clock := c.last.GetClock(); clock != nil {
+		token.ClockID = clock.GetID()
+		token.ClockTime = clock.GetTime()
+	}
+
+	payload, err := json.Marshal(token)
+	if err != nil {
+		return ""
+	}
+
+	return base64.RawURLEncoding.EncodeToString(payload)
+}
+
+func decodeCursorToken(s string) (*cursorToken, error) {
+	payload, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errmsg.ErrCursorTokenInvalid.Wrap(err)
+	}
+
+	token := &cursorToken{}
+	if err := json.Unmarshal(payload, token); err != nil {
+		return nil, errmsg.ErrCursorTokenInvalid.Wrap(err)
+	}
+
+	if token.Version != cursorTokenVersion || !token.Hash.Defined() {
+		return nil, errmsg.ErrCursorTokenInvalid
+	}
+
+	return token, nil
+}
@@ -0,0 +1,33 @@
+//go:build go1.23
+
+package ipfslog // import "berty.tech/go-ipfs-log"
+
+import (
+	"context"
+	"iter"
+
+	"berty.tech/go-ipfs-log/iface"
+)
+
+// All returns an iterator over the entries of the log, see NewCursor.
+//
+// Iteration stops at the first error, which is yielded with a nil entry.
+func (l *IPFSLog) All(ctx context.Context, options *CursorOptions) iter.Seq2[iface.IPFSLogEntry, error] {
+	return func(yield func(iface.IPFSLogEntry, error) bool) {
+		c, err := l.NewCursor(options)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+
+		for c.Next(ctx) {
+			if !yield(c.Entry(), nil) {
+				return
+			}
+		}
+
+		if err := c.Err(); err != nil {
+			yield(nil, err)
+		}
+	}
+}
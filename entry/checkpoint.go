@@ -0,0 +1,252 @@
+package entry
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strconv"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+
+	"berty.tech/go-ipfs-log/errmsg"
+)
+
+var (
+	checkpointClockKey        = datastore.NewKey("clock")
+	checkpointPendingPrefix   = datastore.NewKey("pending")
+	checkpointDonePrefix      = datastore.NewKey("done")
+	checkpointExcludedPrefix  = datastore.NewKey("excluded")
+	checkpointTruncatedPrefix = datastore.NewKey("truncated")
+)
+
+type checkpointKind int
+
+const (
+	// checkpointResult is used for entries returned by the fetch
+	checkpointResult checkpointKind = iota
+	// checkpointSkipped is used for entries loaded but not returned
+	checkpointSkipped
+	// checkpointRejected is used for entries refused by the verification
+	checkpointRejected
+)
+
+type checkpointDone struct {
+	Kind checkpointKind `json:"kind"`
+	Seq  int            `json:"seq,omitempty"`
+	Err  string         `json:"err,omitempty"`
+}
+
+type checkpointClock struct {
+	Min int `json:"min"`
+	Max int `json:"max"`
+}
+
+// checkpointState is the state of an interrupted fetch.
+type checkpointState struct {
+	clock     checkpointClock
+	pending   map[cid.Cid]int
+	done      map[cid.Cid]checkpointDone
+	excluded  []cid.Cid
+	truncated []cid.Cid
+}
+
+// results returns the CIDs of the entries already returned, in their order.
+func (s *checkpointState) results() []cid.Cid {
+	var hashes []cid.Cid
+	for h, d := range s.done {
+		if d.Kind == checkpointResult {
+			hashes = append(hashes, h)
+		}
+	}
+
+	sort.Slice(hashes, func(i, j int) bool {
+		return s.done[hashes[i]].Seq < s.done[hashes[j]].Seq
+	})
+
+	return hashes
+}
+
+// checkpoint persists the state of a fetch, which are the entries done, the
+// pending frontier and the min/max clock, so that it can be resumed after
+// an interruption.
+//
+// The datastore should be dedicated to a single fetch, use a namespace
+// wrapper to share one between several fetches. Writes don't use the context
+// of the fetch, so that its state is saved even when it is canceled.
+type checkpoint struct {
+	ds datastore.Batching
+}
+
+func (c *checkpoint) load(ctx context.Context) (*checkpointState, error) {
+	state := &checkpointState{
+		pending: map[cid.Cid]int{},
+		done:    map[cid.Cid]checkpointDone{},
+	}
+
+	data, err := c.ds.Get(ctx, checkpointClockKey)
+	switch err {
+	case nil:
+		if err := json.Unmarshal(data, &state.clock); err != nil {
+			return nil, errmsg.ErrCheckpointOperationFailed.Wrap(err)
+		}
+	case datastore.ErrNotFound:
+	default:
+		return nil, errmsg.ErrCheckpointOperationFailed.Wrap(err)
+	}
+
+	err = c.each(ctx, checkpointPendingPrefix, func(hash cid.Cid, value []byte) error {
+		index, err := strconv.Atoi(string(value))
+		if err != nil {
+			return err
+		}
+
+		state.pending[hash] = index
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.each(ctx, checkpointDonePrefix, func(hash cid.Cid, value []byte) error {
+		var done checkpointDone
+		if err := json.Unmarshal(value, &done); err != nil {
+			return err
+		}
+
+		state.done[hash] = done
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.each(ctx, checkpointExcludedPrefix, func(hash cid.Cid, _ []byte) error {
+		state.excluded = append(state.excluded, hash)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.each(ctx, checkpointTruncatedPrefix, func(hash cid.Cid, _ []byte) error {
+		state.truncated = append(state.truncated, hash)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return state, nil
+}
+
+func (c *checkpoint) each(ctx context.Context, prefix datastore.Key, fn func(hash cid.Cid, value []byte) error) error {
+	results, err := c.ds.Query(ctx, query.Query{Prefix: prefix.String()})
+	if err != nil {
+		return errmsg.ErrCheckpointOperationFailed.Wrap(err)
+	}
+	defer results.Close()
+
+	for result := range results.Next() {
+		if result.Error != nil {
+			return errmsg.ErrCheckpointOperationFailed.Wrap(result.Error)
+		}
+
+		hash, err := cid.Decode(datastore.RawKey(result.Key).BaseNamespace())
+		if err != nil {
+			return errmsg.ErrCheckpointOperationFailed.Wrap(err)
+		}
+
+		if err := fn(hash, result.Value); err != nil {
+			return errmsg.ErrCheckpointOperationFailed.Wrap(err)
+		}
+	}
+
+	return nil
+}
+
+// queue adds a hash to the pending frontier.
+func (c *checkpoint) queue(hash cid.Cid, index int) error {
+	if err := c.ds.Put(context.Background(), checkpointPendingPrefix.ChildString(hash.String()), []byte(strconv.Itoa(index))); err != nil {
+		return errmsg.ErrCheckpointOperationFailed.Wrap(err)
+	}
+
+	return nil
+}
+
+// mark records a hash excluded or truncated by the fetch.
+func (c *checkpoint) mark(prefix datastore.Key, hash cid.Cid) error {
+	if err := c.ds.Put(context.Background(), prefix.ChildString(hash.String()), nil); err != nil {
+		return errmsg.ErrCheckpointOperationFailed.Wrap(err)
+	}
+
+	return nil
+}
+
+// done moves a hash from the pending frontier to the done set.
+func (c *checkpoint) done(hash cid.Cid, done checkpointDone, clock checkpointClock) error {
+	ctx := context.Background()
+
+	doneData, err := json.Marshal(done)
+	if err != nil {
+		return errmsg.ErrCheckpointOperationFailed.Wrap(err)
+	}
+
+	clockData, err := json.Marshal(clock)
+	if err != nil {
+		return errmsg.ErrCheckpointOperationFailed.Wrap(err)
+	}
+
+	batch, err := c.ds.Batch(ctx)
+	if err != nil {
+		return errmsg.ErrCheckpointOperationFailed.Wrap(err)
+	}
+
+	if err := batch.Put(ctx, checkpointDonePrefix.ChildString(hash.String()), doneData); err != nil {
+		return errmsg.ErrCheckpointOperationFailed.Wrap(err)
+	}
+
+	if err := batch.Put(ctx, checkpointClockKey, clockData); err != nil {
+		return errmsg.ErrCheckpointOperationFailed.Wrap(err)
+	}
+
+	if err := batch.Delete(ctx, checkpointPendingPrefix.ChildString(hash.String())); err != nil {
+		return errmsg.ErrCheckpointOperationFailed.Wrap(err)
+	}
+
+	if err := batch.Commit(ctx); err != nil {
+		return errmsg.ErrCheckpointOperationFailed.Wrap(err)
+	}
+
+	return nil
+}
+
+// clear removes the checkpoint once the fetch is over.
+func (c *checkpoint) clear() error {
+	ctx := context.Background()
+
+	batch, err := c.ds.Batch(ctx)
+	if err != nil {
+		return errmsg.ErrCheckpointOperationFailed.Wrap(err)
+	}
+
+	if err := batch.Delete(ctx, checkpointClockKey); err != nil {
+		return errmsg.ErrCheckpointOperationFailed.Wrap(err)
+	}
+
+	for _, prefix := range []datastore.Key{checkpointPendingPrefix, checkpointDonePrefix, checkpointExcludedPrefix, checkpointTruncatedPrefix} {
+		err := c.each(ctx, prefix, func(hash cid.Cid, _ []byte) error {
+			return batch.Delete(ctx, prefix.ChildString(hash.String()))
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := batch.Commit(ctx); err != nil {
+		return errmsg.ErrCheckpointOperationFailed.Wrap(err)
+	}
+
+	return nil
+}
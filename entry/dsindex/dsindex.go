@@ -0,0 +1,549 @@
+// Package dsindex implements a log index persisted in a datastore, allowing a
+// log to be reopened without fetching its entries again.
+package dsindex // import "berty.tech/go-ipfs-log/entry/dsindex"
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+
+	"berty.tech/go-ipfs-log/entry"
+	"berty.tech/go-ipfs-log/errmsg"
+	"berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/iface"
+)
+
+var (
+	recordsPrefix = datastore.NewKey("records")
+	entriesPrefix = datastore.NewKey("entries")
+	nextPrefix    = datastore.NewKey("next")
+	headsKey      = datastore.NewKey("heads")
+)
+
+type Options struct {
+	// Provider is set on the identities of the decoded entries.
+	Provider identityprovider.Interface
+
+	// RefEntry is used to instantiate the decoded entries, defaults to entry.Entry.
+	RefEntry iface.IPFSLogEntry
+
+	// RefClock is used to instantiate the decoded clocks, defaults to entry.LamportClock.
+	RefClock iface.IPFSLogLamportClock
+
+	// CacheSize is the number of decoded entries kept in memory, defaults to 1024.
+	CacheSize int
+}
+
+// Index persists the entries, the Next reverse index and the heads of a log.
+//
+// Entries are stored once by CID and shared between the entries and the Next
+// maps. The datastore should be dedicated to a single log, use a namespace
+// wrapper to share one between several logs.
+type Index struct {
+	ds       datastore.Batching
+	provider identityprovider.Interface
+	refEntry iface.IPFSLogEntry
+	refClock iface.IPFSLogLamportClock
+	cache    *lru.Cache
+
+	entries *OrderedMap
+	next    *OrderedMap
+
+	muErr sync.Mutex
+	err   error
+}
+
+// Open opens an index stored in a datastore, an empty datastore gives an
+// empty index.
+func Open(ctx context.Context, ds datastore.Batching, options *Options) (*Index, error) {
+	if ds == nil {
+		return nil, errmsg.ErrIndexNotDefined
+	}
+
+	if options == nil {
+		options = &Options{}
+	}
+
+	if options.RefEntry == nil {
+		options.RefEntry = &entry.Entry{}
+	}
+
+	if options.RefClock == nil {
+		options.RefClock = &entry.LamportClock{}
+	}
+
+	if options.CacheSize <= 0 {
+		options.CacheSize = 1024
+	}
+
+	cache, err := lru.New(options.CacheSize)
+	if err != nil {
+		return nil, errmsg.ErrIndexOperationFailed.Wrap(err)
+	}
+
+	idx := &Index{
+		ds:       ds,
+		provider: options.Provider,
+		refEntry: options.RefEntry,
+		refClock: options.RefClock,
+		cache:    cache,
+	}
+
+	if idx.entries, err = idx.openMap(ctx, entriesPrefix); err != nil {
+		return nil, err
+	}
+
+	if idx.next, err = idx.openMap(ctx, nextPrefix); err != nil {
+		return nil, err
+	}
+
+	return idx, nil
+}
+
+func (i *Index) openMap(ctx context.Context, prefix datastore.Key) (*OrderedMap, error) {
+	m := &OrderedMap{
+		index:  i,
+		prefix: prefix,
+	}
+
+	value, err := i.ds.Get(ctx, m.lenKey())
+	switch err {
+	case nil:
+		if m.length, err = strconv.Atoi(string(value)); err != nil {
+			return nil, errmsg.ErrIndexOperationFailed.Wrap(err)
+		}
+	case datastore.ErrNotFound:
+	default:
+		return nil, errmsg.ErrIndexOperationFailed.Wrap(err)
+	}
+
+	return m, nil
+}
+
+// Entries returns the entries of the log indexed by their CID.
+func (i *Index) Entries() iface.IPFSLogOrderedEntries {
+	return i.entries
+}
+
+// Next returns the reverse index of entries indexed by their next CIDs.
+func (i *Index) Next() iface.IPFSLogOrderedEntries {
+	return i.next
+}
+
+// Heads returns the persisted heads.
+func (i *Index) Heads() ([]iface.IPFSLogEntry, error) {
+	ctx := context.Background()
+
+	value, err := i.ds.Get(ctx, headsKey)
+	if err == datastore.ErrNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, errmsg.ErrIndexOperationFailed.Wrap(err)
+	}
+
+	var hashes []string
+	if err := json.Unmarshal(value, &hashes); err != nil {
+		return nil, errmsg.ErrIndexOperationFailed.Wrap(err)
+	}
+
+	heads := make([]iface.IPFSLogEntry, len(hashes))
+	for j, h := range hashes {
+		if heads[j], err = i.getRecord(ctx, h); err != nil {
+			return nil, err
+		}
+	}
+
+	return heads, nil
+}
+
+// SetHeads replaces the persisted heads.
+func (i *Index) SetHeads(heads []iface.IPFSLogEntry) error {
+	ctx := context.Background()
+
+	batch, err := i.ds.Batch(ctx)
+	if err != nil {
+		return errmsg.ErrIndexOperationFailed.Wrap(err)
+	}
+
+	hashes := make([]string, len(heads))
+	for j, h := range heads {
+		hashes[j] = h.GetHash().String()
+		if err := i.putRecord(ctx, batch, h); err != nil {
+			return err
+		}
+	}
+
+	value, err := json.Marshal(hashes)
+	if err != nil {
+		return errmsg.ErrIndexOperationFailed.Wrap(err)
+	}
+
+	if err := batch.Put(ctx, headsKey, value); err != nil {
+		return errmsg.ErrIndexOperationFailed.Wrap(err)
+	}
+
+	if err := batch.Commit(ctx); err != nil {
+		return errmsg.ErrIndexOperationFailed.Wrap(err)
+	}
+
+	// records are only cached once persisted
+	for _, h := range heads {
+		i.cache.Add(h.GetHash().String(), h)
+	}
+
+	return nil
+}
+
+// Err returns the first error which occurred while reading or writing the
+// datastore through the iface.IPFSLogOrderedEntries methods, as they can't
+// report errors.
+func (i *Index) Err() error {
+	i.muErr.Lock()
+	defer i.muErr.Unlock()
+
+	return i.err
+}
+
+func (i *Index) setErr(err error) {
+	i.muErr.Lock()
+	if i.err == nil {
+		i.err = err
+	}
+	i.muErr.Unlock()
+}
+
+func recordKey(hash string) datastore.Key {
+	return recordsPrefix.ChildString(hash)
+}
+
+func (i *Index) getRecord(ctx context.Context, hash string) (iface.IPFSLogEntry, error) {
+	if e, ok := i.cache.Get(hash); ok {
+		return e.(iface.IPFSLogEntry), nil
+	}
+
+	value, err := i.ds.Get(ctx, recordKey(hash))
+	if err != nil {
+		return nil, errmsg.ErrIndexOperationFailed.Wrap(err)
+	}
+
+	e, err := i.decode(value)
+	if err != nil {
+		return nil, err
+	}
+
+	i.cache.Add(hash, e)
+
+	return e, nil
+}
+
+func (i *Index) putRecord(ctx context.Context, batch datastore.Batch, e iface.IPFSLogEntry) error {
+	hash := e.GetHash().String()
+	if i.cache.Contains(hash) {
+		return nil
+	}
+
+	has, err := i.ds.Has(ctx, recordKey(hash))
+	if err != nil {
+		return errmsg.ErrIndexOperationFailed.Wrap(err)
+	}
+
+	if !has {
+		value, err := encode(e)
+		if err != nil {
+			return err
+		}
+
+		if err := batch.Put(ctx, recordKey(hash), value); err != nil {
+			return errmsg.ErrIndexOperationFailed.Wrap(err)
+		}
+	}
+
+	return nil
+}
+
+func encode(e iface.IPFSLogEntry) ([]byte, error) {
+	value, err := json.Marshal(entry.ToRecord(e))
+	if err != nil {
+		return nil, errmsg.ErrJSONSerializationFailed.Wrap(err)
+	}
+
+	return value, nil
+}
+
+func (i *Index) decode(value []byte) (iface.IPFSLogEntry, error) {
+	r := &entry.Record{}
+	if err := json.Unmarshal(value, r); err != nil {
+		return nil, errmsg.ErrEntryDeserializationFailed.Wrap(err)
+	}
+
+	return r.ToEntry(i.refEntry, i.refClock, i.provider), nil
+}
+
+// OrderedMap is an ordered map of entries persisted in a datastore.
+type OrderedMap struct {
+	index  *Index
+	prefix datastore.Key
+	lock   sync.RWMutex
+	length int
+
+	// keys caches the ordered keys once loaded
+	keys []string
+}
+
+func (o *OrderedMap) lenKey() datastore.Key {
+	return o.prefix.ChildString("len")
+}
+
+func (o *OrderedMap) keyKey(key string) datastore.Key {
+	return o.prefix.ChildString("keys").ChildString(key)
+}
+
+func (o *OrderedMap) orderKey(index int) datastore.Key {
+	return o.prefix.ChildString("order").ChildString(fmt.Sprintf("%020d", index))
+}
+
+// Merge will fusion two OrderedMap of entries, the result is kept in memory.
+func (o *OrderedMap) Merge(other iface.IPFSLogOrderedEntries) iface.IPFSLogOrderedEntries {
+	newMap := o.Copy()
+
+	for _, k := range other.Keys() {
+		val, _ := other.Get(k)
+		newMap.Set(k, val)
+	}
+
+	return newMap
+}
+
+// Copy creates an in memory copy of an OrderedMap.
+func (o *OrderedMap) Copy() iface.IPFSLogOrderedEntries {
+	newMap := entry.NewOrderedMap()
+
+	for _, k := range o.Keys() {
+		if val, ok := o.Get(k); ok {
+			newMap.Set(k, val)
+		}
+	}
+
+	return newMap
+}
+
+// Get retrieves an Entry using its key.
+func (o *OrderedMap) Get(key string) (iface.IPFSLogEntry, bool) {
+	ctx := context.Background()
+
+	hash, err := o.index.ds.Get(ctx, o.keyKey(key))
+	if err == datastore.ErrNotFound {
+		return nil, false
+	} else if err != nil {
+		o.index.setErr(errmsg.ErrIndexOperationFailed.Wrap(err))
+		return nil, false
+	}
+
+	e, err := o.index.getRecord(ctx, string(hash))
+	if err != nil {
+		o.index.setErr(err)
+		return nil, false
+	}
+
+	return e, true
+}
+
+// UnsafeGet retrieves an Entry using its key, returns nil if not found.
+func (o *OrderedMap) UnsafeGet(key string) iface.IPFSLogEntry {
+	val, _ := o.Get(key)
+
+	return val
+}
+
+// Set defines an Entry in the map for a given key.
+func (o *OrderedMap) Set(key string, value iface.IPFSLogEntry) {
+	if err := o.set(context.Background(), key, value); err != nil {
+		o.index.setErr(err)
+	}
+}
+
+func (o *OrderedMap) set(ctx context.Context, key string, value iface.IPFSLogEntry) error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	exists, err := o.index.ds.Has(ctx, o.keyKey(key))
+	if err != nil {
+		return errmsg.ErrIndexOperationFailed.Wrap(err)
+	}
+
+	batch, err := o.index.ds.Batch(ctx)
+	if err != nil {
+		return errmsg.ErrIndexOperationFailed.Wrap(err)
+	}
+
+	if err := o.index.putRecord(ctx, batch, value); err != nil {
+		return err
+	}
+
+	if err := batch.Put(ctx, o.keyKey(key), []byte(value.GetHash().String())); err != nil {
+		return errmsg.ErrIndexOperationFailed.Wrap(err)
+	}
+
+	if !exists {
+		if err := batch.Put(ctx, o.orderKey(o.length), []byte(key)); err != nil {
+			return errmsg.ErrIndexOperationFailed.Wrap(err)
+		}
+
+		if err := batch.Put(ctx, o.lenKey(), []byte(strconv.Itoa(o.length+1))); err != nil {
+			return errmsg.ErrIndexOperationFailed.Wrap(err)
+		}
+	}
+
+	if err := batch.Commit(ctx); err != nil {
+		return errmsg.ErrIndexOperationFailed.Wrap(err)
+	}
+
+	o.index.cache.Add(value.GetHash().String(), value)
+
+	if !exists {
+		o.length++
+
+		if o.keys != nil {
+			o.keys = append(o.keys, key)
+		}
+	}
+
+	return nil
+}
+
+// Slice returns an ordered slice of the values existing in the map.
+func (o *OrderedMap) Slice() []iface.IPFSLogEntry {
+	keys := o.Keys()
+	out := make([]iface.IPFSLogEntry, 0, len(keys))
+
+	for _, k := range keys {
+		if val, ok := o.Get(k); ok {
+			out = append(out, val)
+		}
+	}
+
+	return out
+}
+
+// Keys retrieves the ordered list of keys in the map.
+func (o *OrderedMap) Keys() []string {
+	o.lock.RLock()
+	keys := o.keys
+	o.lock.RUnlock()
+
+	if keys != nil {
+		return keys
+	}
+
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	keys, err := o.loadKeys(context.Background())
+	if err != nil {
+		o.index.setErr(err)
+		return nil
+	}
+
+	return keys
+}
+
+// loadKeys returns the ordered keys, they are read from the datastore the
+// first time.
+func (o *OrderedMap) loadKeys(ctx context.Context) ([]string, error) {
+	// o.lock must be Locked
+
+	if o.keys != nil {
+		return o.keys, nil
+	}
+
+	results, err := o.index.ds.Query(ctx, query.Query{
+		Prefix: o.prefix.ChildString("order").String(),
+		Orders: []query.Order{query.OrderByKey{}},
+	})
+	if err != nil {
+		return nil, errmsg.ErrIndexOperationFailed.Wrap(err)
+	}
+	defer results.Close()
+
+	keys := make([]string, 0, o.length)
+	for result := range results.Next() {
+		if result.Error != nil {
+			return nil, errmsg.ErrIndexOperationFailed.Wrap(result.Error)
+		}
+
+		keys = append(keys, string(result.Value))
+	}
+
+	o.keys = keys
+
+	return keys, nil
+}
+
+// Len gets the length of the map.
+func (o *OrderedMap) Len() int {
+	o.lock.RLock()
+	defer o.lock.RUnlock()
+
+	return o.length
+}
+
+// At gets an item at the given index in the map, returns nil if not found.
+func (o *OrderedMap) At(index uint) iface.IPFSLogEntry {
+	keys := o.Keys()
+	if uint(len(keys)) <= index {
+		return nil
+	}
+
+	return o.UnsafeGet(keys[index])
+}
+
+// Reverse reverses the order of the map in place, the new order is
+// persisted.
+func (o *OrderedMap) Reverse() iface.IPFSLogOrderedEntries {
+	if err := o.reverse(context.Background()); err != nil {
+		o.index.setErr(err)
+	}
+
+	return o
+}
+
+func (o *OrderedMap) reverse(ctx context.Context) error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	keys, err := o.loadKeys(ctx)
+	if err != nil {
+		return err
+	}
+
+	batch, err := o.index.ds.Batch(ctx)
+	if err != nil {
+		return errmsg.ErrIndexOperationFailed.Wrap(err)
+	}
+
+	for i, key := range keys {
+		if err := batch.Put(ctx, o.orderKey(len(keys)-1-i), []byte(key)); err != nil {
+			return errmsg.ErrIndexOperationFailed.Wrap(err)
+		}
+	}
+
+	if err := batch.Commit(ctx); err != nil {
+		return errmsg.ErrIndexOperationFailed.Wrap(err)
+	}
+
+	for i := len(keys)/2 - 1; i >= 0; i-- {
+		opp := len(keys) - 1 - i
+		keys[i], keys[opp] = keys[opp], keys[i]
+	}
+
+	return nil
+}
+
+var _ iface.IPFSLogIndex = (*Index)(nil)
+var _ iface.IPFSLogOrderedEntries = (*OrderedMap)(nil)
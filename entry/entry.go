@@ -2,13 +2,13 @@
 package entry // import "berty.tech/go-ipfs-log/entry"
 
 import (
+	"bytes"
 	"context"
 	"encoding/hex"
 	"encoding/json"
 	"sort"
 
 	"github.com/ipfs/go-cid"
-	coreiface "github.com/ipfs/kubo/core/coreiface"
 	"github.com/multiformats/go-multibase"
 
 	"berty.tech/go-ipfs-log/errmsg"
@@ -83,6 +83,16 @@ func (e *Entry) GetClock() iface.IPFSLogLamportClock {
 	return e.Clock
 }
 
+// GetClockTime returns the time of the clock of the entry, it lets access
+// controllers read it, see accesscontroller.TimedLogEntry.
+func (e *Entry) GetClockTime() int {
+	if e.Clock == nil {
+		return 0
+	}
+
+	return e.Clock.GetTime()
+}
+
 func (e *Entry) GetAdditionalData() map[string]string {
 	return e.AdditionalData
 }
@@ -134,18 +144,18 @@ func (e *Entry) SetAdditionalDataValue(key string, value string) {
 	e.AdditionalData[key] = value
 }
 
-func CreateEntry(ctx context.Context, ipfsInstance coreiface.CoreAPI, identity *identityprovider.Identity, data *Entry, opts *iface.CreateEntryOptions) (iface.IPFSLogEntry, error) {
+func CreateEntry(ctx context.Context, storage iface.Storage, identity *identityprovider.Identity, data *Entry, opts *iface.CreateEntryOptions) (iface.IPFSLogEntry, error) {
 	io, err := cbor.IO(&Entry{}, &LamportClock{})
 	if err != nil {
 		return nil, err
 	}
 
-	return CreateEntryWithIO(ctx, ipfsInstance, identity, data, opts, io)
+	return CreateEntryWithIO(ctx, storage, identity, data, opts, io)
 }
 
 // CreateEntryWithIO creates an Entry.
-func CreateEntryWithIO(ctx context.Context, ipfsInstance coreiface.CoreAPI, identity *identityprovider.Identity, data iface.IPFSLogEntry, opts *iface.CreateEntryOptions, io iface.IO) (iface.IPFSLogEntry, error) {
-	if ipfsInstance == nil {
+func CreateEntryWithIO(ctx context.Context, storage iface.Storage, identity *identityprovider.Identity, data iface.IPFSLogEntry, opts *iface.CreateEntryOptions, io iface.IO) (iface.IPFSLogEntry, error) {
+	if storage == nil {
 		return nil, errmsg.ErrIPFSNotDefined
 	}
 
@@ -201,7 +211,7 @@ func CreateEntryWithIO(ctx context.Context, ipfsInstance coreiface.CoreAPI, iden
 
 	data.SetIdentity(identity.Filtered())
 
-	h, err := ToMultihashWithIO(ctx, data, ipfsInstance, opts, io)
+	h, err := ToMultihashWithIO(ctx, data, storage, opts, io)
 	if err != nil {
 		return nil, errmsg.ErrIPFSOperationFailed.Wrap(err)
 	}
@@ -321,10 +331,17 @@ func ToHashable(e iface.IPFSLogEntry) (*iface.Hashable, error) {
 		refs[i] = c
 	}
 
+	payload := e.GetPayload()
+
+	// a sealed payload is signed in place of the clear one
+	if _, ok := e.GetAdditionalData()[iface.KeyEncryptedPayload]; ok {
+		payload = nil
+	}
+
 	return &iface.Hashable{
 		Hash:           nil,
 		ID:             e.GetLogID(),
-		Payload:        e.GetPayload(),
+		Payload:        payload,
 		Next:           nexts,
 		Refs:           refs,
 		V:              e.GetV(),
@@ -341,7 +358,8 @@ func (e *Entry) IsValid() bool {
 	return ok
 }
 
-// Verify checks the entry's signature.
+// Verify checks the entry's signature and that it has been signed by its
+// identity.
 func (e *Entry) Verify(identity identityprovider.Interface, io iface.IO) error {
 	if e == nil || !e.Defined() {
 		return errmsg.ErrEntryNotDefined
@@ -355,11 +373,44 @@ func (e *Entry) Verify(identity identityprovider.Interface, io iface.IO) error {
 		return errmsg.ErrSigNotDefined
 	}
 
+	if e.Identity == nil {
+		return errmsg.ErrIdentityNotDefined
+	}
+
+	if !bytes.Equal(e.Key, e.Identity.PublicKey) {
+		return errmsg.ErrIdentityKeyMismatch
+	}
+
+	if err := identityprovider.VerifyIdentity(e.Identity); err != nil {
+		return errmsg.ErrIdentityUnknown.Wrap(err)
+	}
+
+	// the clear payload of a sealed entry isn't signed, it must match
+	if _, ok := e.AdditionalData[iface.KeyEncryptedPayload]; ok && len(e.Payload) > 0 {
+		opener, ok := io.(iface.IOOpenPayload)
+		if !ok {
+			return errmsg.ErrSigNotVerified.Wrap(errmsg.ErrDecrypt)
+		}
+
+		payload, err := opener.OpenPayload(e)
+		if err != nil {
+			return errmsg.ErrSigNotVerified.Wrap(err)
+		}
+
+		if !bytes.Equal(payload, e.Payload) {
+			return errmsg.ErrSigNotVerified
+		}
+	}
+
 	// TODO: Check against trusted keys
-	var verifiedEntry iface.IPFSLogEntry
+	var verifiedEntry iface.IPFSLogEntry = e
 	if io, ok := io.(iface.IOPreSign); ok {
+		// entries are pre-signed before their key is set
+		unsigned := e.Copy()
+		unsigned.SetKey(nil)
+
 		var err error
-		verifiedEntry, err = io.PreSign(e)
+		verifiedEntry, err = io.PreSign(unsigned)
 
 		if err != nil {
 			return err
@@ -394,17 +445,17 @@ func (e *Entry) Verify(identity identityprovider.Interface, io iface.IO) error {
 }
 
 // ToMultihash gets the multihash of an Entry.
-func (e *Entry) ToMultihash(ctx context.Context, ipfsInstance coreiface.CoreAPI, opts *iface.CreateEntryOptions) (cid.Cid, error) {
+func (e *Entry) ToMultihash(ctx context.Context, storage iface.Storage, opts *iface.CreateEntryOptions) (cid.Cid, error) {
 	io, err := cbor.IO(&Entry{}, &LamportClock{})
 	if err != nil {
 		return cid.Undef, err
 	}
 
-	return ToMultihashWithIO(ctx, e, ipfsInstance, opts, io)
+	return ToMultihashWithIO(ctx, e, storage, opts, io)
 }
 
 // ToMultihashWithIO gets the multihash of an Entry.
-func ToMultihashWithIO(ctx context.Context, e iface.IPFSLogEntry, ipfsInstance coreiface.CoreAPI, opts *iface.CreateEntryOptions, io iface.IO) (cid.Cid, error) {
+func ToMultihashWithIO(ctx context.Context, e iface.IPFSLogEntry, storage iface.Storage, opts *iface.CreateEntryOptions, io iface.IO) (cid.Cid, error) {
 	if opts == nil {
 		opts = &iface.CreateEntryOptions{}
 	}
@@ -413,7 +464,7 @@ func ToMultihashWithIO(ctx context.Context, e iface.IPFSLogEntry, ipfsInstance c
 		return cid.Undef, errmsg.ErrEntryNotDefined
 	}
 
-	if ipfsInstance == nil {
+	if storage == nil {
 		return cid.Undef, errmsg.ErrIPFSNotDefined
 	}
 
@@ -421,7 +472,7 @@ func ToMultihashWithIO(ctx context.Context, e iface.IPFSLogEntry, ipfsInstance c
 		preSigned: opts.PreSigned,
 	})
 
-	return io.Write(ctx, ipfsInstance, data, &iface.WriteOpts{
+	return io.Write(ctx, storage, data, &iface.WriteOpts{
 		Pin: opts.Pin,
 	})
 }
@@ -468,22 +519,22 @@ func Normalize(e iface.IPFSLogEntry, opts *normalizeEntryOpts) *Entry {
 }
 
 // FromMultihash creates an Entry from a hash.
-func FromMultihash(ctx context.Context, ipfs coreiface.CoreAPI, hash cid.Cid, provider identityprovider.Interface) (iface.IPFSLogEntry, error) {
+func FromMultihash(ctx context.Context, storage iface.Storage, hash cid.Cid, provider identityprovider.Interface) (iface.IPFSLogEntry, error) {
 	io, err := cbor.IO(&Entry{}, &LamportClock{})
 	if err != nil {
 		return nil, err
 	}
 
-	return FromMultihashWithIO(ctx, ipfs, hash, provider, io)
+	return FromMultihashWithIO(ctx, storage, hash, provider, io)
 }
 
 // FromMultihashWithIO creates an Entry from a hash.
-func FromMultihashWithIO(ctx context.Context, ipfs coreiface.CoreAPI, hash cid.Cid, provider identityprovider.Interface, io iface.IO) (iface.IPFSLogEntry, error) {
-	if ipfs == nil {
+func FromMultihashWithIO(ctx context.Context, storage iface.Storage, hash cid.Cid, provider identityprovider.Interface, io iface.IO) (iface.IPFSLogEntry, error) {
+	if storage == nil {
 		return nil, errmsg.ErrIPFSNotDefined
 	}
 
-	result, err := io.Read(ctx, ipfs, hash)
+	result, err := io.Read(ctx, storage, hash)
 	if err != nil {
 		return nil, errmsg.ErrIPFSReadFailed.Wrap(err)
 	}
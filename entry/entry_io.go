@@ -4,7 +4,6 @@ import (
 	"context"
 
 	"github.com/ipfs/go-cid"
-	coreiface "github.com/ipfs/kubo/core/coreiface"
 
 	"berty.tech/go-ipfs-log/iface"
 )
@@ -13,13 +12,22 @@ type FetchOptions = iface.FetchOptions
 
 // FetchParallel has the same comportement than FetchAll, we keep it for retrop
 // compatibility purpose
-func FetchParallel(ctx context.Context, ipfs coreiface.CoreAPI, hashes []cid.Cid, options *FetchOptions) []iface.IPFSLogEntry {
-	fetcher := NewFetcher(ipfs, options)
-	return fetcher.Fetch(ctx, hashes)
+func FetchParallel(ctx context.Context, storage iface.Storage, hashes []cid.Cid, options *FetchOptions) []iface.IPFSLogEntry {
+	fetcher := NewFetcher(storage, options)
+	entries, _ := fetcher.Fetch(ctx, hashes)
+	return entries
 }
 
 // FetchAll gets entries from their CIDs.
-func FetchAll(ctx context.Context, ipfs coreiface.CoreAPI, hashes []cid.Cid, options *FetchOptions) []iface.IPFSLogEntry {
-	fetcher := NewFetcher(ipfs, options)
+func FetchAll(ctx context.Context, storage iface.Storage, hashes []cid.Cid, options *FetchOptions) []iface.IPFSLogEntry {
+	fetcher := NewFetcher(storage, options)
+	entries, _ := fetcher.Fetch(ctx, hashes)
+	return entries
+}
+
+// FetchAllWithReport gets entries from their CIDs, along with a report of
+// the entries which could not be loaded.
+func FetchAllWithReport(ctx context.Context, storage iface.Storage, hashes []cid.Cid, options *FetchOptions) ([]iface.IPFSLogEntry, *FetchReport) {
+	fetcher := NewFetcher(storage, options)
 	return fetcher.Fetch(ctx, hashes)
 }
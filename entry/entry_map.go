@@ -66,6 +66,23 @@ func NewOrderedMapFromEntries(entries []iface.IPFSLogEntry) iface.IPFSLogOrdered
 	return orderedMap
 }
 
+// NewOrderedMapFromKeyedEntries creates a new OrderedMap of entries from a
+// slice and the slice of their keys, which must be unique.
+func NewOrderedMapFromKeyedEntries(keys []string, entries []iface.IPFSLogEntry) iface.IPFSLogOrderedEntries {
+	orderedMap := &OrderedMap{
+		keys:   make([]string, len(keys)),
+		values: make(map[string]iface.IPFSLogEntry, len(keys)),
+	}
+
+	copy(orderedMap.keys, keys)
+
+	for i, k := range keys {
+		orderedMap.values[k] = entries[i]
+	}
+
+	return orderedMap
+}
+
 // Merge will fusion two OrderedMap of entries.
 func (o *OrderedMap) Merge(other iface.IPFSLogOrderedEntries) iface.IPFSLogOrderedEntries {
 	newMap := NewOrderedMap()
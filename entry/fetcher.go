@@ -2,14 +2,19 @@ package entry
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"sort"
 	"sync"
 	"time"
 
+	"berty.tech/go-ipfs-log/accesscontroller"
+	"berty.tech/go-ipfs-log/errmsg"
 	"berty.tech/go-ipfs-log/identityprovider"
 	"berty.tech/go-ipfs-log/iface"
 	"berty.tech/go-ipfs-log/io/cbor"
 	"github.com/ipfs/go-cid"
-	coreiface "github.com/ipfs/kubo/core/coreiface"
+	format "github.com/ipfs/go-ipld-format"
 	"golang.org/x/sync/semaphore"
 )
 
@@ -21,10 +26,15 @@ const (
 	taskKindDone
 )
 
+const defaultRetryBackoff = 100 * time.Millisecond
+
 func noopShouldExclude(_ cid.Cid) bool {
 	return false
 }
 
+// FetchReport describes the entries a fetch could not load.
+type FetchReport = iface.FetchReport
+
 type Fetcher struct {
 	length   int
 	maxClock int // keep track of the latest clock time during load
@@ -39,11 +49,54 @@ type Fetcher struct {
 	condProcess   *sync.Cond
 	muProcess     *sync.RWMutex
 	sem           *semaphore.Weighted
-	ipfs          coreiface.CoreAPI
+	storage       iface.Storage
 	progressChan  chan iface.IPFSLogEntry
+
+	retries         int
+	retryBackoff    time.Duration
+	maxRetryBackoff time.Duration
+
+	sinceClockTime int
+	frontier       *frontier
+
+	accessController accesscontroller.InterfaceV2
+	verifySignatures bool
+
+	// entries accepted so far and the fetched heads, given to the access
+	// controller
+	muAccepted    sync.RWMutex
+	accepted      []iface.IPFSLogEntry
+	acceptedIndex map[cid.Cid]iface.IPFSLogEntry
+	heads         []cid.Cid
+	views         map[string]*fetchCanAppendContext
+
+	checkpoint *checkpoint
+
+	// report is filled at the end of each fetch when set
+	report *FetchReport
+
+	// report of the running fetch, guarded by muProcess
+	failed        map[cid.Cid]error
+	excluded      map[cid.Cid]struct{}
+	truncated     map[cid.Cid]struct{}
+	rejected      map[cid.Cid]error
+	checkpointErr error
+
+	// entries waiting for the access controller and the ones waiting for
+	// each entry to be decided, guarded by muProcess
+	pending map[cid.Cid]*pendingEntry
+	waiters map[cid.Cid][]*pendingEntry
+}
+
+// pendingEntry is a fetched entry checked by the access controller once its
+// Next entries are decided.
+type pendingEntry struct {
+	entry   iface.IPFSLogEntry
+	hash    cid.Cid
+	waiting int
 }
 
-func NewFetcher(ipfs coreiface.CoreAPI, options *FetchOptions) *Fetcher {
+func NewFetcher(storage iface.Storage, options *FetchOptions) *Fetcher {
 	// set default
 	length := -1
 	if options.Length != nil {
@@ -67,47 +120,105 @@ func NewFetcher(ipfs coreiface.CoreAPI, options *FetchOptions) *Fetcher {
 		options.ShouldExclude = noopShouldExclude
 	}
 
+	retryBackoff := options.RetryBackoff
+	if retryBackoff <= 0 {
+		retryBackoff = defaultRetryBackoff
+	}
+
 	muProcess := sync.RWMutex{}
 
 	// create Fetcher
-	return &Fetcher{
+	f := &Fetcher{
 		io:            options.IO,
+		provider:      options.Provider,
 		length:        length,
 		timeout:       options.Timeout,
 		shouldExclude: options.ShouldExclude,
 		sem:           semaphore.NewWeighted(int64(options.Concurrency)),
-		ipfs:          ipfs,
+		storage:       storage,
 		progressChan:  options.ProgressChan,
 		muProcess:     &muProcess,
 		condProcess:   sync.NewCond(&muProcess),
 		maxClock:      0,
 		minClock:      0,
 		tasksCache:    make(map[cid.Cid]taskKind),
+
+		retries:         options.Retries,
+		retryBackoff:    retryBackoff,
+		maxRetryBackoff: options.MaxRetryBackoff,
+		sinceClockTime:  options.SinceClockTime,
+
+		accessController: options.AccessControllerV2,
+		verifySignatures: options.VerifySignatures,
+
+		report: options.Report,
+	}
+
+	if f.accessController == nil && options.AccessController != nil {
+		f.accessController = accesscontroller.FromV1(options.AccessController)
+	}
+
+	if len(options.Frontier) > 0 {
+		f.frontier = newFrontier(f, options.Frontier)
+	}
+
+	if options.Checkpoint != nil {
+		f.checkpoint = &checkpoint{ds: options.Checkpoint}
 	}
+
+	return f
 }
 
-func (f *Fetcher) Fetch(ctx context.Context, hashes []cid.Cid) []iface.IPFSLogEntry {
+// Fetch loads the entries from the given CIDs, and returns them along with a
+// report of the ones which could not be loaded.
+func (f *Fetcher) Fetch(ctx context.Context, hashes []cid.Cid) ([]iface.IPFSLogEntry, *FetchReport) {
 	if f.timeout > 0 {
 		var cancel context.CancelFunc
 		ctx, cancel = context.WithTimeout(ctx, f.timeout)
 		defer cancel()
 	}
 
-	return f.processQueue(ctx, hashes)
+	entries, report := f.processQueue(ctx, hashes)
+	if f.report != nil {
+		*f.report = *report
+	}
+
+	return entries, report
 }
 
-func (f *Fetcher) processQueue(ctx context.Context, hashes []cid.Cid) []iface.IPFSLogEntry {
+func (f *Fetcher) processQueue(ctx context.Context, hashes []cid.Cid) ([]iface.IPFSLogEntry, *FetchReport) {
 	results := []iface.IPFSLogEntry{}
 	queue := newProcessQueue()
 
 	f.muProcess.Lock()
+	f.failed = map[cid.Cid]error{}
+	f.excluded = map[cid.Cid]struct{}{}
+	f.truncated = map[cid.Cid]struct{}{}
+	f.rejected = map[cid.Cid]error{}
+	f.checkpointErr = nil
+	f.pending = map[cid.Cid]*pendingEntry{}
+	f.waiters = map[cid.Cid][]*pendingEntry{}
+
+	f.muAccepted.Lock()
+	f.accepted = nil
+	f.acceptedIndex = map[cid.Cid]iface.IPFSLogEntry{}
+	f.heads = hashes
+	f.views = map[string]*fetchCanAppendContext{}
+	f.muAccepted.Unlock()
+
+	if f.checkpoint != nil {
+		results = f.restore(ctx, queue)
+	}
+
 	f.addHashesToQueue(queue, hashes...)
 	taskInProgress := 0
 	for queue.Len() > 0 {
 		// acquire a process slot limited by concurrency limit
 		if err := f.acquireProcessSlot(ctx); err != nil {
-			// @FIXME(gfanton): log this
-			// fmt.Printf("error while process next: %s\n", err.Error())
+			// the remaining entries won't be fetched
+			for queue.Len() > 0 {
+				f.failed[queue.Next()] = err
+			}
 			break
 		}
 
@@ -117,18 +228,37 @@ func (f *Fetcher) processQueue(ctx context.Context, hashes []cid.Cid) []iface.IP
 
 		// run process
 		go func(hash cid.Cid) {
-			entry, _ := f.fetchEntry(ctx, hash)
-			// if err != nil {
-			// @FIXME(gfanton): log this
-			// fmt.Printf("unable to fetch entry: %s\n", err.Error())
-			// }
+			entry, err := f.fetchEntry(ctx, hash)
+			bounded := entry != nil && f.isBeyondBounds(ctx, entry)
+
+			var rejection error
+			if entry != nil && !bounded {
+				rejection = f.verifyEntry(ctx, entry)
+			}
 
 			// free process slot
 			f.processDone()
 
 			f.muProcess.Lock()
 
-			if entry != nil {
+			var ready []*pendingEntry
+
+			if err != nil {
+				f.failed[hash] = err
+				ready = f.decided(hash)
+			}
+
+			if bounded {
+				// neither kept nor traversed
+				f.tasksCache[hash] = taskKindDone
+				f.saveDone(hash, checkpointDone{Kind: checkpointSkipped})
+				ready = f.decided(hash)
+			} else if rejection != nil {
+				// its ancestors are not traversed either
+				f.tasksCache[hash] = taskKindDone
+				f.reject(hash, rejection)
+				ready = f.decided(hash)
+			} else if entry != nil {
 				entryHash := entry.GetHash()
 				var lastEntry iface.IPFSLogEntry
 				if len(results) > 0 {
@@ -143,21 +273,55 @@ func (f *Fetcher) processQueue(ctx context.Context, hashes []cid.Cid) []iface.IP
 				if cache == taskKindAdded || cache == taskKindInProgress {
 					ts := entry.GetClock().GetTime()
 					isLater := len(results) >= f.length && ts >= f.minClock
+					done := checkpointDone{Kind: checkpointSkipped}
 					if f.length < 0 || len(results) < f.length || isLater {
+						done = checkpointDone{Kind: checkpointResult, Seq: len(results)}
 						results = append(results, entry)
-						// signal progress
-						if f.progressChan != nil {
+						// signal progress, once accepted by the access
+						// controller if any
+						if f.progressChan != nil && f.accessController == nil {
 							f.progressChan <- entry
 						}
+					} else {
+						f.truncate(entryHash)
 					}
 
 					f.tasksCache[entryHash] = taskKindDone
 
 					// add next elems to queue
 					f.addNextEntry(ctx, queue, entry, results)
+
+					// once its next elems are pending
+					f.saveDone(entryHash, done)
+
+					if f.accessController != nil && done.Kind == checkpointResult {
+						ready = f.await(entry)
+					} else {
+						ready = f.decided(entryHash)
+					}
 				}
 			}
 
+			// check the entries whose Next entries are all decided, deciding
+			// them can make others ready
+			for len(ready) > 0 {
+				f.muProcess.Unlock()
+
+				errs := make([]error, len(ready))
+				for i, p := range ready {
+					errs[i] = f.checkEntryAccess(ctx, p.entry)
+				}
+
+				f.muProcess.Lock()
+
+				var next []*pendingEntry
+				for i, p := range ready {
+					next = append(next, f.decide(p, errs[i])...)
+				}
+
+				ready = next
+			}
+
 			// mark this process as done
 			taskInProgress--
 
@@ -181,9 +345,42 @@ func (f *Fetcher) processQueue(ctx context.Context, hashes []cid.Cid) []iface.IP
 		f.condProcess.Wait()
 	}
 
+	if f.checkpoint != nil && len(f.failed) == 0 {
+		f.saveCheckpoint(f.checkpoint.clear())
+	}
+
+	if f.accessController != nil {
+		results = f.checkRemaining(ctx, results)
+	}
+
+	report := f.buildReport(results)
+
 	f.muProcess.Unlock()
 
-	return results
+	return results, report
+}
+
+func (f *Fetcher) buildReport(results []iface.IPFSLogEntry) *FetchReport {
+	// f.muProcess must be Locked
+
+	report := &FetchReport{Failed: f.failed, Rejected: f.rejected, Checkpoint: f.checkpointErr}
+
+	loaded := make(map[cid.Cid]struct{}, len(results))
+	for _, e := range results {
+		loaded[e.GetHash()] = struct{}{}
+	}
+
+	for c := range f.excluded {
+		report.Excluded = append(report.Excluded, c)
+	}
+
+	for c := range f.truncated {
+		if _, ok := loaded[c]; !ok {
+			report.Truncated = append(report.Truncated, c)
+		}
+	}
+
+	return report
 }
 
 func (f *Fetcher) updateClock(_ context.Context, entry, lastEntry iface.IPFSLogEntry) {
@@ -207,6 +404,284 @@ func (f *Fetcher) updateClock(_ context.Context, entry, lastEntry iface.IPFSLogE
 	f.muClock.Unlock()
 }
 
+// isBeyondBounds returns true if the entry is older than the requested clock
+// time or already known by the caller.
+func (f *Fetcher) isBeyondBounds(ctx context.Context, entry iface.IPFSLogEntry) bool {
+	if f.sinceClockTime > 0 && entry.GetClock().GetTime() <= f.sinceClockTime {
+		return true
+	}
+
+	return f.frontier != nil && f.frontier.contains(ctx, entry)
+}
+
+// verifyEntry checks the signature of the entry if requested, and checks it
+// with the access controller from what is known before traversing its
+// ancestors.
+func (f *Fetcher) verifyEntry(ctx context.Context, entry iface.IPFSLogEntry) error {
+	if f.verifySignatures {
+		if f.provider == nil {
+			return errmsg.ErrIdentityProviderNotDefined
+		}
+
+		if err := entry.Verify(f.provider, f.io); err != nil {
+			return errmsg.ErrSigNotVerified.Wrap(err)
+		}
+	}
+
+	if f.accessController != nil {
+		// the entry is checked again once its ancestors are known
+		if err := f.checkEntryAccess(ctx, entry); err != nil && !errors.Is(err, errmsg.ErrLogAncestorsNotKnown) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (f *Fetcher) checkEntryAccess(ctx context.Context, e iface.IPFSLogEntry) error {
+	if err := f.accessController.CanAppendV2(ctx, e, f.provider, f.view(e.GetLogID())); err != nil {
+		return errmsg.ErrLogAppendDenied.Wrap(err)
+	}
+
+	return nil
+}
+
+// view returns the view of a log given to the access controller, the same
+// one during a fetch.
+func (f *Fetcher) view(logID string) *fetchCanAppendContext {
+	f.muAccepted.Lock()
+	defer f.muAccepted.Unlock()
+
+	v, ok := f.views[logID]
+	if !ok {
+		v = &fetchCanAppendContext{fetcher: f, logID: logID}
+		f.views[logID] = v
+	}
+
+	return v
+}
+
+// await registers an entry to be checked by the access controller once its
+// Next entries are decided, it returns the entries ready to be checked.
+func (f *Fetcher) await(e iface.IPFSLogEntry) []*pendingEntry {
+	// f.muProcess must be Locked
+
+	p := &pendingEntry{entry: e, hash: e.GetHash()}
+	f.pending[p.hash] = p
+
+	for _, n := range e.GetNext() {
+		if err, ok := f.rejected[n]; ok {
+			f.reject(p.hash, followsRejected(n, err))
+			return f.decided(p.hash)
+		}
+
+		if f.undecided(n) {
+			f.waiters[n] = append(f.waiters[n], p)
+			p.waiting++
+		}
+	}
+
+	if p.waiting > 0 {
+		return nil
+	}
+
+	return []*pendingEntry{p}
+}
+
+// decide accepts or rejects a checked entry, it returns the entries ready to
+// be checked.
+func (f *Fetcher) decide(p *pendingEntry, err error) []*pendingEntry {
+	// f.muProcess must be Locked
+
+	if err != nil {
+		f.reject(p.hash, err)
+		return f.decided(p.hash)
+	}
+
+	f.accept(p)
+
+	return f.decided(p.hash)
+}
+
+// decided releases the entries waiting for an entry, the ones following a
+// rejected entry are rejected as well. It returns the entries ready to be
+// checked.
+func (f *Fetcher) decided(hash cid.Cid) (ready []*pendingEntry) {
+	// f.muProcess must be Locked
+
+	hashes := []cid.Cid{hash}
+	for len(hashes) > 0 {
+		h := hashes[0]
+		hashes = hashes[1:]
+
+		rejection, rejected := f.rejected[h]
+		for _, p := range f.waiters[h] {
+			if _, ok := f.pending[p.hash]; !ok {
+				continue
+			}
+
+			if rejected {
+				f.reject(p.hash, followsRejected(h, rejection))
+				hashes = append(hashes, p.hash)
+				continue
+			}
+
+			if p.waiting--; p.waiting == 0 {
+				ready = append(ready, p)
+			}
+		}
+
+		delete(f.waiters, h)
+	}
+
+	return ready
+}
+
+// undecided returns true if an entry is being fetched or checked.
+func (f *Fetcher) undecided(hash cid.Cid) bool {
+	// f.muProcess must be Locked
+
+	if _, ok := f.pending[hash]; ok {
+		return true
+	}
+
+	if _, ok := f.failed[hash]; ok {
+		return false
+	}
+
+	kind, ok := f.tasksCache[hash]
+
+	return ok && kind != taskKindDone
+}
+
+func (f *Fetcher) accept(p *pendingEntry) {
+	// f.muProcess must be Locked
+
+	delete(f.pending, p.hash)
+
+	f.muAccepted.Lock()
+	f.accepted = append(f.accepted, p.entry)
+	f.acceptedIndex[p.hash] = p.entry
+	f.muAccepted.Unlock()
+
+	if f.progressChan != nil {
+		f.progressChan <- p.entry
+	}
+}
+
+func (f *Fetcher) reject(hash cid.Cid, err error) {
+	// f.muProcess must be Locked
+
+	delete(f.pending, hash)
+	f.rejected[hash] = err
+	f.saveDone(hash, checkpointDone{Kind: checkpointRejected, Err: err.Error()})
+}
+
+func followsRejected(hash cid.Cid, err error) error {
+	return errmsg.ErrLogAppendDenied.Wrap(fmt.Errorf("follows rejected entry %s: %w", hash, err))
+}
+
+// checkRemaining checks the entries still pending once the fetch is over, in
+// clock order, as some of their Next entries could not be decided during the
+// fetch. It returns the results without the rejected entries.
+func (f *Fetcher) checkRemaining(ctx context.Context, results []iface.IPFSLogEntry) []iface.IPFSLogEntry {
+	// f.muProcess must be Locked
+
+	remaining := make([]*pendingEntry, 0, len(f.pending))
+	for _, p := range f.pending {
+		remaining = append(remaining, p)
+	}
+
+	sort.SliceStable(remaining, func(i, j int) bool {
+		return remaining[i].entry.GetClock().GetTime() < remaining[j].entry.GetClock().GetTime()
+	})
+
+	for _, p := range remaining {
+		if _, ok := f.pending[p.hash]; !ok {
+			continue
+		}
+
+		err := f.checkEntryAccess(ctx, p.entry)
+		for _, n := range p.entry.GetNext() {
+			if rejection, ok := f.rejected[n]; ok {
+				err = followsRejected(n, rejection)
+			}
+		}
+
+		f.decide(p, err)
+	}
+
+	f.waiters = map[cid.Cid][]*pendingEntry{}
+
+	kept := make([]iface.IPFSLogEntry, 0, len(results))
+	for _, e := range results {
+		if _, ok := f.rejected[e.GetHash()]; !ok {
+			kept = append(kept, e)
+		}
+	}
+
+	return kept
+}
+
+// fetchCanAppendContext gives the entries accepted so far by the fetch to the
+// access controller, which include the known ancestors of the checked entry.
+type fetchCanAppendContext struct {
+	fetcher *Fetcher
+	logID   string
+}
+
+func (c *fetchCanAppendContext) GetLogEntries() []accesscontroller.LogEntry {
+	c.fetcher.muAccepted.RLock()
+	defer c.fetcher.muAccepted.RUnlock()
+
+	entries := make([]accesscontroller.LogEntry, len(c.fetcher.accepted))
+	for i := range c.fetcher.accepted {
+		entries[i] = c.fetcher.accepted[i]
+	}
+
+	return entries
+}
+
+// GetLogID returns the log ID of the checked entry.
+func (c *fetchCanAppendContext) GetLogID() string {
+	return c.logID
+}
+
+// GetEntry returns an entry accepted by the fetch.
+func (c *fetchCanAppendContext) GetEntry(h cid.Cid) (accesscontroller.CausalLogEntry, bool) {
+	c.fetcher.muAccepted.RLock()
+	defer c.fetcher.muAccepted.RUnlock()
+
+	e, ok := c.fetcher.acceptedIndex[h]
+	if !ok {
+		return nil, false
+	}
+
+	return e, true
+}
+
+// GetAncestors returns the accepted entries preceding an entry.
+func (c *fetchCanAppendContext) GetAncestors(ctx context.Context, e accesscontroller.CausalLogEntry) ([]accesscontroller.CausalLogEntry, error) {
+	return accesscontroller.CollectAncestors(ctx, c.GetEntry, e)
+}
+
+// GetHeads returns the accepted entries among the fetched ones.
+func (c *fetchCanAppendContext) GetHeads() []accesscontroller.CausalLogEntry {
+	c.fetcher.muAccepted.RLock()
+	defer c.fetcher.muAccepted.RUnlock()
+
+	var heads []accesscontroller.CausalLogEntry
+	for _, h := range c.fetcher.heads {
+		if e, ok := c.fetcher.acceptedIndex[h]; ok {
+			heads = append(heads, e)
+		}
+	}
+
+	return heads
+}
+
+var _ accesscontroller.LogView = &fetchCanAppendContext{}
+
 func (f *Fetcher) exclude(hash cid.Cid) (yes bool) {
 	if yes = !hash.Defined(); yes {
 		return
@@ -217,8 +692,19 @@ func (f *Fetcher) exclude(hash cid.Cid) (yes bool) {
 		return
 	}
 
+	// is it already known by the caller ?
+	if yes = f.frontier != nil && f.frontier.knows(hash); yes {
+		return
+	}
+
 	// should the caller want it ?
-	yes = f.shouldExclude(hash)
+	if yes = f.shouldExclude(hash); yes && f.excluded != nil {
+		f.excluded[hash] = struct{}{}
+
+		if f.checkpoint != nil {
+			f.saveCheckpoint(f.checkpoint.mark(checkpointExcludedPrefix, hash))
+		}
+	}
 	return
 }
 
@@ -239,17 +725,148 @@ func (f *Fetcher) addNextEntry(_ context.Context, queue processQueue, entry ifac
 		for _, h := range entry.GetNext() {
 			f.addHashToQueue(queue, f.maxClock-ts, h)
 		}
+	} else {
+		f.markTruncated(entry.GetNext()...)
 	}
 	if len(results)+len(entry.GetRefs()) <= f.length {
 		for i, h := range entry.GetRefs() {
 			f.addHashToQueue(queue, f.maxClock-ts+((i+1)*i), h)
 		}
+	} else {
+		f.markTruncated(entry.GetRefs()...)
 	}
 }
 
+func (f *Fetcher) markTruncated(hashes ...cid.Cid) {
+	for _, h := range hashes {
+		if !f.exclude(h) {
+			f.truncate(h)
+		}
+	}
+}
+
+func (f *Fetcher) truncate(hash cid.Cid) {
+	f.truncated[hash] = struct{}{}
+
+	if f.checkpoint != nil {
+		f.saveCheckpoint(f.checkpoint.mark(checkpointTruncatedPrefix, hash))
+	}
+}
+
+// saveDone moves an entry out of the pending frontier of the checkpoint.
+func (f *Fetcher) saveDone(hash cid.Cid, done checkpointDone) {
+	if f.checkpoint == nil {
+		return
+	}
+
+	f.muClock.Lock()
+	clock := checkpointClock{Min: f.minClock, Max: f.maxClock}
+	f.muClock.Unlock()
+
+	f.saveCheckpoint(f.checkpoint.done(hash, done, clock))
+}
+
+// saveCheckpoint keeps the first error met while saving the checkpoint, the
+// fetch goes on without it.
+func (f *Fetcher) saveCheckpoint(err error) {
+	if err != nil && f.checkpointErr == nil {
+		f.checkpointErr = err
+	}
+}
+
+// restore resumes the fetch saved in the checkpoint, the entries already
+// loaded are read again from the storage.
+func (f *Fetcher) restore(ctx context.Context, queue processQueue) []iface.IPFSLogEntry {
+	// f.muProcess must be Locked
+
+	results := []iface.IPFSLogEntry{}
+
+	state, err := f.checkpoint.load(ctx)
+	if err != nil {
+		f.saveCheckpoint(err)
+		return results
+	}
+
+	f.muClock.Lock()
+	f.minClock, f.maxClock = state.clock.Min, state.clock.Max
+	f.muClock.Unlock()
+
+	for hash, done := range state.done {
+		f.tasksCache[hash] = taskKindDone
+
+		if done.Kind == checkpointRejected {
+			f.rejected[hash] = errors.New(done.Err)
+		}
+	}
+
+	for _, hash := range state.results() {
+		e, err := f.fetchEntry(ctx, hash)
+		if err != nil {
+			// it is fetched again along with the pending ones
+			delete(f.tasksCache, hash)
+			state.pending[hash] = 0
+			continue
+		}
+
+		results = append(results, e)
+
+		// checked again once the fetch is over
+		if f.accessController != nil {
+			f.pending[hash] = &pendingEntry{entry: e, hash: hash, waiting: -1}
+		}
+	}
+
+	for _, hash := range state.excluded {
+		f.excluded[hash] = struct{}{}
+	}
+
+	for _, hash := range state.truncated {
+		f.truncated[hash] = struct{}{}
+	}
+
+	for hash, index := range state.pending {
+		f.addHashToQueue(queue, index, hash)
+	}
+
+	return results
+}
+
 func (f *Fetcher) fetchEntry(ctx context.Context, hash cid.Cid) (entry iface.IPFSLogEntry, err error) {
 	// Load the entry
-	return FromMultihashWithIO(ctx, f.ipfs, hash, f.provider, f.io)
+	result, err := f.readWithRetry(ctx, hash)
+	if err != nil {
+		return nil, errmsg.ErrIPFSReadFailed.Wrap(err)
+	}
+
+	decoded, err := f.io.DecodeRawEntry(result, hash, f.provider)
+	if err != nil {
+		return nil, errmsg.ErrIPFSReadUnmarshalFailed.Wrap(err)
+	}
+
+	return decoded, nil
+}
+
+// readWithRetry reads a block, retrying with an exponential backoff.
+func (f *Fetcher) readWithRetry(ctx context.Context, hash cid.Cid) (format.Node, error) {
+	backoff := f.retryBackoff
+
+	for attempt := 0; ; attempt++ {
+		result, err := f.io.Read(ctx, f.storage, hash)
+		if err == nil || attempt >= f.retries || ctx.Err() != nil {
+			return result, err
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return nil, err
+		}
+
+		backoff *= 2
+		if f.maxRetryBackoff > 0 && backoff > f.maxRetryBackoff {
+			backoff = f.maxRetryBackoff
+		}
+	}
 }
 
 func (f *Fetcher) addHashesToQueue(queue processQueue, hashes ...cid.Cid) (added int) {
@@ -268,6 +885,10 @@ func (f *Fetcher) addHashToQueue(queue processQueue, index int, hash cid.Cid) (a
 	queue.Add(index, hash)
 	f.tasksCache[hash] = taskKindAdded
 
+	if f.checkpoint != nil {
+		f.saveCheckpoint(f.checkpoint.queue(hash, index))
+	}
+
 	return 1
 
 }
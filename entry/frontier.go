@@ -0,0 +1,138 @@
+package entry
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+
+	"berty.tech/go-ipfs-log/iface"
+	"github.com/ipfs/go-cid"
+)
+
+// frontier holds the entries already known by the caller of a fetch, which
+// are the given heads and every entry reachable from them.
+//
+// The ancestors of the heads are walked lazily, only down to the clock time
+// of the entries being checked, so a client reconnecting after a short
+// absence doesn't walk its whole log. Refs of the walked entries are known
+// without being loaded, which lets the fetcher skip them right away.
+type frontier struct {
+	fetcher *Fetcher
+
+	muKnown sync.RWMutex
+	known   map[cid.Cid]struct{}
+
+	// the walk is guarded by lock
+	lock     sync.Mutex
+	roots    []cid.Cid
+	expanded map[cid.Cid]struct{}
+	pending  frontierQueue
+}
+
+func newFrontier(fetcher *Fetcher, heads []cid.Cid) *frontier {
+	f := &frontier{
+		fetcher:  fetcher,
+		known:    map[cid.Cid]struct{}{},
+		expanded: map[cid.Cid]struct{}{},
+		roots:    heads,
+	}
+
+	for _, h := range heads {
+		f.known[h] = struct{}{}
+		f.expanded[h] = struct{}{}
+	}
+
+	return f
+}
+
+// knows returns true if the hash is already known, without walking.
+func (f *frontier) knows(hash cid.Cid) bool {
+	f.muKnown.RLock()
+	defer f.muKnown.RUnlock()
+
+	_, ok := f.known[hash]
+
+	return ok
+}
+
+func (f *frontier) markKnown(hashes ...cid.Cid) {
+	f.muKnown.Lock()
+	defer f.muKnown.Unlock()
+
+	for _, h := range hashes {
+		f.known[h] = struct{}{}
+	}
+}
+
+// contains returns true if the entry is reachable from the heads.
+func (f *frontier) contains(ctx context.Context, e iface.IPFSLogEntry) bool {
+	if f.knows(e.GetHash()) {
+		return true
+	}
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	for _, h := range f.roots {
+		f.push(ctx, h)
+	}
+	f.roots = nil
+
+	// an ancestor always has a lower clock time than the entries referencing
+	// it, there is no need to walk past the clock time of the entry
+	ts := e.GetClock().GetTime()
+	for f.pending.Len() > 0 && f.pending[0].GetClock().GetTime() > ts {
+		current := heap.Pop(&f.pending).(iface.IPFSLogEntry)
+
+		f.markKnown(current.GetRefs()...)
+
+		for _, n := range current.GetNext() {
+			if _, ok := f.expanded[n]; ok {
+				continue
+			}
+
+			f.expanded[n] = struct{}{}
+			f.markKnown(n)
+			f.push(ctx, n)
+		}
+	}
+
+	return f.knows(e.GetHash())
+}
+
+func (f *frontier) push(ctx context.Context, hash cid.Cid) {
+	// f.lock must be Locked
+
+	e, err := f.fetcher.fetchEntry(ctx, hash)
+	if err != nil {
+		// the entry is known, only its ancestors can't be walked
+		return
+	}
+
+	heap.Push(&f.pending, e)
+}
+
+// frontierQueue pops the entries with the highest clock time first.
+type frontierQueue []iface.IPFSLogEntry
+
+func (q frontierQueue) Len() int { return len(q) }
+
+func (q frontierQueue) Less(i, j int) bool {
+	return q[i].GetClock().GetTime() > q[j].GetClock().GetTime()
+}
+
+func (q frontierQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *frontierQueue) Push(x interface{}) {
+	*q = append(*q, x.(iface.IPFSLogEntry))
+}
+
+func (q *frontierQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	e := old[n-1]
+	old[n-1] = nil // avoid memory leak
+	*q = old[0 : n-1]
+
+	return e
+}
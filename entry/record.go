@@ -0,0 +1,82 @@
+package entry // import "berty.tech/go-ipfs-log/entry"
+
+import (
+	"github.com/ipfs/go-cid"
+
+	"berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/iface"
+)
+
+// Record is a self-contained serializable representation of an entry,
+// including its hash, used to persist entries outside of IPFS. Next and Refs
+// keep empty lists apart from missing ones, as they are hashed differently.
+type Record struct {
+	Payload        []byte                     `json:"payload,omitempty"`
+	LogID          string                     `json:"id,omitempty"`
+	Next           []cid.Cid                  `json:"next"`
+	Refs           []cid.Cid                  `json:"refs"`
+	V              uint64                     `json:"v,omitempty"`
+	Key            []byte                     `json:"key,omitempty"`
+	Sig            []byte                     `json:"sig,omitempty"`
+	Identity       *identityprovider.Identity `json:"identity,omitempty"`
+	Hash           cid.Cid                    `json:"hash"`
+	ClockID        []byte                     `json:"clock_id,omitempty"`
+	ClockTime      int                        `json:"clock_time,omitempty"`
+	AdditionalData map[string]string          `json:"additional_data,omitempty"`
+}
+
+// ToRecord converts an entry to a Record.
+func ToRecord(e iface.IPFSLogEntry) *Record {
+	r := &Record{
+		Payload:        e.GetPayload(),
+		LogID:          e.GetLogID(),
+		Next:           e.GetNext(),
+		Refs:           e.GetRefs(),
+		V:              e.GetV(),
+		Key:            e.GetKey(),
+		Sig:            e.GetSig(),
+		Hash:           e.GetHash(),
+		AdditionalData: e.GetAdditionalData(),
+	}
+
+	if identity := e.GetIdentity(); identity != nil {
+		r.Identity = identity.Filtered()
+	}
+
+	if clock := e.GetClock(); clock != nil {
+		r.ClockID = clock.GetID()
+		r.ClockTime = clock.GetTime()
+	}
+
+	return r
+}
+
+// ToEntry converts a Record to an entry of the same type as refEntry.
+func (r *Record) ToEntry(refEntry iface.IPFSLogEntry, refClock iface.IPFSLogLamportClock, provider identityprovider.Interface) iface.IPFSLogEntry {
+	clock := refClock.New()
+	clock.SetID(r.ClockID)
+	clock.SetTime(r.ClockTime)
+
+	e := refEntry.New()
+	e.SetPayload(r.Payload)
+	e.SetLogID(r.LogID)
+	e.SetNext(r.Next)
+	e.SetRefs(r.Refs)
+	e.SetV(r.V)
+	e.SetKey(r.Key)
+	e.SetSig(r.Sig)
+	e.SetHash(r.Hash)
+	e.SetClock(clock)
+
+	if r.Identity != nil {
+		identity := r.Identity.Filtered()
+		identity.Provider = provider
+		e.SetIdentity(identity)
+	}
+
+	for k, v := range r.AdditionalData {
+		e.SetAdditionalDataValue(k, v)
+	}
+
+	return e
+}
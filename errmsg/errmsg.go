@@ -75,4 +75,44 @@ const (
 	ErrPBReadUnmarshalFailed        = Error("protobuf unmarshal failed")
 	ErrEncrypt                      = Error("encryption error")
 	ErrDecrypt                      = Error("decryption error")
+	ErrSyncExchangeFailed           = Error("heads exchange failed")
+	ErrSyncLogNotRegistered         = Error("log is not registered for sync")
+	ErrSyncIncomplete               = Error("missing entries could not be fetched")
+	ErrIndexNotDefined              = Error("index datastore not defined")
+	ErrIndexOperationFailed         = Error("index operation failed")
+	ErrLogFromSnapshot              = Error("new from snapshot failed")
+	ErrLogIDMismatch                = Error("entry does not belong to the log")
+	ErrSnapshotNotDefined           = Error("snapshot not defined")
+	ErrSnapshotReadFailed           = Error("snapshot read failed")
+	ErrSnapshotWriteFailed          = Error("snapshot write failed")
+	ErrSnapshotVersionNotSupported  = Error("snapshot version is not supported")
+	ErrLogNotDefined                = Error("log not defined")
+	ErrCARExportFailed              = Error("CAR export failed")
+	ErrCARImportFailed              = Error("CAR import failed")
+	ErrCARMissingBlock              = Error("block is missing from the CAR")
+	ErrCursorTokenInvalid           = Error("invalid cursor token")
+	ErrTailEntryNotFound            = Error("entry to tail from not found")
+	ErrCheckpointOperationFailed    = Error("fetch checkpoint operation failed")
+	ErrKeyTypeNotSupported          = Error("key type is not supported")
+	ErrKeystoreLocked               = Error("keystore is locked")
+	ErrKeystorePassphraseInvalid    = Error("invalid keystore passphrase")
+	ErrKeyStoreDeleteFailed         = Error("keystore delete failed")
+	ErrKeyExportInvalid             = Error("invalid exported key")
+	ErrKeyRotationNotSupported      = Error("keystore doesn't support key rotation")
+	ErrKeyRotationInvalid           = Error("invalid key rotation")
+	ErrIdentityKeyMismatch          = Error("entry key doesn't match its identity")
+	ErrDIDKeyInvalid                = Error("invalid did:key")
+	ErrManifestInvalid              = Error("invalid access controller manifest")
+	ErrCapabilityInvalid            = Error("invalid capability")
+	ErrQuotaExceeded                = Error("quota exceeded")
+	ErrDelegationInvalid            = Error("invalid delegation")
+	ErrDelegationExpired            = Error("delegation expired")
+	ErrLogHeadsNotLoaded            = Error("log heads could not be loaded")
+	ErrJoinSizeWithIndex            = Error("join size is not supported by indexed logs")
+	ErrEntryHashMismatch            = Error("entry hash doesn't match its content")
+	ErrCursorTokenNotFound          = Error("cursor token entry not found")
+	ErrLogAncestorsNotKnown         = Error("entry ancestors are not known")
+	ErrDelegationBackdated          = Error("entry time precedes the entries it follows")
+	ErrKDFParamsInvalid             = Error("invalid key derivation parameters")
+	ErrLogJoinIDMismatch            = Error("log to join has another ID")
 )
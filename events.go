@@ -0,0 +1,123 @@
+package ipfslog // import "berty.tech/go-ipfs-log"
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"berty.tech/go-ipfs-log/iface"
+)
+
+// defaultEventBufferSize is the number of events a subscriber can lag behind
+// before events are dropped.
+const defaultEventBufferSize = 64
+
+// Event is an event emitted by a log, one of EventAppended, EventJoined,
+// EventHeadsReplaced or EventJoinRejected.
+type Event interface {
+	isLogEvent()
+}
+
+// EventAppended is emitted when an entry has been appended locally.
+type EventAppended struct {
+	Entry iface.IPFSLogEntry
+}
+
+// EventJoined is emitted when a join has added entries to the log.
+type EventJoined struct {
+	Entries []iface.IPFSLogEntry
+}
+
+// EventHeadsReplaced is emitted when the heads of the log have changed.
+type EventHeadsReplaced struct {
+	Heads []iface.IPFSLogEntry
+}
+
+// EventJoinRejected is emitted when the access controller refused an entry
+// during a join.
+type EventJoinRejected struct {
+	Entry iface.IPFSLogEntry
+	Err   error
+}
+
+func (EventAppended) isLogEvent()      {}
+func (EventJoined) isLogEvent()        {}
+func (EventHeadsReplaced) isLogEvent() {}
+func (EventJoinRejected) isLogEvent()  {}
+
+type SubscribeOptions struct {
+	// BufferSize is the number of events kept for a lagging subscriber,
+	// defaults to 64.
+	BufferSize int
+}
+
+// Subscription receives the events of a log until its context is done.
+//
+// Events are never waited on, when the buffer is full new events are
+// dropped and counted.
+type Subscription struct {
+	out     chan Event
+	dropped uint64
+}
+
+// Out returns the channel of events, closed when the subscription ends.
+func (s *Subscription) Out() <-chan Event {
+	return s.out
+}
+
+// Dropped returns the number of events dropped because the subscriber was
+// lagging.
+func (s *Subscription) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+type eventBus struct {
+	lock sync.RWMutex
+	subs map[*Subscription]struct{}
+}
+
+func (b *eventBus) subscribe(ctx context.Context, options *SubscribeOptions) *Subscription {
+	size := defaultEventBufferSize
+	if options != nil && options.BufferSize > 0 {
+		size = options.BufferSize
+	}
+
+	sub := &Subscription{out: make(chan Event, size)}
+
+	b.lock.Lock()
+	if b.subs == nil {
+		b.subs = map[*Subscription]struct{}{}
+	}
+	b.subs[sub] = struct{}{}
+	b.lock.Unlock()
+
+	go func() {
+		<-ctx.Done()
+
+		b.lock.Lock()
+		delete(b.subs, sub)
+		close(sub.out)
+		b.lock.Unlock()
+	}()
+
+	return sub
+}
+
+func (b *eventBus) emit(evt Event) {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
+	for sub := range b.subs {
+		select {
+		case sub.out <- evt:
+		default:
+			atomic.AddUint64(&sub.dropped, 1)
+		}
+	}
+}
+
+// Subscribe returns a subscription to the events of the log, it is closed
+// when ctx is done.
+func (l *IPFSLog) Subscribe(ctx context.Context, options *SubscribeOptions) *Subscription {
+	return l.events.subscribe(ctx, options)
+}
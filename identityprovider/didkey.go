@@ -0,0 +1,232 @@
+package identityprovider // import "berty.tech/go-ipfs-log/identityprovider"
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"strings"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/multiformats/go-multibase"
+
+	"berty.tech/go-ipfs-log/errmsg"
+	"berty.tech/go-ipfs-log/keystore"
+)
+
+const didKeyPrefix = "did:key:"
+
+// multicodec prefixes of the public keys, as unsigned varints.
+var (
+	didKeyEd25519Codec   = []byte{0xed, 0x01}
+	didKeySecp256k1Codec = []byte{0xe7, 0x01}
+)
+
+// DIDKeyIdentityProvider is an identity provider whose identity IDs are
+// did:key DIDs of the signing key, identities are self-certifying.
+//
+// It must be registered using AddIdentityProvider.
+type DIDKeyIdentityProvider struct {
+	keystore keystore.Interface
+}
+
+// NewDIDKeyIdentityProvider creates a new did:key identity provider.
+func NewDIDKeyIdentityProvider(options *CreateIdentityOptions) Interface {
+	if options == nil {
+		return &DIDKeyIdentityProvider{}
+	}
+
+	return &DIDKeyIdentityProvider{
+		keystore: options.Keystore,
+	}
+}
+
+// DIDKeyFromPublicKey returns the did:key DID of an Ed25519 or Secp256k1
+// public key.
+func DIDKeyFromPublicKey(pubKey crypto.PubKey) (string, error) {
+	var codec []byte
+
+	switch pubKey.Type() {
+	case crypto.Ed25519:
+		codec = didKeyEd25519Codec
+	case crypto.Secp256k1:
+		codec = didKeySecp256k1Codec
+	default:
+		return "", errmsg.ErrKeyTypeNotSupported
+	}
+
+	raw, err := pubKey.Raw()
+	if err != nil {
+		return "", errmsg.ErrPubKeySerialization.Wrap(err)
+	}
+
+	encoded, err := multibase.Encode(multibase.Base58BTC, append(append([]byte(nil), codec...), raw...))
+	if err != nil {
+		return "", errmsg.ErrPubKeySerialization.Wrap(err)
+	}
+
+	return didKeyPrefix + encoded, nil
+}
+
+// PublicKeyFromDIDKey returns the public key of a did:key DID.
+func PublicKeyFromDIDKey(did string) (crypto.PubKey, error) {
+	if !strings.HasPrefix(did, didKeyPrefix) {
+		return nil, errmsg.ErrDIDKeyInvalid
+	}
+
+	encoding, data, err := multibase.Decode(strings.TrimPrefix(did, didKeyPrefix))
+	if err != nil || encoding != multibase.Base58BTC {
+		return nil, errmsg.ErrDIDKeyInvalid
+	}
+
+	var pubKey crypto.PubKey
+
+	switch {
+	case bytes.HasPrefix(data, didKeyEd25519Codec):
+		pubKey, err = crypto.UnmarshalEd25519PublicKey(data[len(didKeyEd25519Codec):])
+	case bytes.HasPrefix(data, didKeySecp256k1Codec):
+		pubKey, err = crypto.UnmarshalSecp256k1PublicKey(data[len(didKeySecp256k1Codec):])
+	default:
+		return nil, errmsg.ErrKeyTypeNotSupported
+	}
+
+	if err != nil {
+		return nil, errmsg.ErrDIDKeyInvalid.Wrap(err)
+	}
+
+	return pubKey, nil
+}
+
+// GetID returns the did:key DID of the key of options.ID. The key is also
+// stored under the DID, it signs the entries of the identity.
+func (p *DIDKeyIdentityProvider) GetID(ctx context.Context, options *CreateIdentityOptions) (string, error) {
+	private, err := p.keystore.GetKey(ctx, options.ID)
+	if err != nil || private == nil {
+		private, err = createKey(ctx, p.keystore, options.ID, options.KeyType)
+		if err != nil {
+			return "", errmsg.ErrKeyStoreCreateEntry.Wrap(err)
+		}
+	}
+
+	did, err := DIDKeyFromPublicKey(private.GetPublic())
+	if err != nil {
+		return "", err
+	}
+
+	if stored, err := p.keystore.GetKey(ctx, did); err == nil && stored.Equals(private) {
+		return did, nil
+	}
+
+	typed, ok := p.keystore.(keystore.TypedInterface)
+	if !ok {
+		return "", errmsg.ErrKeyTypeNotSupported
+	}
+
+	if err := typed.PutKey(ctx, did, private); err != nil {
+		return "", errmsg.ErrKeyStoreCreateEntry.Wrap(err)
+	}
+
+	return did, nil
+}
+
+// resolveID returns the DID of an existing identity.
+func (p *DIDKeyIdentityProvider) resolveID(ctx context.Context, options *CreateIdentityOptions) (string, error) {
+	private, err := p.keystore.GetKey(ctx, options.ID)
+	if err != nil {
+		return "", errmsg.ErrKeyNotInKeystore.Wrap(err)
+	}
+
+	return DIDKeyFromPublicKey(private.GetPublic())
+}
+
+// rotatedKeyID returns options.ID, the DID of the identity is derived from
+// its key.
+func (p *DIDKeyIdentityProvider) rotatedKeyID(_ *Identity, options *CreateIdentityOptions) string {
+	return options.ID
+}
+
+// SignIdentity signs the public key of an identity with the key of its ID.
+func (p *DIDKeyIdentityProvider) SignIdentity(ctx context.Context, data []byte, id string) ([]byte, error) {
+	key, err := p.keystore.GetKey(ctx, id)
+	if err != nil {
+		return nil, errmsg.ErrKeyNotInKeystore
+	}
+
+	// signed as an hex string, as done by OrbitDB identities
+	signature, err := key.Sign([]byte(hex.EncodeToString(data)))
+	if err != nil {
+		return nil, errmsg.ErrSigSign.Wrap(err)
+	}
+
+	return signature, nil
+}
+
+// VerifyIdentity checks that the public key of the identity is the one of
+// its DID and that it has been signed by it.
+func (p *DIDKeyIdentityProvider) VerifyIdentity(identity *Identity) error {
+	if identity == nil {
+		return errmsg.ErrIdentityNotDefined
+	}
+
+	if identity.Signatures == nil {
+		return errmsg.ErrSigNotVerified
+	}
+
+	didKey, err := PublicKeyFromDIDKey(identity.ID)
+	if err != nil {
+		return err
+	}
+
+	pubKey, err := identity.GetPublicKey()
+	if err != nil {
+		return errmsg.ErrPubKeyDeserialization.Wrap(err)
+	}
+
+	if !didKey.Equals(pubKey) {
+		return errmsg.ErrIdentityKeyMismatch
+	}
+
+	data := []byte(hex.EncodeToString(append(append([]byte(nil), identity.PublicKey...), identity.Signatures.ID...)))
+
+	ok, err := didKey.Verify(data, identity.Signatures.PublicKey)
+	if err != nil {
+		return errmsg.ErrSigNotVerified.Wrap(err)
+	}
+
+	if !ok {
+		return errmsg.ErrSigNotVerified
+	}
+
+	return nil
+}
+
+// Sign signs a value with the key of the identity.
+func (p *DIDKeyIdentityProvider) Sign(ctx context.Context, identity *Identity, data []byte) ([]byte, error) {
+	key, err := p.keystore.GetKey(ctx, identity.ID)
+	if err != nil {
+		return nil, errmsg.ErrKeyNotInKeystore.Wrap(err)
+	}
+
+	sig, err := key.Sign(data)
+	if err != nil {
+		return nil, errmsg.ErrSigSign.Wrap(err)
+	}
+
+	return sig, nil
+}
+
+// UnmarshalPublicKey decodes a public key of any supported type.
+func (p *DIDKeyIdentityProvider) UnmarshalPublicKey(data []byte) (crypto.PubKey, error) {
+	pubKey, err := unmarshalPublicKey(data)
+	if err != nil {
+		return nil, errmsg.ErrInvalidPubKeyFormat
+	}
+
+	return pubKey, nil
+}
+
+// GetType returns the current identity type.
+func (*DIDKeyIdentityProvider) GetType() string {
+	return "did:key"
+}
+
+var _ Interface = &DIDKeyIdentityProvider{}
@@ -3,14 +3,29 @@ package identityprovider // import "berty.tech/go-ipfs-log/identityprovider"
 import (
 	"context"
 	"encoding/hex"
+	"strings"
 
 	"github.com/btcsuite/btcd/btcec"
+	lru "github.com/hashicorp/golang-lru"
 	"github.com/libp2p/go-libp2p/core/crypto"
 
 	"berty.tech/go-ipfs-log/errmsg"
 	"berty.tech/go-ipfs-log/keystore"
 )
 
+const verifiedIdentitiesCacheSize = 1000
+
+var verifiedIdentities = mustNewCache(verifiedIdentitiesCacheSize)
+
+func mustNewCache(size int) *lru.Cache {
+	cache, err := lru.New(size)
+	if err != nil {
+		panic(err)
+	}
+
+	return cache
+}
+
 var supportedTypes = map[string]func(*CreateIdentityOptions) Interface{
 	"orbitdb": NewOrbitDBIdentityProvider,
 }
@@ -91,22 +106,14 @@ func (i *Identities) CreateIdentity(ctx context.Context, options *CreateIdentity
 	//	}
 	//}
 
-	publicKey, idSignature, err := i.signID(ctx, id)
+	publicKey, idSignature, err := i.signID(ctx, id, options.KeyType)
 	if err != nil {
 		return nil, errmsg.ErrSigSign.Wrap(err)
 	}
 
-	publicKeyBytes, err := publicKey.Raw()
+	publicKeyBytes, err := marshalPublicKey(publicKey)
 	if err != nil {
-		return nil, errmsg.ErrNotSecp256k1PubKey.Wrap(err)
-	}
-
-	// JS version of IPFS Log expects an uncompressed Secp256k1 key
-	if publicKey.Type().String() == "Secp256k1" {
-		publicKeyBytes, err = compressedToUncompressedS256Key(publicKeyBytes)
-		if err != nil {
-			return nil, errmsg.ErrNotSecp256k1PubKey.Wrap(err)
-		}
+		return nil, errmsg.ErrPubKeySerialization.Wrap(err)
 	}
 
 	pubKeyIDSignature, err := identityProvider.SignIdentity(ctx, append(publicKeyBytes, idSignature...), options.ID)
@@ -126,10 +133,10 @@ func (i *Identities) CreateIdentity(ctx context.Context, options *CreateIdentity
 	}, nil
 }
 
-func (i *Identities) signID(ctx context.Context, id string) (crypto.PubKey, []byte, error) {
+func (i *Identities) signID(ctx context.Context, id string, keyType keystore.KeyType) (crypto.PubKey, []byte, error) {
 	privKey, err := i.keyStore.GetKey(ctx, id)
 	if err != nil {
-		privKey, err = i.keyStore.CreateKey(ctx, id)
+		privKey, err = createKey(ctx, i.keyStore, id, keyType)
 
 		if err != nil {
 			return nil, nil, errmsg.ErrSigSign.Wrap(err)
@@ -144,25 +151,55 @@ func (i *Identities) signID(ctx context.Context, id string) (crypto.PubKey, []by
 	return privKey.GetPublic(), idSignature, nil
 }
 
+// createKey creates a key of the given type, the default type is supported
+// by any keystore.
+func createKey(ctx context.Context, ks keystore.Interface, id string, keyType keystore.KeyType) (crypto.PrivKey, error) {
+	if keyType == keystore.KeyTypeDefault {
+		return ks.CreateKey(ctx, id)
+	}
+
+	typed, ok := ks.(keystore.TypedInterface)
+	if !ok {
+		return nil, errmsg.ErrKeyTypeNotSupported
+	}
+
+	return typed.CreateKeyWithType(ctx, id, keyType)
+}
+
 // VerifyIdentity checks an identity.
 func (i *Identities) VerifyIdentity(identity *Identity) error {
+	return VerifyIdentity(identity)
+}
+
+// VerifyIdentity checks that the public key of an identity signed its ID and
+// lets the provider of its type check the identity. Verified identities are
+// cached.
+func VerifyIdentity(identity *Identity) error {
+	if identity == nil {
+		return errmsg.ErrIdentityNotDefined
+	}
+
+	if identity.Signatures == nil {
+		return errmsg.ErrSigNotVerified
+	}
+
+	cacheKey := identityCacheKey(identity)
+	if _, ok := verifiedIdentities.Get(cacheKey); ok {
+		return nil
+	}
+
 	pubKey, err := identity.GetPublicKey()
 	if err != nil {
 		return errmsg.ErrPubKeyDeserialization.Wrap(err)
 	}
 
-	idBytes, err := hex.DecodeString(identity.ID)
+	ok, err := pubKey.Verify([]byte(identity.ID), identity.Signatures.ID)
 	if err != nil {
-		return errmsg.ErrIdentityDeserialization.Wrap(err)
+		return errmsg.ErrSigNotVerified.Wrap(err)
 	}
 
-	err = i.keyStore.Verify(
-		identity.Signatures.ID,
-		pubKey,
-		idBytes,
-	)
-	if err != nil {
-		return errmsg.ErrSigNotVerified.Wrap(err)
+	if !ok {
+		return errmsg.ErrSigNotVerified
 	}
 
 	identityProvider, err := getHandlerFor(identity.Type)
@@ -170,7 +207,25 @@ func (i *Identities) VerifyIdentity(identity *Identity) error {
 		return errmsg.ErrSigNotVerified.Wrap(err)
 	}
 
-	return identityProvider(nil).VerifyIdentity(identity)
+	if err := identityProvider(nil).VerifyIdentity(identity); err != nil {
+		return err
+	}
+
+	verifiedIdentities.Add(cacheKey, struct{}{})
+
+	return nil
+}
+
+// identityCacheKey returns a key covering all the verified fields of an
+// identity.
+func identityCacheKey(identity *Identity) string {
+	return strings.Join([]string{
+		identity.Type,
+		identity.ID,
+		hex.EncodeToString(identity.PublicKey),
+		hex.EncodeToString(identity.Signatures.ID),
+		hex.EncodeToString(identity.Signatures.PublicKey),
+	}, "/")
 }
 
 // CreateIdentity creates a new identity.
@@ -185,6 +240,88 @@ func CreateIdentity(ctx context.Context, options *CreateIdentityOptions) (*Ident
 	return identities.CreateIdentity(ctx, options)
 }
 
+// RotateIdentity replaces the signing key of an identity by a new key of
+// options.KeyType. The new identity keeps the same ID, entries signed with
+// the previous key remain valid as they embed the identity that signed them.
+//
+// The ID of a self-certifying identity, such as a did:key identity, is
+// derived from its signing key: the new identity gets the ID of the new key.
+func RotateIdentity(ctx context.Context, identity *Identity, options *CreateIdentityOptions) (*Identity, *keystore.KeyRotation, error) {
+	ks := options.Keystore
+	if ks == nil {
+		return nil, nil, errmsg.ErrKeystoreNotDefined
+	}
+
+	lifecycle, ok := ks.(keystore.LifecycleInterface)
+	if !ok {
+		return nil, nil, errmsg.ErrKeyRotationNotSupported
+	}
+
+	NewIdentityProvider, err := getHandlerFor(options.Type)
+	if err != nil {
+		return nil, nil, errmsg.ErrIdentityProviderNotSupported.Wrap(err)
+	}
+
+	identityProvider := NewIdentityProvider(options)
+
+	// the previous key is destroyed by the rotation, make sure the options
+	// describe the same identity first
+	id, err := resolveID(ctx, identityProvider, options)
+	if err != nil {
+		return nil, nil, errmsg.ErrIdentityUnknown.Wrap(err)
+	}
+
+	if id != identity.ID {
+		return nil, nil, errmsg.ErrKeyRotationInvalid
+	}
+
+	keyID := identity.ID
+	if rotator, ok := identityProvider.(keyRotator); ok {
+		keyID = rotator.rotatedKeyID(identity, options)
+	}
+
+	rotation, err := lifecycle.RotateKey(ctx, keyID, options.KeyType)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rotated, err := newIdentities(ks).CreateIdentity(ctx, options)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// the previous signing key is stored under the previous ID
+	if rotated.ID != identity.ID {
+		if err := lifecycle.DeleteKey(ctx, identity.ID); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return rotated, rotation, nil
+}
+
+// idResolver is implemented by the providers able to resolve the ID of an
+// identity without creating nor storing keys.
+type idResolver interface {
+	resolveID(ctx context.Context, options *CreateIdentityOptions) (string, error)
+}
+
+// keyRotator is implemented by the providers whose rotated key is not the
+// key of the identity ID.
+type keyRotator interface {
+	rotatedKeyID(identity *Identity, options *CreateIdentityOptions) string
+}
+
+// resolveID returns the ID of the identity described by options, GetID is
+// only called by providers without a side effect free resolution.
+func resolveID(ctx context.Context, identityProvider Interface, options *CreateIdentityOptions) (string, error) {
+	if resolver, ok := identityProvider.(idResolver); ok {
+		return resolver.resolveID(ctx, options)
+	}
+
+	return identityProvider.GetID(ctx, options)
+}
+
 // IsSupported checks if an identity type is supported.
 func IsSupported(typeName string) bool {
 	_, ok := supportedTypes[typeName]
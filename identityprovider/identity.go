@@ -30,5 +30,55 @@ func (i *Identity) Filtered() *Identity {
 
 // GetPublicKey returns the public key of an identity.
 func (i *Identity) GetPublicKey() (ic.PubKey, error) {
-	return ic.UnmarshalPublicKey(i.PublicKey)
+	return unmarshalPublicKey(i.PublicKey)
+}
+
+// MarshalPublicKey encodes a public key as the public key of an identity.
+func MarshalPublicKey(publicKey ic.PubKey) ([]byte, error) {
+	return marshalPublicKey(publicKey)
+}
+
+// UnmarshalPublicKey decodes the public key of an identity.
+func UnmarshalPublicKey(data []byte) (ic.PubKey, error) {
+	return unmarshalPublicKey(data)
+}
+
+// marshalPublicKey encodes the public key of an identity. Secp256k1 keys are
+// raw and uncompressed as expected by the JS version of IPFS Log, the other
+// types are encoded along with their libp2p type.
+func marshalPublicKey(publicKey ic.PubKey) ([]byte, error) {
+	if publicKey.Type() != ic.Secp256k1 {
+		return ic.MarshalPublicKey(publicKey)
+	}
+
+	publicKeyBytes, err := publicKey.Raw()
+	if err != nil {
+		return nil, err
+	}
+
+	return compressedToUncompressedS256Key(publicKeyBytes)
+}
+
+// unmarshalPublicKey decodes a public key encoded by marshalPublicKey.
+func unmarshalPublicKey(data []byte) (ic.PubKey, error) {
+	// an encoded key never starts like a raw Secp256k1 key
+	if pubKey, err := ic.UnmarshalSecp256k1PublicKey(data); err == nil {
+		return pubKey, nil
+	}
+
+	return ic.UnmarshalPublicKey(data)
+}
+
+// unmarshalRawPublicKey decodes a public key encoded without its type, such
+// as the key of the ID of an OrbitDB identity.
+func unmarshalRawPublicKey(data []byte) (ic.PubKey, error) {
+	if pubKey, err := ic.UnmarshalSecp256k1PublicKey(data); err == nil {
+		return pubKey, nil
+	}
+
+	if pubKey, err := ic.UnmarshalEd25519PublicKey(data); err == nil {
+		return pubKey, nil
+	}
+
+	return ic.UnmarshalECDSAPublicKey(data)
 }
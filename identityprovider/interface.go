@@ -13,6 +13,11 @@ type CreateIdentityOptions struct {
 	Keystore         keystore.Interface
 	//Migrate          func(*MigrateOptions) error
 	ID string
+
+	// KeyType is the type of the keys created for the identity, the
+	// keystore must implement keystore.TypedInterface for types other than
+	// the default one.
+	KeyType keystore.KeyType
 }
 
 type Interface interface {
@@ -14,13 +14,48 @@ type OrbitDBIdentityProvider struct {
 	keystore keystore.Interface
 }
 
-// VerifyIdentity checks an OrbitDB identity.
-func (p *OrbitDBIdentityProvider) VerifyIdentity(_ *Identity) error {
+// VerifyIdentity checks that the key of the ID of an OrbitDB identity signed
+// its public key and the signature of its ID.
+func (p *OrbitDBIdentityProvider) VerifyIdentity(identity *Identity) error {
+	if identity == nil {
+		return errmsg.ErrIdentityNotDefined
+	}
+
+	if identity.Signatures == nil {
+		return errmsg.ErrSigNotVerified
+	}
+
+	idBytes, err := hex.DecodeString(identity.ID)
+	if err != nil {
+		return errmsg.ErrIdentityDeserialization.Wrap(err)
+	}
+
+	idKey, err := unmarshalRawPublicKey(idBytes)
+	if err != nil {
+		return errmsg.ErrPubKeyDeserialization.Wrap(err)
+	}
+
+	// signed as an hex string, see SignIdentity
+	data := []byte(hex.EncodeToString(append(append([]byte(nil), identity.PublicKey...), identity.Signatures.ID...)))
+
+	ok, err := idKey.Verify(data, identity.Signatures.PublicKey)
+	if err != nil {
+		return errmsg.ErrSigNotVerified.Wrap(err)
+	}
+
+	if !ok {
+		return errmsg.ErrSigNotVerified
+	}
+
 	return nil
 }
 
 // NewOrbitDBIdentityProvider creates a new identity for use with OrbitDB.
 func NewOrbitDBIdentityProvider(options *CreateIdentityOptions) Interface {
+	if options == nil {
+		return &OrbitDBIdentityProvider{}
+	}
+
 	return &OrbitDBIdentityProvider{
 		keystore: options.Keystore,
 	}
@@ -30,7 +65,7 @@ func NewOrbitDBIdentityProvider(options *CreateIdentityOptions) Interface {
 func (p *OrbitDBIdentityProvider) GetID(ctx context.Context, options *CreateIdentityOptions) (string, error) {
 	private, err := p.keystore.GetKey(ctx, options.ID)
 	if err != nil || private == nil {
-		private, err = p.keystore.CreateKey(ctx, options.ID)
+		private, err = createKey(ctx, p.keystore, options.ID, options.KeyType)
 		if err != nil {
 			return "", errmsg.ErrKeyStoreCreateEntry.Wrap(err)
 		}
@@ -44,6 +79,21 @@ func (p *OrbitDBIdentityProvider) GetID(ctx context.Context, options *CreateIden
 	return hex.EncodeToString(pubBytes), nil
 }
 
+// resolveID returns the ID of an existing identity.
+func (p *OrbitDBIdentityProvider) resolveID(ctx context.Context, options *CreateIdentityOptions) (string, error) {
+	private, err := p.keystore.GetKey(ctx, options.ID)
+	if err != nil {
+		return "", errmsg.ErrKeyNotInKeystore.Wrap(err)
+	}
+
+	pubBytes, err := private.GetPublic().Raw()
+	if err != nil {
+		return "", errmsg.ErrPubKeySerialization.Wrap(err)
+	}
+
+	return hex.EncodeToString(pubBytes), nil
+}
+
 // SignIdentity signs an OrbitDB identity.
 func (p *OrbitDBIdentityProvider) SignIdentity(ctx context.Context, data []byte, id string) ([]byte, error) {
 	key, err := p.keystore.GetKey(ctx, id)
@@ -79,8 +129,9 @@ func (p *OrbitDBIdentityProvider) Sign(ctx context.Context, identity *Identity,
 	return sig, nil
 }
 
+// UnmarshalPublicKey decodes a public key of any supported type.
 func (p *OrbitDBIdentityProvider) UnmarshalPublicKey(data []byte) (crypto.PubKey, error) {
-	pubKey, err := crypto.UnmarshalSecp256k1PublicKey(data)
+	pubKey, err := unmarshalPublicKey(data)
 	if err != nil {
 		return nil, errmsg.ErrInvalidPubKeyFormat
 	}
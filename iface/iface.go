@@ -5,8 +5,8 @@ import (
 	"time"
 
 	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
 	format "github.com/ipfs/go-ipld-format"
-	coreiface "github.com/ipfs/kubo/core/coreiface"
 
 	"berty.tech/go-ipfs-log/accesscontroller"
 	"berty.tech/go-ipfs-log/identityprovider"
@@ -14,6 +14,8 @@ import (
 
 const KeyEncryptedLinks = "encrypted_links"
 const KeyEncryptedLinksNonce = "encrypted_links_nonce"
+const KeyEncryptedPayload = "encrypted_payload"
+const KeyEncryptedPayloadNonce = "encrypted_payload_nonce"
 
 type WriteOpts struct {
 	Pin                 bool
@@ -32,11 +34,88 @@ type FetchOptions struct {
 	ProgressChan chan IPFSLogEntry
 	Provider     identityprovider.Interface
 	IO           IO
+
+	// Retries is the number of times the retrieval of a block is retried
+	// after a failure.
+	Retries int
+	// RetryBackoff is the delay before the first retry, doubled after each
+	// retry, defaults to 100ms.
+	RetryBackoff time.Duration
+	// MaxRetryBackoff caps the delay between two retries.
+	MaxRetryBackoff time.Duration
+
+	// SinceClockTime stops the fetch at the entries which clock time is
+	// lower or equal, only newer entries are loaded when it is above zero.
+	SinceClockTime int
+	// Frontier lists heads already known by the caller, the entries
+	// reachable from them are neither loaded nor traversed.
+	Frontier []cid.Cid
+
+	// AccessController checks each loaded entry, the rejected ones are
+	// reported and their ancestors are not traversed. Entries denied with
+	// errmsg.ErrLogAncestorsNotKnown are checked again once their Next
+	// entries are loaded.
+	AccessController accesscontroller.Interface
+	// AccessControllerV2 takes precedence over AccessController when set.
+	AccessControllerV2 accesscontroller.InterfaceV2
+	// VerifySignatures verifies the signature of each loaded entry using
+	// Provider, the invalid ones are reported and their ancestors are not
+	// traversed.
+	VerifySignatures bool
+
+	// Checkpoint persists the state of the fetch, an interrupted fetch
+	// using the same datastore resumes where it stopped. The checkpoint is
+	// cleared once every entry has been fetched.
+	Checkpoint datastore.Batching
+
+	// Report, when set, is filled with the report of the fetch.
+	Report *FetchReport
+}
+
+// FetchReport describes the entries a fetch could not load.
+type FetchReport struct {
+	// Failed holds the CIDs which could not be retrieved, with their error.
+	Failed map[cid.Cid]error
+
+	// Excluded holds the CIDs skipped by ShouldExclude.
+	Excluded []cid.Cid
+
+	// Truncated holds the CIDs which were not loaded because of Length.
+	Truncated []cid.Cid
+
+	// Checkpoint holds the first error met while saving the checkpoint.
+	Checkpoint error
+
+	// Rejected holds the CIDs of the entries refused by the access
+	// controller or with an invalid signature, with their error.
+	Rejected map[cid.Cid]error
+}
+
+// Complete returns true if no entry is missing, apart from the excluded ones.
+func (r *FetchReport) Complete() bool {
+	return len(r.Failed) == 0 && len(r.Truncated) == 0 && len(r.Rejected) == 0
+}
+
+// Storage is the minimal block storage needed to persist and retrieve log blocks.
+type Storage interface {
+	// Put stores a block.
+	Put(ctx context.Context, node format.Node) error
+
+	// Get retrieves a block from its CID.
+	Get(ctx context.Context, c cid.Cid) (format.Node, error)
+
+	// GetMany retrieves several blocks, in no particular order.
+	GetMany(ctx context.Context, cids []cid.Cid) <-chan *format.NodeOption
+}
+
+// StoragePinner is implemented by storages able to pin blocks.
+type StoragePinner interface {
+	Pin(ctx context.Context, c cid.Cid) error
 }
 
 type IO interface {
-	Write(ctx context.Context, ipfs coreiface.CoreAPI, obj interface{}, opts *WriteOpts) (cid.Cid, error)
-	Read(ctx context.Context, ipfs coreiface.CoreAPI, contentIdentifier cid.Cid) (format.Node, error)
+	Write(ctx context.Context, storage Storage, obj interface{}, opts *WriteOpts) (cid.Cid, error)
+	Read(ctx context.Context, storage Storage, contentIdentifier cid.Cid) (format.Node, error)
 	DecodeRawEntry(node format.Node, hash cid.Cid, p identityprovider.Interface) (IPFSLogEntry, error)
 	DecodeRawJSONLog(node format.Node) (*JSONLog, error)
 }
@@ -46,15 +125,25 @@ type IOPreSign interface {
 	PreSign(entry IPFSLogEntry) (IPFSLogEntry, error)
 }
 
+// IOOpenPayload is implemented by the IOs able to open sealed payloads.
+type IOOpenPayload interface {
+	IO
+	OpenPayload(entry IPFSLogEntry) ([]byte, error)
+}
+
 type LogOptions struct {
 	ID               string
 	AccessController accesscontroller.Interface
 	Entries          IPFSLogOrderedEntries
+	Index            IPFSLogIndex
 	Heads            []IPFSLogEntry
 	Clock            IPFSLogLamportClock
 	SortFn           func(a, b IPFSLogEntry) (int, error)
 	Concurrency      uint
 	IO               IO
+
+	// AccessControllerV2 takes precedence over AccessController when set.
+	AccessControllerV2 accesscontroller.InterfaceV2
 }
 
 type CreateEntryOptions struct {
@@ -85,6 +174,9 @@ type Snapshot struct {
 type AppendOptions struct {
 	PointerCount int
 	Pin          bool
+
+	// AdditionalData is signed and stored along with the entry.
+	AdditionalData map[string]string
 }
 
 type IPFSLog interface {
@@ -140,6 +232,22 @@ type IPFSLogOrderedEntries interface {
 	Reverse() IPFSLogOrderedEntries
 }
 
+// IPFSLogIndex persists the state of a log, ie. its entries, the Next reverse
+// index and its heads, so it can be reopened without fetching it again.
+type IPFSLogIndex interface {
+	// Entries returns the entries of the log indexed by their CID.
+	Entries() IPFSLogOrderedEntries
+
+	// Next returns the reverse index of entries indexed by their next CIDs.
+	Next() IPFSLogOrderedEntries
+
+	// Heads returns the persisted heads.
+	Heads() ([]IPFSLogEntry, error)
+
+	// SetHeads replaces the persisted heads.
+	SetHeads(heads []IPFSLogEntry) error
+}
+
 type IPFSLogEntry interface {
 	accesscontroller.LogEntry
 
@@ -2,6 +2,7 @@ package cbor
 
 import (
 	"context"
+	"crypto/rand"
 	"encoding/base64"
 	"fmt"
 	"math"
@@ -9,11 +10,9 @@ import (
 	"berty.tech/go-ipfs-log/enc"
 	"github.com/ipfs/go-ipld-cbor/encoding"
 
-	"github.com/ipfs/boxo/path"
 	"github.com/ipfs/go-cid"
 	cbornode "github.com/ipfs/go-ipld-cbor"
 	format "github.com/ipfs/go-ipld-format"
-	coreiface "github.com/ipfs/kubo/core/coreiface"
 	ic "github.com/libp2p/go-libp2p/core/crypto"
 	"github.com/polydawn/refmt/obj/atlas"
 
@@ -31,6 +30,7 @@ type IOCbor struct {
 
 	constantIdentity *identityprovider.Identity
 	linkKey          enc.SharedKey
+	payloadKey       enc.SharedKey
 	atlasEntries     []*atlas.AtlasEntry
 	cborMarshaller   encoding.PooledMarshaller
 	cborUnmarshaller encoding.PooledUnmarshaller
@@ -39,6 +39,10 @@ type IOCbor struct {
 type Options struct {
 	//ConstantIdentity *identityprovider.Identity
 	LinkKey enc.SharedKey
+
+	// PayloadKey seals the payloads of the entries, which are signed and
+	// stored sealed. Readers without the key get empty payloads.
+	PayloadKey enc.SharedKey
 }
 
 func (i *IOCbor) DecodeRawJSONLog(node format.Node) (*iface.JSONLog, error) {
@@ -64,6 +68,11 @@ func (i *IOCbor) DecodeRawEntry(node format.Node, hash cid.Cid, p identityprovid
 		return nil, errmsg.ErrDecrypt.Wrap(err)
 	}
 
+	obj, err = i.DecryptPayload(obj)
+	if err != nil {
+		return nil, errmsg.ErrDecrypt.Wrap(err)
+	}
+
 	obj.Hash = hash
 
 	e := i.refEntry.New()
@@ -109,6 +118,9 @@ func IO(refEntry iface.IPFSLogEntry, refClock iface.IPFSLogLamportClock) (*IOCbo
 			AddField("Identity", atlas.StructMapEntry{SerialName: "identity"}).
 			AddField("EncryptedLinks", atlas.StructMapEntry{SerialName: "enc_links", OmitEmpty: true}).
 			AddField("EncryptedLinksNonce", atlas.StructMapEntry{SerialName: "enc_links_nonce", OmitEmpty: true}).
+			AddField("EncryptedPayload", atlas.StructMapEntry{SerialName: "enc_payload", OmitEmpty: true}).
+			AddField("EncryptedPayloadNonce", atlas.StructMapEntry{SerialName: "enc_payload_nonce", OmitEmpty: true}).
+			AddField("AdditionalData", atlas.StructMapEntry{SerialName: "additional_data", OmitEmpty: true}).
 			Complete(),
 
 		atlas.BuildEntry(jsonable.EntryV1{}).
@@ -217,7 +229,8 @@ func (i *IOCbor) ApplyOptions(options *Options) *IOCbor {
 		refEntry:     i.refEntry,
 		atlasEntries: i.atlasEntries,
 		//constantIdentity: options.ConstantIdentity,
-		linkKey: options.LinkKey,
+		linkKey:    options.LinkKey,
+		payloadKey: options.PayloadKey,
 	}
 
 	out.createCborMarshaller()
@@ -229,8 +242,10 @@ func (i *IOCbor) SetDebug(val bool) {
 	i.debug = val
 }
 
-// WriteCBOR writes a CBOR representation of a given object in IPFS' DAG.
-func (i *IOCbor) Write(ctx context.Context, ipfs coreiface.CoreAPI, obj interface{}, opts *iface.WriteOpts) (cid.Cid, error) {
+// Write writes a CBOR representation of a given object in the storage.
+//
+// Pinning is only done when the storage implements iface.StoragePinner.
+func (i *IOCbor) Write(ctx context.Context, storage iface.Storage, obj interface{}, opts *iface.WriteOpts) (cid.Cid, error) {
 	if opts == nil {
 		opts = &iface.WriteOpts{}
 	}
@@ -255,13 +270,13 @@ func (i *IOCbor) Write(ctx context.Context, ipfs coreiface.CoreAPI, obj interfac
 		fmt.Printf("\nStr of cbor: %x\n", cborNode.RawData())
 	}
 
-	err = ipfs.Dag().Add(ctx, cborNode)
+	err = storage.Put(ctx, cborNode)
 	if err != nil {
 		return cid.Undef, errmsg.ErrIPFSOperationFailed.Wrap(err)
 	}
 
-	if opts.Pin {
-		if err = ipfs.Pin().Add(ctx, path.FromCid(cborNode.Cid())); err != nil {
+	if pinner, ok := storage.(iface.StoragePinner); ok && opts.Pin {
+		if err = pinner.Pin(ctx, cborNode.Cid()); err != nil {
 			return cid.Undef, errmsg.ErrIPFSOperationFailed.Wrap(err)
 		}
 	}
@@ -269,12 +284,21 @@ func (i *IOCbor) Write(ctx context.Context, ipfs coreiface.CoreAPI, obj interfac
 	return cborNode.Cid(), nil
 }
 
-// Read reads a CBOR representation of a given object from IPFS' DAG.
-func (i *IOCbor) Read(ctx context.Context, ipfs coreiface.CoreAPI, contentIdentifier cid.Cid) (format.Node, error) {
-	return ipfs.Dag().Get(ctx, contentIdentifier)
+// Read reads a CBOR representation of a given object from the storage.
+func (i *IOCbor) Read(ctx context.Context, storage iface.Storage, contentIdentifier cid.Cid) (format.Node, error) {
+	return storage.Get(ctx, contentIdentifier)
 }
 
 func (i *IOCbor) PreSign(entry iface.IPFSLogEntry) (iface.IPFSLogEntry, error) {
+	entry, err := i.encryptLinks(entry)
+	if err != nil {
+		return nil, err
+	}
+
+	return i.encryptPayload(entry)
+}
+
+func (i *IOCbor) encryptLinks(entry iface.IPFSLogEntry) (iface.IPFSLogEntry, error) {
 	if i.linkKey == nil {
 		return entry, nil
 	}
@@ -310,6 +334,93 @@ func (i *IOCbor) PreSign(entry iface.IPFSLogEntry) (iface.IPFSLogEntry, error) {
 	return entry, nil
 }
 
+// encryptPayload seals the payload with a random nonce, an entry whose
+// payload is already sealed is kept as is.
+func (i *IOCbor) encryptPayload(entry iface.IPFSLogEntry) (iface.IPFSLogEntry, error) {
+	if i.payloadKey == nil {
+		return entry, nil
+	}
+
+	if _, ok := entry.GetAdditionalData()[iface.KeyEncryptedPayload]; ok {
+		return entry, nil
+	}
+
+	seed := make([]byte, 32)
+	if _, err := rand.Read(seed); err != nil {
+		return nil, errmsg.ErrEncrypt.Wrap(err)
+	}
+
+	nonce, err := i.payloadKey.DeriveNonce(seed)
+	if err != nil {
+		return nil, errmsg.ErrEncrypt.Wrap(err)
+	}
+
+	encryptedPayload, err := i.payloadKey.SealWithNonce(entry.GetPayload(), nonce)
+	if err != nil {
+		return nil, errmsg.ErrEncrypt.Wrap(fmt.Errorf("unable to encrypt payload"))
+	}
+
+	entry = entry.Copy()
+	entry.SetAdditionalDataValue(iface.KeyEncryptedPayload, base64.StdEncoding.EncodeToString(encryptedPayload))
+	entry.SetAdditionalDataValue(iface.KeyEncryptedPayloadNonce, base64.StdEncoding.EncodeToString(nonce))
+
+	return entry, nil
+}
+
+// DecryptPayload replaces the payload of an entry with its sealed payload,
+// the payload is emptied when it can't be opened without the key.
+func (i *IOCbor) DecryptPayload(entry *jsonable.EntryV2) (*jsonable.EntryV2, error) {
+	if len(entry.EncryptedPayload) == 0 {
+		return entry, nil
+	}
+
+	// the clear payload of a sealed entry isn't signed
+	entry.Payload = ""
+
+	if i.payloadKey == nil {
+		return entry, nil
+	}
+
+	payload, err := i.openPayload(entry.EncryptedPayload, entry.EncryptedPayloadNonce)
+	if err != nil {
+		return nil, err
+	}
+
+	entry.Payload = string(payload)
+
+	return entry, nil
+}
+
+// OpenPayload opens the sealed payload of an entry.
+func (i *IOCbor) OpenPayload(entry iface.IPFSLogEntry) ([]byte, error) {
+	if i.payloadKey == nil {
+		return nil, errmsg.ErrDecrypt.Wrap(fmt.Errorf("no payload key"))
+	}
+
+	add := entry.GetAdditionalData()
+
+	return i.openPayload(add[iface.KeyEncryptedPayload], add[iface.KeyEncryptedPayloadNonce])
+}
+
+func (i *IOCbor) openPayload(encryptedPayload string, encryptedPayloadNonce string) ([]byte, error) {
+	sealed, err := base64.StdEncoding.DecodeString(encryptedPayload)
+	if err != nil {
+		return nil, errmsg.ErrEntryDeserializationFailed.Wrap(err)
+	}
+
+	nonce, err := base64.StdEncoding.DecodeString(encryptedPayloadNonce)
+	if err != nil {
+		return nil, errmsg.ErrEntryDeserializationFailed.Wrap(err)
+	}
+
+	payload, err := i.payloadKey.OpenWithNonce(sealed, nonce)
+	if err != nil {
+		return nil, errmsg.ErrDecrypt.Wrap(err)
+	}
+
+	return payload, nil
+}
+
 func (i *IOCbor) DecryptLinks(entry *jsonable.EntryV2) (*jsonable.EntryV2, error) {
 	if i.linkKey == nil || len(entry.EncryptedLinks) == 0 || len(entry.EncryptedLinksNonce) == 0 {
 		return entry, nil
@@ -25,6 +25,13 @@ type Entry struct {
 
 	EncryptedLinks      string
 	EncryptedLinksNonce string
+
+	EncryptedPayload      string
+	EncryptedPayloadNonce string
+
+	// AdditionalData is the additional data of the entry, apart from the
+	// encrypted links and payload
+	AdditionalData map[string]string `json:",omitempty"`
 }
 
 // EntryV0 CBOR representable version of Entry v0
@@ -233,6 +240,29 @@ func ToJsonableEntry(e iface.IPFSLogEntry) interface{} {
 				ret.Next = []cid.Cid{}
 				ret.Refs = []cid.Cid{}
 			}
+
+			encryptedPayload, okEncrypted := add[iface.KeyEncryptedPayload]
+			encryptedPayloadNonce, okEncryptedNonce := add[iface.KeyEncryptedPayloadNonce]
+
+			if okEncrypted && okEncryptedNonce {
+				ret.EncryptedPayload = encryptedPayload
+				ret.EncryptedPayloadNonce = encryptedPayloadNonce
+
+				ret.Payload = ""
+			}
+
+			for k, v := range add {
+				switch k {
+				case iface.KeyEncryptedLinks, iface.KeyEncryptedLinksNonce, iface.KeyEncryptedPayload, iface.KeyEncryptedPayloadNonce:
+					continue
+				}
+
+				if ret.AdditionalData == nil {
+					ret.AdditionalData = map[string]string{}
+				}
+
+				ret.AdditionalData[k] = v
+			}
 		}
 
 		return ret
@@ -301,6 +331,16 @@ func (c *Entry) ToPlain(out iface.IPFSLogEntry, provider identityprovider.Interf
 	out.SetPayload([]byte(c.Payload))
 	out.SetIdentity(identity)
 
+	for k, v := range c.AdditionalData {
+		out.SetAdditionalDataValue(k, v)
+	}
+
+	// the sealed payload is signed, it is kept to verify the entry
+	if c.EncryptedPayload != "" && c.EncryptedPayloadNonce != "" {
+		out.SetAdditionalDataValue(iface.KeyEncryptedPayload, c.EncryptedPayload)
+		out.SetAdditionalDataValue(iface.KeyEncryptedPayloadNonce, c.EncryptedPayloadNonce)
+	}
+
 	return nil
 }
 
@@ -0,0 +1,391 @@
+package ipfslog // import "berty.tech/go-ipfs-log"
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"berty.tech/go-ipfs-log/entry"
+	"berty.tech/go-ipfs-log/errmsg"
+	"berty.tech/go-ipfs-log/iface"
+)
+
+// JoinPolicy defines what happens to the valid entries of a join when some
+// entries are rejected.
+type JoinPolicy int
+
+const (
+	// JoinAllOrNothing fails the join if any entry is rejected.
+	JoinAllOrNothing JoinPolicy = iota
+
+	// JoinCausalSubset adds the valid entries whose ancestors have all been
+	// accepted.
+	JoinCausalSubset
+)
+
+// JoinRejection is the reason why an entry has been rejected by a join.
+type JoinRejection int
+
+const (
+	// JoinRejectedInvalid is used for entries which are not defined.
+	JoinRejectedInvalid JoinRejection = iota
+
+	// JoinRejectedLogID is used for entries belonging to another log.
+	JoinRejectedLogID
+
+	// JoinRejectedAccess is used for entries refused by the access controller.
+	JoinRejectedAccess
+
+	// JoinRejectedSignature is used for entries which signature is invalid.
+	JoinRejectedSignature
+
+	// JoinRejectedAncestor is used for entries referencing a rejected entry.
+	JoinRejectedAncestor
+)
+
+func (r JoinRejection) String() string {
+	switch r {
+	case JoinRejectedInvalid:
+		return "invalid entry"
+	case JoinRejectedLogID:
+		return "wrong log ID"
+	case JoinRejectedAccess:
+		return "access denied"
+	case JoinRejectedSignature:
+		return "invalid signature"
+	case JoinRejectedAncestor:
+		return "rejected ancestor"
+	default:
+		return fmt.Sprintf("JoinRejection(%d)", int(r))
+	}
+}
+
+type JoinOptions struct {
+	// Size is the maximum number of entries kept after the join, all the
+	// entries are kept if it is nil or negative. It can't be used with a log
+	// backed by an index.
+	Size *int
+
+	// Policy defaults to JoinAllOrNothing.
+	Policy JoinPolicy
+}
+
+// RejectedEntry is an entry rejected by a join.
+type RejectedEntry struct {
+	Entry  iface.IPFSLogEntry
+	Reason JoinRejection
+	Err    error
+}
+
+// JoinResult lists the entries a join has added to the log and the ones it
+// has rejected.
+type JoinResult struct {
+	Accepted []iface.IPFSLogEntry
+	Rejected []*RejectedEntry
+}
+
+// JoinWithOptions joins the log with another log.
+//
+// New entries are verified by at most Concurrency workers. When an entry is
+// rejected with the JoinAllOrNothing policy, the log is left unchanged and an
+// error is returned along with the result.
+//
+// Joining a log with another ID fails. Entries belonging to another log are
+// never joined, they are reported as rejected without failing the join.
+func (l *IPFSLog) JoinWithOptions(ctx context.Context, otherLog iface.IPFSLog, options *JoinOptions) (*JoinResult, error) {
+	if otherLog == nil || l == nil {
+		return nil, errmsg.ErrLogJoinNotDefined
+	}
+
+	if options == nil {
+		options = &JoinOptions{}
+	}
+
+	if options.Size != nil && *options.Size > -1 && l.index != nil {
+		return nil, errmsg.ErrLogJoinFailed.Wrap(errmsg.ErrJoinSizeWithIndex)
+	}
+
+	if l.ID != otherLog.GetID() {
+		return nil, errmsg.ErrLogJoinFailed.Wrap(errmsg.ErrLogJoinIDMismatch)
+	}
+
+	result := &JoinResult{}
+
+	// joining same log instance
+	if l == otherLog {
+		return result, nil
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	newItems, foreign := difference(otherLog.GetEntries(), otherLog.RawHeads().Slice(), l)
+
+	rejected, err := l.verifyJoinedEntries(ctx, newItems.Slice())
+	if err != nil {
+		return nil, errmsg.ErrLogJoinFailed.Wrap(err)
+	}
+
+	for _, r := range rejected {
+		if r.Reason == JoinRejectedAccess {
+			l.events.emit(EventJoinRejected{Entry: r.Entry, Err: r.Err})
+		}
+	}
+
+	if len(rejected) > 0 && options.Policy == JoinAllOrNothing {
+		result.Rejected = rejected
+
+		return result, errmsg.ErrLogJoinFailed.Wrap(rejected[0].Err)
+	}
+
+	result.Accepted, result.Rejected = causalSubset(newItems.Slice(), rejected)
+
+	for _, e := range foreign {
+		result.Rejected = append(result.Rejected, &RejectedEntry{Entry: e, Reason: JoinRejectedLogID, Err: errmsg.ErrLogIDMismatch})
+	}
+
+	previousHeads := l.heads.Keys()
+
+	for _, e := range result.Accepted {
+		for _, next := range e.GetNext() {
+			l.Next.Set(next.String(), e)
+		}
+
+		l.Entries.Set(e.GetHash().String(), e)
+	}
+
+	nextsFromNewItems := map[string]struct{}{}
+	for _, e := range result.Accepted {
+		for _, n := range e.GetNext() {
+			nextsFromNewItems[n.String()] = struct{}{}
+		}
+	}
+
+	// the new heads are the ones of the log and the accepted entries which
+	// are not referenced anymore
+	candidates := l.heads.Copy()
+	for _, e := range result.Accepted {
+		if _, ok := nextsFromNewItems[e.GetHash().String()]; !ok {
+			candidates.Set(e.GetHash().String(), e)
+		}
+	}
+
+	mergedHeads := entry.FindHeads(candidates)
+
+	for idx, e := range mergedHeads {
+		// notReferencedByNewItems
+		if _, ok := nextsFromNewItems[e.GetHash().String()]; ok {
+			mergedHeads[idx] = nil
+		}
+
+		// notInCurrentNexts
+		if _, ok := l.Next.Get(e.GetHash().String()); ok {
+			mergedHeads[idx] = nil
+		}
+	}
+
+	l.heads = entry.NewOrderedMapFromEntries(mergedHeads)
+	l.linearMerge(result.Accepted)
+
+	if options.Size != nil && *options.Size > -1 {
+		tmp := l.values().Slice()
+		tmp = tmp[len(tmp)-minInt(*options.Size, len(tmp)):]
+
+		entries := entry.NewOrderedMapFromEntries(tmp)
+		heads := entry.NewOrderedMapFromEntries(entry.FindHeads(entry.NewOrderedMapFromEntries(tmp)))
+
+		l.Entries = entries
+		l.heads = heads
+		l.linearInvalidate()
+	}
+
+	if err := l.persistHeads(); err != nil {
+		return nil, errmsg.ErrLogJoinFailed.Wrap(err)
+	}
+
+	// Find the latest clock from the heads
+	headsSlice := l.heads.Slice()
+	clockID := l.Clock.GetID()
+
+	maxClock := maxClockTimeForEntries(headsSlice, 0)
+	clockTime := maxInt(l.Clock.GetTime(), maxClock)
+
+	l.Clock = entry.NewLamportClock(clockID, clockTime)
+
+	if len(result.Accepted) > 0 {
+		l.events.emit(EventJoined{Entries: result.Accepted})
+	}
+
+	if !equalKeys(previousHeads, l.heads.Keys()) {
+		l.events.emit(EventHeadsReplaced{Heads: l.heads.Slice()})
+	}
+
+	return result, nil
+}
+
+// verifyJoinedEntries checks the entries and returns the rejected ones.
+// Signatures are verified first by a pool of workers, so that the access
+// controller only sees verified entries, which it checks in causal order.
+func (l *IPFSLog) verifyJoinedEntries(ctx context.Context, entries []iface.IPFSLogEntry) ([]*RejectedEntry, error) {
+	// l.lock must be Locked
+
+	results := make([]*RejectedEntry, len(entries))
+
+	err := l.runJoinWorkers(ctx, len(entries), func(idx int) {
+		results[idx] = l.verifyJoinedSignature(entries[idx])
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var verified []int
+	for idx, r := range results {
+		if r == nil {
+			verified = append(verified, idx)
+		}
+	}
+
+	// the access controller can see the other verified entries of the join,
+	// such as the ancestors of the entry
+	verifiedEntries := make([]iface.IPFSLogEntry, len(verified))
+	for i, idx := range verified {
+		verifiedEntries[i] = entries[idx]
+	}
+
+	canAppendContext := newCanAppendContext(l, verifiedEntries)
+
+	// entries are always more recent than the ones they reference
+	sort.SliceStable(verified, func(i, j int) bool {
+		return entries[verified[i]].GetClock().GetTime() < entries[verified[j]].GetClock().GetTime()
+	})
+
+	for _, idx := range verified {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		if err := l.canAppend(ctx, entries[idx], canAppendContext); err != nil {
+			results[idx] = &RejectedEntry{Entry: entries[idx], Reason: JoinRejectedAccess, Err: err}
+		}
+	}
+
+	var rejected []*RejectedEntry
+	for _, r := range results {
+		if r != nil {
+			rejected = append(rejected, r)
+		}
+	}
+
+	return rejected, nil
+}
+
+// runJoinWorkers calls fn for each index up to count using a pool of workers.
+func (l *IPFSLog) runJoinWorkers(ctx context.Context, count int, fn func(idx int)) error {
+	workers := int(l.concurrency)
+	if workers < 1 {
+		workers = 1
+	}
+
+	if workers > count {
+		workers = count
+	}
+
+	jobs := make(chan int)
+	wg := sync.WaitGroup{}
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for idx := range jobs {
+				fn(idx)
+			}
+		}()
+	}
+
+	var err error
+
+	for idx := 0; idx < count; idx++ {
+		if err = ctx.Err(); err != nil {
+			break
+		}
+
+		jobs <- idx
+	}
+
+	close(jobs)
+	wg.Wait()
+
+	return err
+}
+
+func (l *IPFSLog) verifyJoinedSignature(e iface.IPFSLogEntry) *RejectedEntry {
+	if e == nil || !e.Defined() {
+		return &RejectedEntry{Entry: e, Reason: JoinRejectedInvalid, Err: errmsg.ErrEntryNotDefined}
+	}
+
+	if err := e.Verify(l.Identity.Provider, l.IO()); err != nil {
+		return &RejectedEntry{Entry: e, Reason: JoinRejectedSignature, Err: errmsg.ErrSigNotVerified.Wrap(err)}
+	}
+
+	return nil
+}
+
+// causalSubset returns the entries which have not been rejected and which do
+// not reference a rejected entry, along with all the rejected entries.
+func causalSubset(entries []iface.IPFSLogEntry, rejected []*RejectedEntry) ([]iface.IPFSLogEntry, []*RejectedEntry) {
+	if len(rejected) == 0 {
+		return entries, nil
+	}
+
+	excluded := map[string]struct{}{}
+	for _, r := range rejected {
+		if r.Entry != nil && r.Entry.Defined() {
+			excluded[r.Entry.GetHash().String()] = struct{}{}
+		}
+	}
+
+	// entries are always more recent than the ones they reference
+	sorted := append([]iface.IPFSLogEntry(nil), entries...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].GetClock().GetTime() < sorted[j].GetClock().GetTime()
+	})
+
+	var accepted []iface.IPFSLogEntry
+
+	for _, e := range sorted {
+		if e == nil || !e.Defined() {
+			continue
+		}
+
+		if _, ok := excluded[e.GetHash().String()]; ok {
+			continue
+		}
+
+		var rejectedNext string
+		for _, n := range e.GetNext() {
+			if _, ok := excluded[n.String()]; ok {
+				rejectedNext = n.String()
+				break
+			}
+		}
+
+		if rejectedNext != "" {
+			excluded[e.GetHash().String()] = struct{}{}
+			rejected = append(rejected, &RejectedEntry{
+				Entry:  e,
+				Reason: JoinRejectedAncestor,
+				Err:    fmt.Errorf("references rejected entry %s", rejectedNext),
+			})
+
+			continue
+		}
+
+		accepted = append(accepted, e)
+	}
+
+	return accepted, rejected
+}
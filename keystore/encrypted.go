@@ -0,0 +1,601 @@
+package keystore // import "berty.tech/go-ipfs-log/keystore"
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"strings"
+	"sync"
+
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"golang.org/x/crypto/argon2"
+
+	"berty.tech/go-ipfs-log/enc"
+	"berty.tech/go-ipfs-log/errmsg"
+)
+
+var (
+	encryptedPrefix    = datastore.NewKey("encrypted-keystore")
+	encryptedParamsKey = encryptedPrefix.ChildString("params")
+	encryptedKeysKey   = encryptedPrefix.ChildString("keys")
+)
+
+const (
+	encryptedKeystoreVersion = 1
+	encryptedKeystoreKDF     = "argon2id"
+	encryptedSaltSize        = 16
+
+	// bounds of the derivation parameters, they may come from an untrusted
+	// export
+	maxKDFTime    = 16
+	minKDFMemory  = 1024
+	maxKDFMemory  = 1024 * 1024
+	maxKDFThreads = 64
+)
+
+// EncryptedKeystoreOptions configures the Argon2id derivation of the key
+// encryption key from the passphrase.
+type EncryptedKeystoreOptions struct {
+	// Time is the number of passes, defaults to 1, at most 16.
+	Time uint32
+
+	// Memory is the memory used in KiB, defaults to 64 MiB, from 1 MiB to
+	// 1 GiB.
+	Memory uint32
+
+	// Threads defaults to 4, at most 64.
+	Threads uint8
+
+	// CacheSize is the number of decrypted keys kept in memory while the
+	// keystore is unlocked, defaults to 128.
+	CacheSize int
+}
+
+// kdfParams are the parameters of the derivation of a key from a
+// passphrase.
+type kdfParams struct {
+	KDF     string `json:"kdf"`
+	Salt    []byte `json:"salt"`
+	Time    uint32 `json:"time"`
+	Memory  uint32 `json:"memory"`
+	Threads uint8  `json:"threads"`
+}
+
+// encryptedParams is stored in clear, it holds the data encryption key
+// sealed with the key derived from the passphrase.
+type encryptedParams struct {
+	Version int `json:"version"`
+	kdfParams
+	DataKey []byte `json:"data_key"`
+}
+
+// encryptedKey is the sealed content of a stored key, the ID prevents a key
+// from being swapped with another one in the datastore.
+type encryptedKey struct {
+	ID  string `json:"id"`
+	Key []byte `json:"key"`
+}
+
+// EncryptedKeystore is a keystore encrypting the keys at rest.
+//
+// Keys are sealed with a random data encryption key, which is itself sealed
+// with a key derived from a passphrase, so that changing the passphrase
+// doesn't require to encrypt the keys again. Keys can't be used until the
+// keystore is unlocked.
+type EncryptedKeystore struct {
+	store   datastore.Datastore
+	options EncryptedKeystoreOptions
+
+	lock    sync.RWMutex
+	dataKey enc.SharedKey
+	cache   *lru.Cache
+}
+
+// NewEncryptedKeystore creates a new locked encrypted keystore.
+func NewEncryptedKeystore(store datastore.Datastore, options *EncryptedKeystoreOptions) (*EncryptedKeystore, error) {
+	if store == nil {
+		return nil, errmsg.ErrKeystoreNotDefined
+	}
+
+	opts := options.withDefaults()
+	if _, err := newKDFParams(&opts); err != nil {
+		return nil, err
+	}
+
+	cache, err := lru.New(opts.CacheSize)
+	if err != nil {
+		return nil, errmsg.ErrKeyStoreInitFailed.Wrap(err)
+	}
+
+	return &EncryptedKeystore{
+		store:   store,
+		options: opts,
+		cache:   cache,
+	}, nil
+}
+
+func (o *EncryptedKeystoreOptions) withDefaults() EncryptedKeystoreOptions {
+	if o == nil {
+		o = &EncryptedKeystoreOptions{}
+	}
+
+	opts := *o
+	if opts.Time == 0 {
+		opts.Time = 1
+	}
+
+	if opts.Memory == 0 {
+		opts.Memory = 64 * 1024
+	}
+
+	if opts.Threads == 0 {
+		opts.Threads = 4
+	}
+
+	if opts.CacheSize <= 0 {
+		opts.CacheSize = 128
+	}
+
+	return opts
+}
+
+// Unlock opens the keystore with its passphrase, the passphrase of a new
+// keystore is set by its first unlock.
+func (k *EncryptedKeystore) Unlock(ctx context.Context, passphrase []byte) error {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+
+	params, err := k.getParams(ctx)
+	if err == datastore.ErrNotFound {
+		dataKey := make([]byte, enc.SecretBoxKeySize)
+		if _, err := rand.Read(dataKey); err != nil {
+			return errmsg.ErrKeyStoreInitFailed.Wrap(err)
+		}
+
+		params, err = k.sealDataKey(dataKey, passphrase)
+		if err != nil {
+			return err
+		}
+
+		if err := k.putParams(ctx, params); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+
+	dataKey, err := openDataKey(params, passphrase)
+	if err != nil {
+		return err
+	}
+
+	k.dataKey = dataKey
+
+	return nil
+}
+
+// Lock forgets the keys, they can't be used until the keystore is unlocked.
+func (k *EncryptedKeystore) Lock() {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+
+	k.dataKey = nil
+	k.cache.Purge()
+}
+
+// IsLocked returns true if the keystore must be unlocked to use its keys.
+func (k *EncryptedKeystore) IsLocked() bool {
+	k.lock.RLock()
+	defer k.lock.RUnlock()
+
+	return k.dataKey == nil
+}
+
+// ChangePassphrase replaces the passphrase of the keystore.
+func (k *EncryptedKeystore) ChangePassphrase(ctx context.Context, oldPassphrase, newPassphrase []byte) error {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+
+	params, err := k.getParams(ctx)
+	if err == datastore.ErrNotFound {
+		return errmsg.ErrKeystorePassphraseInvalid
+	} else if err != nil {
+		return err
+	}
+
+	dataKey, err := openDataKeyBytes(params, oldPassphrase)
+	if err != nil {
+		return err
+	}
+
+	params, err = k.sealDataKey(dataKey, newPassphrase)
+	if err != nil {
+		return err
+	}
+
+	return k.putParams(ctx, params)
+}
+
+// Migrate encrypts the keys of a plaintext keystore datastore, such as the
+// one of Keystore, and removes them from it. The keystore must be unlocked,
+// the plaintext datastore can be the one of the encrypted keystore.
+func (k *EncryptedKeystore) Migrate(ctx context.Context, plaintext datastore.Datastore) error {
+	results, err := plaintext.Query(ctx, query.Query{})
+	if err != nil {
+		return errmsg.ErrKeyStoreInitFailed.Wrap(err)
+	}
+
+	entries, err := results.Rest()
+	if err != nil {
+		return errmsg.ErrKeyStoreInitFailed.Wrap(err)
+	}
+
+	var migrated []datastore.Key
+	for _, e := range entries {
+		key := datastore.NewKey(e.Key)
+		if key.Equal(encryptedPrefix) || encryptedPrefix.IsAncestorOf(key) {
+			continue
+		}
+
+		priv, err := unmarshalPrivateKey(e.Value)
+		if err != nil {
+			return err
+		}
+
+		if err := k.PutKey(ctx, strings.TrimPrefix(key.String(), "/"), priv); err != nil {
+			return err
+		}
+
+		migrated = append(migrated, key)
+	}
+
+	for _, key := range migrated {
+		if err := plaintext.Delete(ctx, key); err != nil {
+			return errmsg.ErrKeyStorePutFailed.Wrap(err)
+		}
+	}
+
+	return nil
+}
+
+// HasKey checks whether a given key ID exist in the keystore, it doesn't
+// require the keystore to be unlocked.
+func (k *EncryptedKeystore) HasKey(ctx context.Context, id string) (bool, error) {
+	ok, err := k.store.Has(ctx, encryptedKeyKey(id))
+	if err != nil {
+		return false, errmsg.ErrKeyNotInKeystore.Wrap(err)
+	}
+
+	return ok, nil
+}
+
+// CreateKey creates a new Secp256k1 key in the keystore.
+func (k *EncryptedKeystore) CreateKey(ctx context.Context, id string) (crypto.PrivKey, error) {
+	return k.CreateKeyWithType(ctx, id, KeyTypeDefault)
+}
+
+// CreateKeyWithType creates a new key of the given type in the keystore.
+func (k *EncryptedKeystore) CreateKeyWithType(ctx context.Context, id string, keyType KeyType) (crypto.PrivKey, error) {
+	priv, err := generateKey(keyType)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := k.PutKey(ctx, id, priv); err != nil {
+		return nil, err
+	}
+
+	return priv, nil
+}
+
+// PutKey encrypts and stores an existing key in the keystore.
+func (k *EncryptedKeystore) PutKey(ctx context.Context, id string, key crypto.PrivKey) error {
+	k.lock.RLock()
+	defer k.lock.RUnlock()
+
+	if k.dataKey == nil {
+		return errmsg.ErrKeystoreLocked
+	}
+
+	keyBytes, err := marshalPrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(&encryptedKey{ID: id, Key: keyBytes})
+	if err != nil {
+		return errmsg.ErrInvalidPrivKeyFormat.Wrap(err)
+	}
+
+	sealed, err := k.dataKey.Seal(data)
+	if err != nil {
+		return errmsg.ErrEncrypt.Wrap(err)
+	}
+
+	if err := k.store.Put(ctx, encryptedKeyKey(id), sealed); err != nil {
+		return errmsg.ErrKeyStorePutFailed.Wrap(err)
+	}
+
+	k.cache.Add(id, key)
+
+	return nil
+}
+
+// GetKey retrieves and decrypts a key from the keystore.
+func (k *EncryptedKeystore) GetKey(ctx context.Context, id string) (crypto.PrivKey, error) {
+	k.lock.RLock()
+	defer k.lock.RUnlock()
+
+	if k.dataKey == nil {
+		return nil, errmsg.ErrKeystoreLocked
+	}
+
+	if cached, ok := k.cache.Get(id); ok {
+		return cached.(crypto.PrivKey), nil
+	}
+
+	sealed, err := k.store.Get(ctx, encryptedKeyKey(id))
+	if err != nil {
+		return nil, errmsg.ErrKeyNotInKeystore.Wrap(err)
+	}
+
+	data, err := k.dataKey.Open(sealed)
+	if err != nil {
+		return nil, errmsg.ErrDecrypt.Wrap(err)
+	}
+
+	var stored encryptedKey
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, errmsg.ErrInvalidPrivKeyFormat.Wrap(err)
+	}
+
+	if stored.ID != id {
+		return nil, errmsg.ErrInvalidPrivKeyFormat
+	}
+
+	priv, err := unmarshalPrivateKey(stored.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	k.cache.Add(id, priv)
+
+	return priv, nil
+}
+
+// ListKeys returns the IDs of the stored keys, it doesn't require the
+// keystore to be unlocked.
+func (k *EncryptedKeystore) ListKeys(ctx context.Context) ([]string, error) {
+	results, err := k.store.Query(ctx, query.Query{Prefix: encryptedKeysKey.String(), KeysOnly: true})
+	if err != nil {
+		return nil, errmsg.ErrKeyNotInKeystore.Wrap(err)
+	}
+
+	entries, err := results.Rest()
+	if err != nil {
+		return nil, errmsg.ErrKeyNotInKeystore.Wrap(err)
+	}
+
+	ids := make([]string, len(entries))
+	for i, e := range entries {
+		ids[i] = strings.TrimPrefix(e.Key, encryptedKeysKey.String()+"/")
+	}
+
+	return ids, nil
+}
+
+// DeleteKey removes a key from the keystore, it doesn't require the keystore
+// to be unlocked.
+func (k *EncryptedKeystore) DeleteKey(ctx context.Context, id string) error {
+	if err := k.store.Delete(ctx, encryptedKeyKey(id)); err != nil {
+		return errmsg.ErrKeyStoreDeleteFailed.Wrap(err)
+	}
+
+	k.cache.Remove(id)
+
+	return nil
+}
+
+// ExportKey returns a key encrypted with a passphrase, which can differ from
+// the one of the keystore.
+func (k *EncryptedKeystore) ExportKey(ctx context.Context, id string, passphrase []byte) ([]byte, error) {
+	key, err := k.GetKey(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return exportKey(id, key, passphrase, &k.options)
+}
+
+// ImportKey stores a key exported by ExportKey and returns its ID.
+func (k *EncryptedKeystore) ImportKey(ctx context.Context, data []byte, passphrase []byte) (string, error) {
+	id, key, err := importKey(data, passphrase)
+	if err != nil {
+		return "", err
+	}
+
+	if err := k.PutKey(ctx, id, key); err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
+
+// RotateKey replaces a key by a new key of the given type, the previous key
+// is discarded and must be exported beforehand to be kept.
+func (k *EncryptedKeystore) RotateKey(ctx context.Context, id string, keyType KeyType) (*KeyRotation, error) {
+	previous, err := k.GetKey(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	next, rotation, err := rotateKey(id, previous, keyType)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := k.PutKey(ctx, id, next); err != nil {
+		return nil, err
+	}
+
+	return rotation, nil
+}
+
+// Sign signs a value using a given private key.
+func (k *EncryptedKeystore) Sign(privKey crypto.PrivKey, bytes []byte) ([]byte, error) {
+	return privKey.Sign(bytes)
+}
+
+// Verify verifies a signature.
+func (k *EncryptedKeystore) Verify(signature []byte, publicKey crypto.PubKey, data []byte) error {
+	ok, err := publicKey.Verify(data, signature)
+	if err != nil {
+		return errmsg.ErrSigNotVerified.Wrap(err)
+	}
+
+	if !ok {
+		return errmsg.ErrSigNotVerified
+	}
+
+	return nil
+}
+
+func (k *EncryptedKeystore) getParams(ctx context.Context) (*encryptedParams, error) {
+	data, err := k.store.Get(ctx, encryptedParamsKey)
+	if err == datastore.ErrNotFound {
+		return nil, err
+	} else if err != nil {
+		return nil, errmsg.ErrKeyStoreInitFailed.Wrap(err)
+	}
+
+	params := &encryptedParams{}
+	if err := json.Unmarshal(data, params); err != nil {
+		return nil, errmsg.ErrKeyStoreInitFailed.Wrap(err)
+	}
+
+	if params.Version != encryptedKeystoreVersion {
+		return nil, errmsg.ErrKeyStoreInitFailed
+	}
+
+	if err := params.validate(); err != nil {
+		return nil, errmsg.ErrKeyStoreInitFailed.Wrap(err)
+	}
+
+	return params, nil
+}
+
+func (k *EncryptedKeystore) putParams(ctx context.Context, params *encryptedParams) error {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return errmsg.ErrKeyStorePutFailed.Wrap(err)
+	}
+
+	if err := k.store.Put(ctx, encryptedParamsKey, data); err != nil {
+		return errmsg.ErrKeyStorePutFailed.Wrap(err)
+	}
+
+	return nil
+}
+
+// sealDataKey seals the data encryption key with a new salt.
+func (k *EncryptedKeystore) sealDataKey(dataKey []byte, passphrase []byte) (*encryptedParams, error) {
+	kdf, err := newKDFParams(&k.options)
+	if err != nil {
+		return nil, err
+	}
+
+	params := &encryptedParams{
+		Version:   encryptedKeystoreVersion,
+		kdfParams: *kdf,
+	}
+
+	wrapping, err := enc.NewSecretbox(deriveKey(kdf, passphrase))
+	if err != nil {
+		return nil, errmsg.ErrEncrypt.Wrap(err)
+	}
+
+	params.DataKey, err = wrapping.Seal(dataKey)
+	if err != nil {
+		return nil, errmsg.ErrEncrypt.Wrap(err)
+	}
+
+	return params, nil
+}
+
+// openDataKeyBytes opens the data encryption key with the passphrase.
+func openDataKeyBytes(params *encryptedParams, passphrase []byte) ([]byte, error) {
+	wrapping, err := enc.NewSecretbox(deriveKey(&params.kdfParams, passphrase))
+	if err != nil {
+		return nil, errmsg.ErrDecrypt.Wrap(err)
+	}
+
+	dataKey, err := wrapping.Open(params.DataKey)
+	if err != nil {
+		return nil, errmsg.ErrKeystorePassphraseInvalid
+	}
+
+	return dataKey, nil
+}
+
+func openDataKey(params *encryptedParams, passphrase []byte) (enc.SharedKey, error) {
+	dataKey, err := openDataKeyBytes(params, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	sharedKey, err := enc.NewSecretbox(dataKey)
+	if err != nil {
+		return nil, errmsg.ErrDecrypt.Wrap(err)
+	}
+
+	return sharedKey, nil
+}
+
+// newKDFParams creates derivation parameters with a new salt.
+func newKDFParams(options *EncryptedKeystoreOptions) (*kdfParams, error) {
+	params := &kdfParams{
+		KDF:     encryptedKeystoreKDF,
+		Salt:    make([]byte, encryptedSaltSize),
+		Time:    options.Time,
+		Memory:  options.Memory,
+		Threads: options.Threads,
+	}
+
+	if err := params.validate(); err != nil {
+		return nil, err
+	}
+
+	if _, err := rand.Read(params.Salt); err != nil {
+		return nil, errmsg.ErrEncrypt.Wrap(err)
+	}
+
+	return params, nil
+}
+
+// validate checks the parameters are within bounds before deriving a key.
+func (p *kdfParams) validate() error {
+	valid := p.KDF == encryptedKeystoreKDF && len(p.Salt) >= encryptedSaltSize &&
+		p.Time >= 1 && p.Time <= maxKDFTime &&
+		p.Memory >= minKDFMemory && p.Memory <= maxKDFMemory &&
+		p.Threads >= 1 && p.Threads <= maxKDFThreads
+
+	if !valid {
+		return errmsg.ErrKDFParamsInvalid
+	}
+
+	return nil
+}
+
+// deriveKey derives a key encryption key from the passphrase.
+func deriveKey(params *kdfParams, passphrase []byte) []byte {
+	return argon2.IDKey(passphrase, params.Salt, params.Time, params.Memory, params.Threads, enc.SecretBoxKeySize)
+}
+
+func encryptedKeyKey(id string) datastore.Key {
+	return encryptedKeysKey.Child(datastore.NewKey(id))
+}
+
+var _ LifecycleInterface = &EncryptedKeystore{}
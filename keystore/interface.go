@@ -17,3 +17,38 @@ type Interface interface {
 
 	Verify(signature []byte, publicKey crypto.PubKey, data []byte) error
 }
+
+// TypedInterface is implemented by keystores able to create keys of several
+// types.
+type TypedInterface interface {
+	Interface
+
+	// CreateKeyWithType creates a new key of the given type.
+	CreateKeyWithType(ctx context.Context, id string, keyType KeyType) (crypto.PrivKey, error)
+
+	// PutKey stores an existing key, such as a libp2p identity key.
+	PutKey(ctx context.Context, id string, key crypto.PrivKey) error
+}
+
+// LifecycleInterface is implemented by keystores able to manage the lifecycle
+// of their keys.
+type LifecycleInterface interface {
+	TypedInterface
+
+	// ListKeys returns the IDs of the stored keys.
+	ListKeys(ctx context.Context) ([]string, error)
+
+	// DeleteKey removes a key from the keystore.
+	DeleteKey(ctx context.Context, id string) error
+
+	// ExportKey returns a key encrypted with a passphrase, it can be
+	// imported in any keystore.
+	ExportKey(ctx context.Context, id string, passphrase []byte) ([]byte, error)
+
+	// ImportKey stores a key exported by ExportKey and returns its ID.
+	ImportKey(ctx context.Context, data []byte, passphrase []byte) (string, error)
+
+	// RotateKey replaces a key by a new key of the given type, the returned
+	// rotation is signed by the previous key.
+	RotateKey(ctx context.Context, id string, keyType KeyType) (*KeyRotation, error)
+}
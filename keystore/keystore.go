@@ -3,11 +3,12 @@ package keystore // import "berty.tech/go-ipfs-log/keystore"
 
 import (
 	"context"
-	"crypto/rand"
 	"encoding/base64"
+	"strings"
 
 	lru "github.com/hashicorp/golang-lru"
 	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
 	"github.com/libp2p/go-libp2p/core/crypto"
 
 	"berty.tech/go-ipfs-log/errmsg"
@@ -68,26 +69,39 @@ func (k *Keystore) HasKey(ctx context.Context, id string) (bool, error) {
 	return storedKey != nil, nil
 }
 
-// CreateKey creates a new key in the key store.
+// CreateKey creates a new Secp256k1 key in the key store.
 func (k *Keystore) CreateKey(ctx context.Context, id string) (crypto.PrivKey, error) {
-	// FIXME: I kept Secp256k1 for compatibility with OrbitDB, should we change this?
-	priv, _, err := crypto.GenerateSecp256k1Key(rand.Reader)
+	return k.CreateKeyWithType(ctx, id, KeyTypeDefault)
+}
+
+// CreateKeyWithType creates a new key of the given type in the key store.
+func (k *Keystore) CreateKeyWithType(ctx context.Context, id string, keyType KeyType) (crypto.PrivKey, error) {
+	priv, err := generateKey(keyType)
 	if err != nil {
-		return nil, errmsg.ErrKeyGenerationFailed.Wrap(err)
+		return nil, err
+	}
+
+	if err := k.PutKey(ctx, id, priv); err != nil {
+		return nil, err
 	}
 
-	keyBytes, err := priv.Raw()
+	return priv, nil
+}
+
+// PutKey stores an existing key in the key store.
+func (k *Keystore) PutKey(ctx context.Context, id string, key crypto.PrivKey) error {
+	keyBytes, err := marshalPrivateKey(key)
 	if err != nil {
-		return nil, errmsg.ErrInvalidPrivKeyFormat.Wrap(err)
+		return err
 	}
 
 	if err := k.store.Put(ctx, datastore.NewKey(id), keyBytes); err != nil {
-		return nil, errmsg.ErrKeyStorePutFailed.Wrap(err)
+		return errmsg.ErrKeyStorePutFailed.Wrap(err)
 	}
 
 	k.cache.Add(id, base64.StdEncoding.EncodeToString(keyBytes))
 
-	return priv, nil
+	return nil
 }
 
 // GetKey retrieves a key from the keystore.
@@ -110,12 +124,84 @@ func (k *Keystore) GetKey(ctx context.Context, id string) (crypto.PrivKey, error
 		}
 	}
 
-	privateKey, err := crypto.UnmarshalSecp256k1PrivateKey(keyBytes)
+	return unmarshalPrivateKey(keyBytes)
+}
+
+// ListKeys returns the IDs of the stored keys.
+func (k *Keystore) ListKeys(ctx context.Context) ([]string, error) {
+	results, err := k.store.Query(ctx, query.Query{KeysOnly: true})
 	if err != nil {
-		return nil, errmsg.ErrInvalidPrivKeyFormat.Wrap(err)
+		return nil, errmsg.ErrKeyNotInKeystore.Wrap(err)
+	}
+
+	entries, err := results.Rest()
+	if err != nil {
+		return nil, errmsg.ErrKeyNotInKeystore.Wrap(err)
+	}
+
+	ids := make([]string, len(entries))
+	for i, e := range entries {
+		ids[i] = strings.TrimPrefix(e.Key, "/")
+	}
+
+	return ids, nil
+}
+
+// DeleteKey removes a key from the keystore.
+func (k *Keystore) DeleteKey(ctx context.Context, id string) error {
+	if err := k.store.Delete(ctx, datastore.NewKey(id)); err != nil {
+		return errmsg.ErrKeyStoreDeleteFailed.Wrap(err)
+	}
+
+	k.cache.Remove(id)
+
+	return nil
+}
+
+// ExportKey returns a key encrypted with a passphrase.
+func (k *Keystore) ExportKey(ctx context.Context, id string, passphrase []byte) ([]byte, error) {
+	key, err := k.GetKey(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	options := (*EncryptedKeystoreOptions)(nil).withDefaults()
+
+	return exportKey(id, key, passphrase, &options)
+}
+
+// ImportKey stores a key exported by ExportKey and returns its ID.
+func (k *Keystore) ImportKey(ctx context.Context, data []byte, passphrase []byte) (string, error) {
+	id, key, err := importKey(data, passphrase)
+	if err != nil {
+		return "", err
+	}
+
+	if err := k.PutKey(ctx, id, key); err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
+
+// RotateKey replaces a key by a new key of the given type, the previous key
+// is discarded and must be exported beforehand to be kept.
+func (k *Keystore) RotateKey(ctx context.Context, id string, keyType KeyType) (*KeyRotation, error) {
+	previous, err := k.GetKey(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	next, rotation, err := rotateKey(id, previous, keyType)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := k.PutKey(ctx, id, next); err != nil {
+		return nil, err
 	}
 
-	return privateKey, nil
+	return rotation, nil
 }
 
-var _ Interface = &Keystore{}
+var _ LifecycleInterface = &Keystore{}
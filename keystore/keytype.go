@@ -0,0 +1,103 @@
+package keystore // import "berty.tech/go-ipfs-log/keystore"
+
+import (
+	"crypto/rand"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+
+	"berty.tech/go-ipfs-log/errmsg"
+)
+
+// KeyType is the type of the keys created by a keystore.
+type KeyType int
+
+const (
+	// KeyTypeDefault creates Secp256k1 keys, for compatibility with OrbitDB.
+	KeyTypeDefault KeyType = iota
+
+	KeyTypeSecp256k1
+	KeyTypeEd25519
+
+	// KeyTypeECDSA creates ECDSA keys on the P-256 curve.
+	KeyTypeECDSA
+)
+
+// rawSecp256k1KeySize is the size of the raw Secp256k1 keys stored by
+// previous versions of the keystore, the keys encoded with their type are
+// always larger.
+const rawSecp256k1KeySize = 32
+
+func (t KeyType) String() string {
+	switch t {
+	case KeyTypeDefault, KeyTypeSecp256k1:
+		return "Secp256k1"
+	case KeyTypeEd25519:
+		return "Ed25519"
+	case KeyTypeECDSA:
+		return "ECDSA"
+	default:
+		return "unknown"
+	}
+}
+
+// generateKey creates a private key of the given type.
+func generateKey(keyType KeyType) (crypto.PrivKey, error) {
+	var (
+		priv crypto.PrivKey
+		err  error
+	)
+
+	switch keyType {
+	case KeyTypeDefault, KeyTypeSecp256k1:
+		priv, _, err = crypto.GenerateSecp256k1Key(rand.Reader)
+	case KeyTypeEd25519:
+		priv, _, err = crypto.GenerateEd25519Key(rand.Reader)
+	case KeyTypeECDSA:
+		priv, _, err = crypto.GenerateECDSAKeyPair(rand.Reader)
+	default:
+		return nil, errmsg.ErrKeyTypeNotSupported
+	}
+
+	if err != nil {
+		return nil, errmsg.ErrKeyGenerationFailed.Wrap(err)
+	}
+
+	return priv, nil
+}
+
+// marshalPrivateKey encodes a private key along with its libp2p type.
+func marshalPrivateKey(key crypto.PrivKey) ([]byte, error) {
+	switch key.Type() {
+	case crypto.Secp256k1, crypto.Ed25519, crypto.ECDSA:
+	default:
+		return nil, errmsg.ErrKeyTypeNotSupported
+	}
+
+	data, err := crypto.MarshalPrivateKey(key)
+	if err != nil {
+		return nil, errmsg.ErrInvalidPrivKeyFormat.Wrap(err)
+	}
+
+	return data, nil
+}
+
+// unmarshalPrivateKey decodes a private key encoded by marshalPrivateKey, or
+// a raw Secp256k1 key stored by a previous version of the keystore.
+func unmarshalPrivateKey(data []byte) (crypto.PrivKey, error) {
+	var (
+		key crypto.PrivKey
+		err error
+	)
+
+	if len(data) == rawSecp256k1KeySize {
+		key, err = crypto.UnmarshalSecp256k1PrivateKey(data)
+	} else {
+		key, err = crypto.UnmarshalPrivateKey(data)
+	}
+
+	if err != nil {
+		return nil, errmsg.ErrInvalidPrivKeyFormat.Wrap(err)
+	}
+
+	return key, nil
+}
@@ -0,0 +1,205 @@
+package keystore // import "berty.tech/go-ipfs-log/keystore"
+
+import (
+	"encoding/json"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+
+	"berty.tech/go-ipfs-log/enc"
+	"berty.tech/go-ipfs-log/errmsg"
+)
+
+const exportedKeyVersion = 1
+
+// exportedKey is the portable format of an exported key, the key is sealed
+// with a key derived from the export passphrase.
+type exportedKey struct {
+	Version int `json:"version"`
+	kdfParams
+	Key []byte `json:"key"`
+}
+
+// KeyRotation links the new key of an ID to the previous one, it is signed
+// by the previous key.
+type KeyRotation struct {
+	ID          string `json:"id"`
+	PreviousKey []byte `json:"previousKey"`
+	NewKey      []byte `json:"newKey"`
+	Signature   []byte `json:"signature,omitempty"`
+}
+
+// PreviousPublicKey returns the retired public key.
+func (r *KeyRotation) PreviousPublicKey() (crypto.PubKey, error) {
+	pubKey, err := crypto.UnmarshalPublicKey(r.PreviousKey)
+	if err != nil {
+		return nil, errmsg.ErrKeyRotationInvalid.Wrap(err)
+	}
+
+	return pubKey, nil
+}
+
+// NewPublicKey returns the public key replacing the previous one.
+func (r *KeyRotation) NewPublicKey() (crypto.PubKey, error) {
+	pubKey, err := crypto.UnmarshalPublicKey(r.NewKey)
+	if err != nil {
+		return nil, errmsg.ErrKeyRotationInvalid.Wrap(err)
+	}
+
+	return pubKey, nil
+}
+
+// Verify checks that the rotation has been signed by the previous key.
+func (r *KeyRotation) Verify() error {
+	previous, err := r.PreviousPublicKey()
+	if err != nil {
+		return err
+	}
+
+	if _, err := r.NewPublicKey(); err != nil {
+		return err
+	}
+
+	payload, err := r.payload()
+	if err != nil {
+		return err
+	}
+
+	ok, err := previous.Verify(payload, r.Signature)
+	if err != nil {
+		return errmsg.ErrKeyRotationInvalid.Wrap(err)
+	}
+
+	if !ok {
+		return errmsg.ErrKeyRotationInvalid
+	}
+
+	return nil
+}
+
+// payload returns the signed content of the rotation.
+func (r *KeyRotation) payload() ([]byte, error) {
+	payload, err := json.Marshal(&KeyRotation{
+		ID:          r.ID,
+		PreviousKey: r.PreviousKey,
+		NewKey:      r.NewKey,
+	})
+	if err != nil {
+		return nil, errmsg.ErrKeyRotationInvalid.Wrap(err)
+	}
+
+	return payload, nil
+}
+
+// rotateKey creates a new key for an ID and signs the rotation with the
+// previous key.
+func rotateKey(id string, previous crypto.PrivKey, keyType KeyType) (crypto.PrivKey, *KeyRotation, error) {
+	next, err := generateKey(keyType)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	previousBytes, err := crypto.MarshalPublicKey(previous.GetPublic())
+	if err != nil {
+		return nil, nil, errmsg.ErrPubKeySerialization.Wrap(err)
+	}
+
+	nextBytes, err := crypto.MarshalPublicKey(next.GetPublic())
+	if err != nil {
+		return nil, nil, errmsg.ErrPubKeySerialization.Wrap(err)
+	}
+
+	rotation := &KeyRotation{
+		ID:          id,
+		PreviousKey: previousBytes,
+		NewKey:      nextBytes,
+	}
+
+	payload, err := rotation.payload()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rotation.Signature, err = previous.Sign(payload)
+	if err != nil {
+		return nil, nil, errmsg.ErrSigSign.Wrap(err)
+	}
+
+	return next, rotation, nil
+}
+
+// exportKey seals a key and its ID with a key derived from the passphrase.
+func exportKey(id string, key crypto.PrivKey, passphrase []byte, options *EncryptedKeystoreOptions) ([]byte, error) {
+	keyBytes, err := marshalPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(&encryptedKey{ID: id, Key: keyBytes})
+	if err != nil {
+		return nil, errmsg.ErrInvalidPrivKeyFormat.Wrap(err)
+	}
+
+	kdf, err := newKDFParams(options)
+	if err != nil {
+		return nil, err
+	}
+
+	sharedKey, err := enc.NewSecretbox(deriveKey(kdf, passphrase))
+	if err != nil {
+		return nil, errmsg.ErrEncrypt.Wrap(err)
+	}
+
+	sealed, err := sharedKey.Seal(data)
+	if err != nil {
+		return nil, errmsg.ErrEncrypt.Wrap(err)
+	}
+
+	exported, err := json.Marshal(&exportedKey{
+		Version:   exportedKeyVersion,
+		kdfParams: *kdf,
+		Key:       sealed,
+	})
+	if err != nil {
+		return nil, errmsg.ErrEncrypt.Wrap(err)
+	}
+
+	return exported, nil
+}
+
+// importKey opens a key exported by exportKey.
+func importKey(data []byte, passphrase []byte) (string, crypto.PrivKey, error) {
+	exported := &exportedKey{}
+	if err := json.Unmarshal(data, exported); err != nil {
+		return "", nil, errmsg.ErrKeyExportInvalid.Wrap(err)
+	}
+
+	if exported.Version != exportedKeyVersion {
+		return "", nil, errmsg.ErrKeyExportInvalid
+	}
+
+	if err := exported.validate(); err != nil {
+		return "", nil, errmsg.ErrKeyExportInvalid.Wrap(err)
+	}
+
+	sharedKey, err := enc.NewSecretbox(deriveKey(&exported.kdfParams, passphrase))
+	if err != nil {
+		return "", nil, errmsg.ErrDecrypt.Wrap(err)
+	}
+
+	opened, err := sharedKey.Open(exported.Key)
+	if err != nil {
+		return "", nil, errmsg.ErrKeystorePassphraseInvalid
+	}
+
+	var stored encryptedKey
+	if err := json.Unmarshal(opened, &stored); err != nil {
+		return "", nil, errmsg.ErrKeyExportInvalid.Wrap(err)
+	}
+
+	key, err := unmarshalPrivateKey(stored.Key)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return stored.ID, key, nil
+}
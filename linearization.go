@@ -0,0 +1,160 @@
+package ipfslog // import "berty.tech/go-ipfs-log"
+
+import (
+	"sync"
+
+	"berty.tech/go-ipfs-log/entry/sorting"
+	"berty.tech/go-ipfs-log/iface"
+)
+
+// linearization caches the entries of the log in the order returned by
+// Values, so that it is not traversed from its heads on every call.
+//
+// It is updated in place on Append, merged with the new entries on Join when
+// the log uses the default sort function, and rebuilt from the heads when
+// it has been invalidated.
+type linearization struct {
+	lock    sync.Mutex
+	entries []iface.IPFSLogEntry
+	keys    []string
+	valid   bool
+
+	// index maps the keys to their position, it is built on first use.
+	index map[string]int
+
+	// merge is set when the sort function is known to order entries after
+	// the ones they reference, which makes the traversal order identical to
+	// the sort order.
+	merge bool
+}
+
+// linearized returns the entries of the log in the order of Values along
+// with their keys, the returned slices must not be modified.
+func (l *IPFSLog) linearized() ([]iface.IPFSLogEntry, []string) {
+	// l.lock must be RLocked
+
+	l.linear.lock.Lock()
+	defer l.linear.lock.Unlock()
+
+	if !l.linear.valid {
+		var entries []iface.IPFSLogEntry
+		var keys []string
+
+		if l.heads != nil {
+			stack, _ := l.traverse(l.heads, -1, "")
+			keys = stack.Reverse().Keys()
+			entries = stack.Slice()
+		}
+
+		l.linear.entries = entries
+		l.linear.keys = keys
+		l.linear.index = nil
+		l.linear.valid = true
+	}
+
+	entries, keys := l.linear.entries, l.linear.keys
+
+	return entries[:len(entries):len(entries)], keys[:len(keys):len(keys)]
+}
+
+// linearAppend adds an entry referencing all the previous heads of the log.
+func (l *IPFSLog) linearAppend(e iface.IPFSLogEntry) {
+	// l.lock must be Locked
+
+	l.linear.lock.Lock()
+	defer l.linear.lock.Unlock()
+
+	if l.linear.valid {
+		l.linear.entries = append(l.linear.entries, e)
+		l.linear.keys = append(l.linear.keys, e.GetHash().String())
+
+		if l.linear.index != nil {
+			l.linear.index[e.GetHash().String()] = len(l.linear.keys) - 1
+		}
+	}
+}
+
+// linearPosition returns the entries of the log in the order of Values along
+// with the position of an entry in them, if it is in the log.
+func (l *IPFSLog) linearPosition(key string) ([]iface.IPFSLogEntry, int, bool) {
+	// l.lock must be RLocked
+
+	entries, keys := l.linearized()
+
+	l.linear.lock.Lock()
+	defer l.linear.lock.Unlock()
+
+	if l.linear.index == nil {
+		l.linear.index = make(map[string]int, len(keys))
+		for i, k := range keys {
+			l.linear.index[k] = i
+		}
+	}
+
+	pos, ok := l.linear.index[key]
+
+	return entries, pos, ok
+}
+
+// linearMerge adds entries joined from another log, keeping the sort order.
+func (l *IPFSLog) linearMerge(added []iface.IPFSLogEntry) {
+	// l.lock must be Locked
+
+	l.linear.lock.Lock()
+	defer l.linear.lock.Unlock()
+
+	if !l.linear.valid || len(added) == 0 {
+		return
+	}
+
+	l.linear.index = nil
+
+	if !l.linear.merge {
+		l.linear.valid = false
+		l.linear.entries = nil
+		l.linear.keys = nil
+		return
+	}
+
+	added = append([]iface.IPFSLogEntry(nil), added...)
+	sorting.Sort(l.SortFn, added, false)
+
+	current, currentKeys := l.linear.entries, l.linear.keys
+	merged := make([]iface.IPFSLogEntry, 0, len(current)+len(added))
+	mergedKeys := make([]string, 0, len(current)+len(added))
+
+	i, j := 0, 0
+	for i < len(current) && j < len(added) {
+		if ret, err := l.SortFn(current[i], added[j]); err == nil && ret < 0 {
+			merged = append(merged, current[i])
+			mergedKeys = append(mergedKeys, currentKeys[i])
+			i++
+		} else {
+			merged = append(merged, added[j])
+			mergedKeys = append(mergedKeys, added[j].GetHash().String())
+			j++
+		}
+	}
+
+	merged = append(merged, current[i:]...)
+	mergedKeys = append(mergedKeys, currentKeys[i:]...)
+
+	for ; j < len(added); j++ {
+		merged = append(merged, added[j])
+		mergedKeys = append(mergedKeys, added[j].GetHash().String())
+	}
+
+	l.linear.entries = merged
+	l.linear.keys = mergedKeys
+}
+
+// linearInvalidate discards the cached order, it is rebuilt on next use.
+func (l *IPFSLog) linearInvalidate() {
+	l.linear.lock.Lock()
+	defer l.linear.lock.Unlock()
+
+	l.linear.valid = false
+	l.linear.entries = nil
+	l.linear.keys = nil
+	l.linear.index = nil
+}
@@ -9,7 +9,7 @@ import (
 	"time"
 
 	"github.com/ipfs/go-cid"
-	coreiface "github.com/ipfs/kubo/core/coreiface"
+	format "github.com/ipfs/go-ipld-format"
 
 	"berty.tech/go-ipfs-log/accesscontroller"
 	"berty.tech/go-ipfs-log/entry"
@@ -32,7 +32,7 @@ type AppendOptions = iface.AppendOptions
 type SortFn = iface.EntrySortFn
 
 type IPFSLog struct {
-	Storage          coreiface.CoreAPI
+	Storage          iface.Storage
 	ID               string
 	AccessController accesscontroller.Interface
 	SortFn           iface.EntrySortFn
@@ -42,8 +42,14 @@ type IPFSLog struct {
 	Next             iface.IPFSLogOrderedEntries
 	Clock            iface.IPFSLogLamportClock
 	io               iface.IO
+	index            iface.IPFSLogIndex
+	events           eventBus
+	linear           linearization
 	concurrency      uint
 	lock             sync.RWMutex
+
+	// accessControllerV2 takes precedence over AccessController when set
+	accessControllerV2 accesscontroller.InterfaceV2
 }
 
 func (l *IPFSLog) Len() int {
@@ -93,14 +99,19 @@ func maxClockTimeForEntries(entries []iface.IPFSLogEntry, defValue int) int {
 //
 // Returns a log instance.
 //
-// ipfs is an instance of IPFS.
+// services is the block storage used to persist the entries, see the
+// storage package for adapters.
 //
 // identity is an instance of Identity and will be used to sign entries
 // Usually this should be a user id or similar.
 //
 // options.AccessController is an instance of accesscontroller.Interface,
 // which by default allows anyone to append to the IPFSLog.
-func NewLog(services coreiface.CoreAPI, identity *identityprovider.Identity, options *LogOptions) (*IPFSLog, error) {
+// options.AccessControllerV2 replaces it when set.
+//
+// options.Index persists the state of the log, when set the log is reopened
+// from it and options.Entries is ignored.
+func NewLog(services iface.Storage, identity *identityprovider.Identity, options *LogOptions) (*IPFSLog, error) {
 	if services == nil {
 		return nil, errmsg.ErrIPFSNotDefined
 	}
@@ -117,10 +128,27 @@ func NewLog(services coreiface.CoreAPI, identity *identityprovider.Identity, opt
 		options.ID = strconv.FormatInt(time.Now().Unix()/1000, 10)
 	}
 
+	// joined entries can only be merged in the cached order of the log
+	// with the default sort function
+	mergeJoined := options.SortFn == nil
+
 	if options.SortFn == nil {
 		options.SortFn = sorting.LastWriteWins
 	}
 
+	if options.Index != nil {
+		if len(options.Heads) == 0 {
+			heads, err := options.Index.Heads()
+			if err != nil {
+				return nil, err
+			}
+
+			options.Heads = heads
+		} else if err := options.Index.SetHeads(options.Heads); err != nil {
+			return nil, err
+		}
+	}
+
 	maxTime := 0
 	if options.Clock != nil {
 		maxTime = options.Clock.GetTime()
@@ -131,7 +159,9 @@ func NewLog(services coreiface.CoreAPI, identity *identityprovider.Identity, opt
 		options.AccessController = &accesscontroller.Default{}
 	}
 
-	if options.Entries == nil {
+	if options.Index != nil {
+		options.Entries = options.Index.Entries()
+	} else if options.Entries == nil {
 		options.Entries = entry.NewOrderedMap()
 	}
 
@@ -152,11 +182,20 @@ func NewLog(services coreiface.CoreAPI, identity *identityprovider.Identity, opt
 		options.IO = io
 	}
 
-	next := entry.NewOrderedMap()
-	for _, key := range options.Entries.Keys() {
-		e := options.Entries.UnsafeGet(key)
-		for _, n := range e.GetNext() {
-			next.Set(n.String(), e)
+	var entries, next iface.IPFSLogOrderedEntries
+	if options.Index != nil {
+		// the index already holds the reverse index, and is not copied
+		// as it must keep track of the changes
+		entries = options.Entries
+		next = options.Index.Next()
+	} else {
+		entries = options.Entries.Copy()
+		next = entry.NewOrderedMap()
+		for _, key := range options.Entries.Keys() {
+			e := options.Entries.UnsafeGet(key)
+			for _, n := range e.GetNext() {
+				next.Set(n.String(), e)
+			}
 		}
 	}
 
@@ -166,15 +205,30 @@ func NewLog(services coreiface.CoreAPI, identity *identityprovider.Identity, opt
 		Identity:         identity,
 		AccessController: options.AccessController,
 		SortFn:           sorting.NoZeroes(options.SortFn),
-		Entries:          options.Entries.Copy(),
+		Entries:          entries,
 		heads:            entry.NewOrderedMapFromEntries(options.Heads),
 		Next:             next,
 		Clock:            entry.NewLamportClock(identity.PublicKey, maxTime),
 		io:               options.IO,
+		index:            options.Index,
+		linear:           linearization{merge: mergeJoined},
 		concurrency:      options.Concurrency,
+
+		accessControllerV2: options.AccessControllerV2,
 	}, nil
 }
 
+// persistHeads saves the heads in the index, if any
+func (l *IPFSLog) persistHeads() error {
+	// l.lock must be locked
+
+	if l.index == nil {
+		return nil
+	}
+
+	return l.index.SetHeads(l.heads.Slice())
+}
+
 func (l *IPFSLog) SetIdentity(identity *identityprovider.Identity) {
 	l.lock.Lock()
 	defer l.lock.Unlock()
@@ -369,11 +423,12 @@ func (l *IPFSLog) Append(ctx context.Context, payload []byte, opts *AppendOption
 	// @TODO: Split Entry.create into creating object, checking permission, signing and then posting to IPFS
 	// Create the entry and add it to the internal cache
 	e, err := entry.CreateEntryWithIO(ctx, l.Storage, l.Identity, &entry.Entry{
-		LogID:   l.ID,
-		Payload: payload,
-		Next:    next,
-		Clock:   entry.NewLamportClock(l.Clock.GetID(), l.Clock.GetTime()),
-		Refs:    refs,
+		LogID:          l.ID,
+		Payload:        payload,
+		Next:           next,
+		Clock:          entry.NewLamportClock(l.Clock.GetID(), l.Clock.GetTime()),
+		Refs:           refs,
+		AdditionalData: opts.AdditionalData,
 	}, &iface.CreateEntryOptions{
 		Pin: opts.Pin,
 	}, l.io)
@@ -382,7 +437,7 @@ func (l *IPFSLog) Append(ctx context.Context, payload []byte, opts *AppendOption
 		return nil, errmsg.ErrLogAppendFailed.Wrap(err)
 	}
 
-	if err := l.AccessController.CanAppend(e, l.Identity.Provider, &CanAppendContext{log: l}); err != nil {
+	if err := l.canAppend(ctx, e, newCanAppendContext(l, nil)); err != nil {
 		return nil, errmsg.ErrLogAppendDenied.Wrap(err)
 	}
 
@@ -393,25 +448,105 @@ func (l *IPFSLog) Append(ctx context.Context, payload []byte, opts *AppendOption
 	}
 
 	l.heads = entry.NewOrderedMapFromEntries([]iface.IPFSLogEntry{e})
+	l.linearAppend(e)
+
+	if err := l.persistHeads(); err != nil {
+		return nil, errmsg.ErrLogAppendFailed.Wrap(err)
+	}
+
+	l.events.emit(EventAppended{Entry: e})
+	l.events.emit(EventHeadsReplaced{Heads: l.heads.Slice()})
 
 	return e, nil
 }
 
+// canAppend checks an entry with the access controller of the log.
+func (l *IPFSLog) canAppend(ctx context.Context, e iface.IPFSLogEntry, view *CanAppendContext) error {
+	// l.lock must be Locked
+
+	ac := l.accessControllerV2
+	if ac == nil {
+		ac = accesscontroller.FromV1(l.AccessController)
+	}
+
+	return ac.CanAppendV2(ctx, e, l.Identity.Provider, view)
+}
+
+// CanAppendContext is the view of the log given to its access controller.
 type CanAppendContext struct {
-	log *IPFSLog
+	log    *IPFSLog
+	joined map[string]iface.IPFSLogEntry
+}
+
+func newCanAppendContext(log *IPFSLog, joined []iface.IPFSLogEntry) *CanAppendContext {
+	c := &CanAppendContext{
+		log:    log,
+		joined: map[string]iface.IPFSLogEntry{},
+	}
+
+	for _, e := range joined {
+		c.joined[e.GetHash().String()] = e
+	}
+
+	return c
 }
 
+// GetLogEntries returns the entries of the log, along with the entries being
+// joined if any.
 func (c *CanAppendContext) GetLogEntries() []accesscontroller.LogEntry {
 	logEntries := c.log.Entries.Slice()
 
-	var entries = make([]accesscontroller.LogEntry, len(logEntries))
+	var entries = make([]accesscontroller.LogEntry, len(logEntries), len(logEntries)+len(c.joined))
 	for i := range logEntries {
 		entries[i] = logEntries[i]
 	}
 
+	for _, e := range c.joined {
+		entries = append(entries, e)
+	}
+
 	return entries
 }
 
+// GetLogID returns the ID of the log.
+func (c *CanAppendContext) GetLogID() string {
+	return c.log.ID
+}
+
+// GetEntry returns an entry of the log or being joined.
+func (c *CanAppendContext) GetEntry(h cid.Cid) (accesscontroller.CausalLogEntry, bool) {
+	if e, ok := c.log.Entries.Get(h.String()); ok {
+		return e, true
+	}
+
+	e, ok := c.joined[h.String()]
+	if !ok {
+		return nil, false
+	}
+
+	return e, true
+}
+
+// GetAncestors returns the entries of the log or being joined preceding an
+// entry.
+func (c *CanAppendContext) GetAncestors(ctx context.Context, e accesscontroller.CausalLogEntry) ([]accesscontroller.CausalLogEntry, error) {
+	return accesscontroller.CollectAncestors(ctx, c.GetEntry, e)
+}
+
+// GetHeads returns the heads of the log, before the join if any.
+func (c *CanAppendContext) GetHeads() []accesscontroller.CausalLogEntry {
+	heads := c.log.heads.Slice()
+
+	entries := make([]accesscontroller.CausalLogEntry, len(heads))
+	for i := range heads {
+		entries[i] = heads[i]
+	}
+
+	return entries
+}
+
+var _ accesscontroller.LogView = &CanAppendContext{}
+
 /* Iterator Provides entries values on a channel */
 func (l *IPFSLog) Iterator(options *IteratorOptions, output chan<- iface.IPFSLogEntry) error {
 	amount := -1
@@ -431,6 +566,25 @@ func (l *IPFSLog) Iterator(options *IteratorOptions, output chan<- iface.IPFSLog
 	}
 
 	l.lock.RLock()
+
+	// without filters, the entries are the last ones of the cached order
+	if options.LTE == nil && options.LT == nil && !options.GTE.Defined() && !options.GT.Defined() {
+		linearized, _ := l.linearized()
+		l.lock.RUnlock()
+
+		if amount < 0 || amount > len(linearized) {
+			amount = len(linearized)
+		}
+
+		for i := len(linearized) - 1; i >= len(linearized)-amount; i-- {
+			output <- linearized[i]
+		}
+
+		close(output)
+
+		return nil
+	}
+
 	start := l.sortedHeads(l.heads.Slice()).Slice()
 
 	if options.LTE != nil {
@@ -524,102 +678,37 @@ func (l *IPFSLog) Join(otherLog iface.IPFSLog, size int) (iface.IPFSLog, error)
 		return l, nil
 	}
 
-	l.lock.Lock()
-	defer l.lock.Unlock()
-
-	newItems := difference(otherLog.GetEntries(), otherLog.RawHeads().Slice(), l)
-
-	wg := &sync.WaitGroup{}
-	wg.Add(newItems.Len())
-	var err error
-
-	// TODO: use l.concurrency ?
-	for _, k := range newItems.Keys() {
-		go func(k string) {
-			defer wg.Done()
-
-			e := newItems.UnsafeGet(k)
-			if e == nil || !e.Defined() {
-				err = errmsg.ErrLogJoinFailed
-				return
-			}
-
-			if inErr := l.AccessController.CanAppend(e, l.Identity.Provider, &CanAppendContext{log: l}); inErr != nil {
-				err = inErr
-				return
-			}
-
-			if inErr := e.Verify(l.Identity.Provider, l.IO()); inErr != nil {
-				err = errmsg.ErrSigNotVerified.Wrap(inErr)
-				return
-			}
-		}(k)
-	}
-
-	wg.Wait()
-	if err != nil {
-		return nil, errmsg.ErrLogJoinFailed.Wrap(err)
+	if _, err := l.JoinWithOptions(context.Background(), otherLog, &JoinOptions{Size: &size}); err != nil {
+		return nil, err
 	}
 
-	for _, k := range newItems.Keys() {
-		e := newItems.UnsafeGet(k)
-		for _, next := range e.GetNext() {
-			l.Next.Set(next.String(), e)
-		}
+	return l, nil
+}
 
-		l.Entries.Set(e.GetHash().String(), e)
+func equalKeys(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
 	}
 
-	nextsFromNewItems := map[string]struct{}{}
-	for _, k := range newItems.Keys() {
-		e := newItems.UnsafeGet(k)
-		for _, n := range e.GetNext() {
-			nextsFromNewItems[n.String()] = struct{}{}
-		}
+	keys := map[string]struct{}{}
+	for _, k := range a {
+		keys[k] = struct{}{}
 	}
 
-	mergedHeads := entry.FindHeads(l.heads.Merge(otherLog.RawHeads()))
-
-	for idx, e := range mergedHeads {
-		// notReferencedByNewItems
-		if _, ok := nextsFromNewItems[e.GetHash().String()]; ok {
-			mergedHeads[idx] = nil
-		}
-
-		// notInCurrentNexts
-		if _, ok := l.Next.Get(e.GetHash().String()); ok {
-			mergedHeads[idx] = nil
+	for _, k := range b {
+		if _, ok := keys[k]; !ok {
+			return false
 		}
 	}
 
-	l.heads = entry.NewOrderedMapFromEntries(mergedHeads)
-
-	if size > -1 {
-		tmp := l.values().Slice()
-		tmp = tmp[len(tmp)-size:]
-
-		entries := entry.NewOrderedMapFromEntries(tmp)
-		heads := entry.NewOrderedMapFromEntries(entry.FindHeads(entry.NewOrderedMapFromEntries(tmp)))
-
-		l.Entries = entries
-		l.heads = heads
-	}
-
-	// Find the latest clock from the heads
-	headsSlice := l.heads.Slice()
-	clockID := l.Clock.GetID()
-
-	maxClock := maxClockTimeForEntries(headsSlice, 0)
-	clockTime := maxInt(l.Clock.GetTime(), maxClock)
-
-	l.Clock = entry.NewLamportClock(clockID, clockTime)
-
-	return l, nil
+	return true
 }
 
-func difference(entriesA iface.IPFSLogOrderedEntries, headsA []iface.IPFSLogEntry, logB *IPFSLog) iface.IPFSLogOrderedEntries {
+// difference returns the entries of A which are not in the log B, along with
+// the ones which were skipped as they belong to another log.
+func difference(entriesA iface.IPFSLogOrderedEntries, headsA []iface.IPFSLogEntry, logB *IPFSLog) (iface.IPFSLogOrderedEntries, []iface.IPFSLogEntry) {
 	if entriesA.Len() == 0 || len(headsA) == 0 || logB == nil {
-		return entry.NewOrderedMap()
+		return entry.NewOrderedMap(), nil
 	}
 
 	if logB.Entries == nil {
@@ -632,6 +721,7 @@ func difference(entriesA iface.IPFSLogOrderedEntries, headsA []iface.IPFSLogEntr
 	}
 	traversed := map[string]struct{}{}
 	res := entry.NewOrderedMap()
+	var foreign []iface.IPFSLogEntry
 
 	for {
 		if len(stack) == 0 {
@@ -655,10 +745,12 @@ func difference(entriesA iface.IPFSLogOrderedEntries, headsA []iface.IPFSLogEntr
 					traversed[hash] = struct{}{}
 				}
 			}
+		} else if okA && !okB {
+			foreign = append(foreign, eA)
 		}
 	}
 
-	return res
+	return res, foreign
 }
 
 // ToString Returns the log values as a nicely formatted string
@@ -666,13 +758,14 @@ func difference(entriesA iface.IPFSLogOrderedEntries, headsA []iface.IPFSLogEntr
 // payloadMapper is a function to customize text representation,
 // use nil to use the default mapper which convert the payload as a string
 func (l *IPFSLog) ToString(payloadMapper func(iface.IPFSLogEntry) string) string {
-	values := l.Values().Slice()
+	all := l.Values().Slice()
+	values := append([]iface.IPFSLogEntry(nil), all...)
 	sorting.Reverse(values)
 
 	var lines []string
 
 	for _, e := range values {
-		parents := entry.FindChildren(e, l.Values().Slice())
+		parents := entry.FindChildren(e, all)
 		length := len(parents)
 		padding := strings.Repeat("  ", maxInt(length-1, 0))
 		if length > 0 {
@@ -703,6 +796,7 @@ func (l *IPFSLog) ToSnapshot() *Snapshot {
 		ID:     l.ID,
 		Heads:  entrySliceToCids(heads),
 		Values: l.values().Slice(),
+		Clock:  entry.CopyLamportClock(l.Clock),
 	}
 }
 
@@ -733,7 +827,7 @@ func (l *IPFSLog) ToMultihash(ctx context.Context) (cid.Cid, error) {
 // NewFromMultihash Creates a IPFSLog from a hash
 //
 // Creating a log from a hash will retrieve entries from IPFS, thus causing side effects
-func NewFromMultihash(ctx context.Context, services coreiface.CoreAPI, identity *identityprovider.Identity, hash cid.Cid, logOptions *LogOptions, fetchOptions *FetchOptions) (*IPFSLog, error) {
+func NewFromMultihash(ctx context.Context, services iface.Storage, identity *identityprovider.Identity, hash cid.Cid, logOptions *LogOptions, fetchOptions *FetchOptions) (*IPFSLog, error) {
 	if services == nil {
 		return nil, errmsg.ErrIPFSNotDefined
 	}
@@ -760,13 +854,24 @@ func NewFromMultihash(ctx context.Context, services coreiface.CoreAPI, identity
 	}
 
 	data, err := fromMultihash(ctx, services, hash, &FetchOptions{
-		Length:        fetchOptions.Length,
-		Exclude:       fetchOptions.Exclude,
-		ShouldExclude: fetchOptions.ShouldExclude,
-		ProgressChan:  fetchOptions.ProgressChan,
-		Timeout:       fetchOptions.Timeout,
-		Concurrency:   fetchOptions.Concurrency,
-		SortFn:        fetchOptions.SortFn,
+		Length:             fetchOptions.Length,
+		Exclude:            fetchOptions.Exclude,
+		ShouldExclude:      fetchOptions.ShouldExclude,
+		ProgressChan:       fetchOptions.ProgressChan,
+		Timeout:            fetchOptions.Timeout,
+		Concurrency:        fetchOptions.Concurrency,
+		Retries:            fetchOptions.Retries,
+		RetryBackoff:       fetchOptions.RetryBackoff,
+		MaxRetryBackoff:    fetchOptions.MaxRetryBackoff,
+		SinceClockTime:     fetchOptions.SinceClockTime,
+		Frontier:           fetchOptions.Frontier,
+		AccessController:   fetchOptions.AccessController,
+		AccessControllerV2: fetchOptions.AccessControllerV2,
+		VerifySignatures:   fetchOptions.VerifySignatures,
+		Checkpoint:         fetchOptions.Checkpoint,
+		Report:             fetchOptions.Report,
+		Provider:           fetchProvider(identity, fetchOptions.Provider),
+		SortFn:             fetchOptions.SortFn,
 	}, logOptions.IO)
 
 	if err != nil {
@@ -787,19 +892,20 @@ func NewFromMultihash(ctx context.Context, services coreiface.CoreAPI, identity
 	}
 
 	return NewLog(services, identity, &LogOptions{
-		ID:               data.ID,
-		AccessController: logOptions.AccessController,
-		Entries:          entry.NewOrderedMapFromEntries(data.Values),
-		Heads:            heads,
-		SortFn:           logOptions.SortFn,
-		IO:               logOptions.IO,
+		ID:                 data.ID,
+		AccessController:   logOptions.AccessController,
+		AccessControllerV2: logOptions.AccessControllerV2,
+		Entries:            entry.NewOrderedMapFromEntries(data.Values),
+		Heads:              heads,
+		SortFn:             logOptions.SortFn,
+		IO:                 logOptions.IO,
 	})
 }
 
 // NewFromEntryHash Creates a IPFSLog from a hash of an Entry
 //
 // Creating a log from a hash will retrieve entries from IPFS, thus causing side effects
-func NewFromEntryHash(ctx context.Context, services coreiface.CoreAPI, identity *identityprovider.Identity, hash cid.Cid, logOptions *LogOptions, fetchOptions *FetchOptions) (*IPFSLog, error) {
+func NewFromEntryHash(ctx context.Context, services iface.Storage, identity *identityprovider.Identity, hash cid.Cid, logOptions *LogOptions, fetchOptions *FetchOptions) (*IPFSLog, error) {
 	if logOptions == nil {
 		return nil, errmsg.ErrLogOptionsNotDefined
 	}
@@ -817,32 +923,43 @@ func NewFromEntryHash(ctx context.Context, services coreiface.CoreAPI, identity
 		logOptions.IO = io
 	}
 
-	// TODO: need to verify the entries with 'key'
 	entries, err := fromEntryHash(ctx, services, []cid.Cid{hash}, &FetchOptions{
-		Length:        fetchOptions.Length,
-		Exclude:       fetchOptions.Exclude,
-		ShouldExclude: fetchOptions.ShouldExclude,
-		ProgressChan:  fetchOptions.ProgressChan,
-		Timeout:       fetchOptions.Timeout,
-		Concurrency:   fetchOptions.Concurrency,
+		Length:             fetchOptions.Length,
+		Exclude:            fetchOptions.Exclude,
+		ShouldExclude:      fetchOptions.ShouldExclude,
+		ProgressChan:       fetchOptions.ProgressChan,
+		Timeout:            fetchOptions.Timeout,
+		Concurrency:        fetchOptions.Concurrency,
+		Retries:            fetchOptions.Retries,
+		RetryBackoff:       fetchOptions.RetryBackoff,
+		MaxRetryBackoff:    fetchOptions.MaxRetryBackoff,
+		SinceClockTime:     fetchOptions.SinceClockTime,
+		Frontier:           fetchOptions.Frontier,
+		AccessController:   fetchOptions.AccessController,
+		AccessControllerV2: fetchOptions.AccessControllerV2,
+		VerifySignatures:   fetchOptions.VerifySignatures,
+		Checkpoint:         fetchOptions.Checkpoint,
+		Report:             fetchOptions.Report,
+		Provider:           fetchProvider(identity, fetchOptions.Provider),
 	}, logOptions.IO)
 	if err != nil {
 		return nil, errmsg.ErrLogFromEntryHash.Wrap(err)
 	}
 
 	return NewLog(services, identity, &LogOptions{
-		ID:               logOptions.ID,
-		AccessController: logOptions.AccessController,
-		Entries:          entry.NewOrderedMapFromEntries(entries),
-		SortFn:           logOptions.SortFn,
-		IO:               logOptions.IO,
+		ID:                 logOptions.ID,
+		AccessController:   logOptions.AccessController,
+		AccessControllerV2: logOptions.AccessControllerV2,
+		Entries:            entry.NewOrderedMapFromEntries(entries),
+		SortFn:             logOptions.SortFn,
+		IO:                 logOptions.IO,
 	})
 }
 
 // NewFromJSON Creates a IPFSLog from a JSON Snapshot
 //
 // Creating a log from a JSON Snapshot will retrieve entries from IPFS, thus causing side effects
-func NewFromJSON(ctx context.Context, services coreiface.CoreAPI, identity *identityprovider.Identity, jsonLog *iface.JSONLog, logOptions *LogOptions, fetchOptions *entry.FetchOptions) (*IPFSLog, error) {
+func NewFromJSON(ctx context.Context, services iface.Storage, identity *identityprovider.Identity, jsonLog *iface.JSONLog, logOptions *LogOptions, fetchOptions *entry.FetchOptions) (*IPFSLog, error) {
 	if logOptions == nil {
 		return nil, errmsg.ErrLogOptionsNotDefined
 	}
@@ -851,8 +968,6 @@ func NewFromJSON(ctx context.Context, services coreiface.CoreAPI, identity *iden
 		return nil, errmsg.ErrFetchOptionsNotDefined
 	}
 
-	// TODO: need to verify the entries with 'key'
-
 	if fetchOptions.IO == nil {
 		if logOptions.IO != nil {
 			fetchOptions.IO = logOptions.IO
@@ -868,28 +983,43 @@ func NewFromJSON(ctx context.Context, services coreiface.CoreAPI, identity *iden
 	}
 
 	snapshot, err := fromJSON(ctx, services, jsonLog, &entry.FetchOptions{
-		Length:       fetchOptions.Length,
-		Timeout:      fetchOptions.Timeout,
-		ProgressChan: fetchOptions.ProgressChan,
-		IO:           logOptions.IO,
+		Length:             fetchOptions.Length,
+		Exclude:            fetchOptions.Exclude,
+		ShouldExclude:      fetchOptions.ShouldExclude,
+		Timeout:            fetchOptions.Timeout,
+		ProgressChan:       fetchOptions.ProgressChan,
+		Concurrency:        fetchOptions.Concurrency,
+		Retries:            fetchOptions.Retries,
+		RetryBackoff:       fetchOptions.RetryBackoff,
+		MaxRetryBackoff:    fetchOptions.MaxRetryBackoff,
+		SinceClockTime:     fetchOptions.SinceClockTime,
+		Frontier:           fetchOptions.Frontier,
+		AccessController:   fetchOptions.AccessController,
+		AccessControllerV2: fetchOptions.AccessControllerV2,
+		VerifySignatures:   fetchOptions.VerifySignatures,
+		Checkpoint:         fetchOptions.Checkpoint,
+		Report:             fetchOptions.Report,
+		Provider:           fetchProvider(identity, fetchOptions.Provider),
+		IO:                 logOptions.IO,
 	})
 	if err != nil {
 		return nil, errmsg.ErrLogFromJSON.Wrap(err)
 	}
 
 	return NewLog(services, identity, &LogOptions{
-		ID:               snapshot.ID,
-		AccessController: logOptions.AccessController,
-		Entries:          entry.NewOrderedMapFromEntries(snapshot.Values),
-		SortFn:           logOptions.SortFn,
-		IO:               logOptions.IO,
+		ID:                 snapshot.ID,
+		AccessController:   logOptions.AccessController,
+		AccessControllerV2: logOptions.AccessControllerV2,
+		Entries:            entry.NewOrderedMapFromEntries(snapshot.Values),
+		SortFn:             logOptions.SortFn,
+		IO:                 logOptions.IO,
 	})
 }
 
 // NewFromEntry Creates a IPFSLog from an Entry
 //
 // Creating a log from an entry will retrieve entries from IPFS, thus causing side effects
-func NewFromEntry(ctx context.Context, services coreiface.CoreAPI, identity *identityprovider.Identity, sourceEntries []iface.IPFSLogEntry, logOptions *LogOptions, fetchOptions *entry.FetchOptions) (*IPFSLog, error) {
+func NewFromEntry(ctx context.Context, services iface.Storage, identity *identityprovider.Identity, sourceEntries []iface.IPFSLogEntry, logOptions *LogOptions, fetchOptions *entry.FetchOptions) (*IPFSLog, error) {
 	if logOptions == nil {
 		return nil, errmsg.ErrLogOptionsNotDefined
 	}
@@ -907,25 +1037,150 @@ func NewFromEntry(ctx context.Context, services coreiface.CoreAPI, identity *ide
 		logOptions.IO = io
 	}
 
-	// TODO: need to verify the entries with 'key'
 	snapshot, err := fromEntry(ctx, services, sourceEntries, &entry.FetchOptions{
-		Length:       fetchOptions.Length,
-		Exclude:      fetchOptions.Exclude,
-		ProgressChan: fetchOptions.ProgressChan,
-		Timeout:      fetchOptions.Timeout,
-		Concurrency:  fetchOptions.Concurrency,
-		IO:           logOptions.IO,
+		Length:             fetchOptions.Length,
+		Exclude:            fetchOptions.Exclude,
+		ShouldExclude:      fetchOptions.ShouldExclude,
+		ProgressChan:       fetchOptions.ProgressChan,
+		Timeout:            fetchOptions.Timeout,
+		Concurrency:        fetchOptions.Concurrency,
+		Retries:            fetchOptions.Retries,
+		RetryBackoff:       fetchOptions.RetryBackoff,
+		MaxRetryBackoff:    fetchOptions.MaxRetryBackoff,
+		SinceClockTime:     fetchOptions.SinceClockTime,
+		Frontier:           fetchOptions.Frontier,
+		AccessController:   fetchOptions.AccessController,
+		AccessControllerV2: fetchOptions.AccessControllerV2,
+		VerifySignatures:   fetchOptions.VerifySignatures,
+		Checkpoint:         fetchOptions.Checkpoint,
+		Report:             fetchOptions.Report,
+		Provider:           fetchProvider(identity, fetchOptions.Provider),
+		IO:                 logOptions.IO,
 	})
 	if err != nil {
 		return nil, errmsg.ErrLogFromEntry.Wrap(err)
 	}
 
 	return NewLog(services, identity, &LogOptions{
-		ID:               snapshot.ID,
-		AccessController: logOptions.AccessController,
-		Entries:          entry.NewOrderedMapFromEntries(snapshot.Values),
-		SortFn:           logOptions.SortFn,
-		IO:               logOptions.IO,
+		ID:                 snapshot.ID,
+		AccessController:   logOptions.AccessController,
+		AccessControllerV2: logOptions.AccessControllerV2,
+		Entries:            entry.NewOrderedMapFromEntries(snapshot.Values),
+		SortFn:             logOptions.SortFn,
+		IO:                 logOptions.IO,
+	})
+}
+
+// fetchProvider returns the identity provider verifying the fetched entries.
+func fetchProvider(identity *identityprovider.Identity, provider identityprovider.Interface) identityprovider.Interface {
+	if provider == nil && identity != nil {
+		return identity.Provider
+	}
+
+	return provider
+}
+
+// hashStorage discards the written blocks, it is used to compute their CID.
+type hashStorage struct{}
+
+func (hashStorage) Put(context.Context, format.Node) error { return nil }
+
+func (hashStorage) Get(_ context.Context, c cid.Cid) (format.Node, error) {
+	return nil, format.ErrNotFound{Cid: c}
+}
+
+func (hashStorage) GetMany(context.Context, []cid.Cid) <-chan *format.NodeOption {
+	ch := make(chan *format.NodeOption)
+	close(ch)
+
+	return ch
+}
+
+// NewFromSnapshot Creates a IPFSLog from a Snapshot
+//
+// The entries are expected to be available in the snapshot, nothing is
+// retrieved from IPFS. Use options.Verify to check the entries hashes and
+// signatures when the snapshot comes from an untrusted source.
+func NewFromSnapshot(services iface.Storage, identity *identityprovider.Identity, snapshot *Snapshot, logOptions *LogOptions, options *SnapshotOptions) (*IPFSLog, error) {
+	if snapshot == nil {
+		return nil, errmsg.ErrSnapshotNotDefined
+	}
+
+	if identity == nil {
+		return nil, errmsg.ErrIdentityNotDefined
+	}
+
+	if logOptions == nil {
+		return nil, errmsg.ErrLogOptionsNotDefined
+	}
+
+	if options == nil {
+		options = &SnapshotOptions{}
+	}
+
+	if logOptions.IO == nil {
+		io, err := cbor.IO(&entry.Entry{}, &entry.LamportClock{})
+		if err != nil {
+			return nil, err
+		}
+
+		logOptions.IO = io
+	}
+
+	entries := entry.NewOrderedMapFromEntries(snapshot.Values)
+
+	if options.Verify {
+		for _, e := range snapshot.Values {
+			if e.GetLogID() != snapshot.ID {
+				return nil, errmsg.ErrLogFromSnapshot.Wrap(errmsg.ErrLogIDMismatch)
+			}
+
+			if err := e.Verify(identity.Provider, logOptions.IO); err != nil {
+				return nil, errmsg.ErrLogFromSnapshot.Wrap(errmsg.ErrSigNotVerified.Wrap(err))
+			}
+
+			hash, err := entry.ToMultihashWithIO(context.Background(), e, hashStorage{}, nil, logOptions.IO)
+			if err != nil {
+				return nil, errmsg.ErrLogFromSnapshot.Wrap(err)
+			}
+
+			if !hash.Equals(e.GetHash()) {
+				return nil, errmsg.ErrLogFromSnapshot.Wrap(errmsg.ErrEntryHashMismatch)
+			}
+		}
+	}
+
+	heads := make([]iface.IPFSLogEntry, len(snapshot.Heads))
+	for i, h := range snapshot.Heads {
+		head, ok := entries.Get(h.String())
+		if !ok {
+			return nil, errmsg.ErrLogFromSnapshot.Wrap(errmsg.ErrEntryNotDefined)
+		}
+
+		heads[i] = head
+	}
+
+	if logOptions.Index != nil {
+		// the index ignores the given entries, feed it directly
+		for _, e := range snapshot.Values {
+			logOptions.Index.Entries().Set(e.GetHash().String(), e)
+			for _, n := range e.GetNext() {
+				logOptions.Index.Next().Set(n.String(), e)
+			}
+		}
+	}
+
+	return NewLog(services, identity, &LogOptions{
+		ID:                 snapshot.ID,
+		AccessController:   logOptions.AccessController,
+		AccessControllerV2: logOptions.AccessControllerV2,
+		Entries:            entries,
+		Index:              logOptions.Index,
+		Heads:              heads,
+		Clock:              snapshot.Clock,
+		SortFn:             logOptions.SortFn,
+		Concurrency:        logOptions.Concurrency,
+		IO:                 logOptions.IO,
 	})
 }
 
@@ -940,17 +1195,9 @@ func (l *IPFSLog) Values() iface.IPFSLogOrderedEntries {
 }
 
 func (l *IPFSLog) values() iface.IPFSLogOrderedEntries {
-	heads := l.heads
-
-	if heads == nil {
-		return entry.NewOrderedMap()
-	}
-
-	stack, _ := l.traverse(heads, -1, "")
-
-	stack = stack.Reverse()
+	entries, keys := l.linearized()
 
-	return stack
+	return entry.NewOrderedMapFromKeyedEntries(keys, entries)
 }
 
 // ToJSON Returns a log in a JSON serializable structure
@@ -5,16 +5,17 @@ import (
 	"fmt"
 	"time"
 
-	coreiface "github.com/ipfs/kubo/core/coreiface"
-
+	"berty.tech/go-ipfs-log/accesscontroller"
 	"berty.tech/go-ipfs-log/iface"
 
 	"berty.tech/go-ipfs-log/entry/sorting"
 
 	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
 
 	"berty.tech/go-ipfs-log/entry"
 	"berty.tech/go-ipfs-log/errmsg"
+	"berty.tech/go-ipfs-log/identityprovider"
 	// "berty.tech/go-ipfs-log/io"
 )
 
@@ -26,9 +27,36 @@ type FetchOptions struct {
 	Timeout       time.Duration
 	Concurrency   int
 	SortFn        iface.EntrySortFn
+
+	// Retries, RetryBackoff and MaxRetryBackoff configure how the retrieval
+	// of a block is retried, see iface.FetchOptions.
+	Retries         int
+	RetryBackoff    time.Duration
+	MaxRetryBackoff time.Duration
+
+	// SinceClockTime and Frontier bound the entries which are loaded, see
+	// iface.FetchOptions.
+	SinceClockTime int
+	Frontier       []cid.Cid
+
+	// AccessController, AccessControllerV2 and VerifySignatures check the
+	// loaded entries, see iface.FetchOptions. Provider defaults to the one
+	// of the identity.
+	AccessController   accesscontroller.Interface
+	AccessControllerV2 accesscontroller.InterfaceV2
+	VerifySignatures   bool
+	Provider           identityprovider.Interface
+
+	// Checkpoint persists the state of the fetch so that it can be resumed,
+	// see iface.FetchOptions.
+	Checkpoint datastore.Batching
+
+	// Report, when set, is filled with the report of the fetch, see
+	// iface.FetchOptions.
+	Report *entry.FetchReport
 }
 
-func toMultihash(ctx context.Context, services coreiface.CoreAPI, log *IPFSLog) (cid.Cid, error) {
+func toMultihash(ctx context.Context, services iface.Storage, log *IPFSLog) (cid.Cid, error) {
 	if log.heads.Len() == 0 {
 		return cid.Undef, errmsg.ErrEmptyLogSerialization
 	}
@@ -36,7 +64,7 @@ func toMultihash(ctx context.Context, services coreiface.CoreAPI, log *IPFSLog)
 	return log.io.Write(ctx, services, log.ToJSONLog(), nil)
 }
 
-func fromMultihash(ctx context.Context, services coreiface.CoreAPI, hash cid.Cid, options *FetchOptions, io iface.IO) (*Snapshot, error) {
+func fromMultihash(ctx context.Context, services iface.Storage, hash cid.Cid, options *FetchOptions, io iface.IO) (*Snapshot, error) {
 	result, err := io.Read(ctx, services, hash)
 	if err != nil {
 		return nil, errmsg.ErrCBOROperationFailed.Wrap(err)
@@ -53,16 +81,31 @@ func fromMultihash(ctx context.Context, services coreiface.CoreAPI, hash cid.Cid
 		sortFn = options.SortFn
 	}
 
-	entries := entry.FetchAll(ctx, services, logHeads.Heads, &iface.FetchOptions{
-		Length:        options.Length,
-		ShouldExclude: options.ShouldExclude,
-		Exclude:       options.Exclude,
-		Concurrency:   options.Concurrency,
-		Timeout:       options.Timeout,
-		ProgressChan:  options.ProgressChan,
-		IO:            io,
+	entries, report := entry.FetchAllWithReport(ctx, services, logHeads.Heads, &iface.FetchOptions{
+		Length:             options.Length,
+		ShouldExclude:      options.ShouldExclude,
+		Exclude:            options.Exclude,
+		Concurrency:        options.Concurrency,
+		Retries:            options.Retries,
+		RetryBackoff:       options.RetryBackoff,
+		MaxRetryBackoff:    options.MaxRetryBackoff,
+		SinceClockTime:     options.SinceClockTime,
+		Frontier:           options.Frontier,
+		AccessController:   options.AccessController,
+		AccessControllerV2: options.AccessControllerV2,
+		VerifySignatures:   options.VerifySignatures,
+		Checkpoint:         options.Checkpoint,
+		Report:             options.Report,
+		Provider:           options.Provider,
+		Timeout:            options.Timeout,
+		ProgressChan:       options.ProgressChan,
+		IO:                 io,
 	})
 
+	if err := checkHeads(logHeads.Heads, report); err != nil {
+		return nil, err
+	}
+
 	if options.Length != nil && *options.Length > -1 {
 		sorting.Sort(sortFn, entries, false)
 
@@ -85,7 +128,7 @@ func fromMultihash(ctx context.Context, services coreiface.CoreAPI, hash cid.Cid
 	}, nil
 }
 
-func fromEntryHash(ctx context.Context, services coreiface.CoreAPI, hashes []cid.Cid, options *FetchOptions, io iface.IO) ([]iface.IPFSLogEntry, error) {
+func fromEntryHash(ctx context.Context, services iface.Storage, hashes []cid.Cid, options *FetchOptions, io iface.IO) ([]iface.IPFSLogEntry, error) {
 	if services == nil {
 		return nil, errmsg.ErrIPFSNotDefined
 	}
@@ -100,16 +143,31 @@ func fromEntryHash(ctx context.Context, services coreiface.CoreAPI, hashes []cid
 		length = maxInt(*options.Length, 1)
 	}
 
-	all := entry.FetchParallel(ctx, services, hashes, &iface.FetchOptions{
-		Length:        options.Length,
-		Exclude:       options.Exclude,
-		ShouldExclude: options.ShouldExclude,
-		ProgressChan:  options.ProgressChan,
-		Timeout:       options.Timeout,
-		Concurrency:   options.Concurrency,
-		IO:            io,
+	all, report := entry.FetchAllWithReport(ctx, services, hashes, &iface.FetchOptions{
+		Length:             options.Length,
+		Exclude:            options.Exclude,
+		ShouldExclude:      options.ShouldExclude,
+		ProgressChan:       options.ProgressChan,
+		Timeout:            options.Timeout,
+		Concurrency:        options.Concurrency,
+		Retries:            options.Retries,
+		RetryBackoff:       options.RetryBackoff,
+		MaxRetryBackoff:    options.MaxRetryBackoff,
+		SinceClockTime:     options.SinceClockTime,
+		Frontier:           options.Frontier,
+		AccessController:   options.AccessController,
+		AccessControllerV2: options.AccessControllerV2,
+		VerifySignatures:   options.VerifySignatures,
+		Checkpoint:         options.Checkpoint,
+		Report:             options.Report,
+		Provider:           options.Provider,
+		IO:                 io,
 	})
 
+	if err := checkHeads(hashes, report); err != nil {
+		return nil, err
+	}
+
 	sortFn := sorting.NoZeroes(sorting.LastWriteWins)
 	if options.SortFn != nil {
 		sortFn = options.SortFn
@@ -124,7 +182,7 @@ func fromEntryHash(ctx context.Context, services coreiface.CoreAPI, hashes []cid
 	return entries, nil
 }
 
-func fromJSON(ctx context.Context, services coreiface.CoreAPI, jsonLog *iface.JSONLog, options *iface.FetchOptions) (*Snapshot, error) {
+func fromJSON(ctx context.Context, services iface.Storage, jsonLog *iface.JSONLog, options *iface.FetchOptions) (*Snapshot, error) {
 	if services == nil {
 		return nil, errmsg.ErrIPFSNotDefined
 	}
@@ -137,14 +195,31 @@ func fromJSON(ctx context.Context, services coreiface.CoreAPI, jsonLog *iface.JS
 		return nil, errmsg.ErrLogOptionsNotDefined.Wrap(fmt.Errorf("missing IO field in fetch options"))
 	}
 
-	entries := entry.FetchParallel(ctx, services, jsonLog.Heads, &iface.FetchOptions{
-		Length:       options.Length,
-		ProgressChan: options.ProgressChan,
-		Concurrency:  options.Concurrency,
-		Timeout:      options.Timeout,
-		IO:           options.IO,
+	entries, report := entry.FetchAllWithReport(ctx, services, jsonLog.Heads, &iface.FetchOptions{
+		Length:             options.Length,
+		Exclude:            options.Exclude,
+		ShouldExclude:      options.ShouldExclude,
+		ProgressChan:       options.ProgressChan,
+		Concurrency:        options.Concurrency,
+		Retries:            options.Retries,
+		RetryBackoff:       options.RetryBackoff,
+		MaxRetryBackoff:    options.MaxRetryBackoff,
+		SinceClockTime:     options.SinceClockTime,
+		Frontier:           options.Frontier,
+		AccessController:   options.AccessController,
+		AccessControllerV2: options.AccessControllerV2,
+		VerifySignatures:   options.VerifySignatures,
+		Checkpoint:         options.Checkpoint,
+		Report:             options.Report,
+		Provider:           options.Provider,
+		Timeout:            options.Timeout,
+		IO:                 options.IO,
 	})
 
+	if err := checkHeads(jsonLog.Heads, report); err != nil {
+		return nil, err
+	}
+
 	sorting.Sort(sorting.Compare, entries, false)
 
 	return &Snapshot{
@@ -154,7 +229,7 @@ func fromJSON(ctx context.Context, services coreiface.CoreAPI, jsonLog *iface.JS
 	}, nil
 }
 
-func fromEntry(ctx context.Context, services coreiface.CoreAPI, sourceEntries []iface.IPFSLogEntry, options *iface.FetchOptions) (*Snapshot, error) {
+func fromEntry(ctx context.Context, services iface.Storage, sourceEntries []iface.IPFSLogEntry, options *iface.FetchOptions) (*Snapshot, error) {
 	if services == nil {
 		return nil, errmsg.ErrIPFSNotDefined
 	}
@@ -176,15 +251,31 @@ func fromEntry(ctx context.Context, services coreiface.CoreAPI, sourceEntries []
 	}
 
 	// Fetch the entries
-	entries := entry.FetchParallel(ctx, services, hashes, &iface.FetchOptions{
-		Length:       &length,
-		Exclude:      options.Exclude,
-		ProgressChan: options.ProgressChan,
-		Timeout:      options.Timeout,
-		Concurrency:  options.Concurrency,
-		IO:           options.IO,
+	entries, report := entry.FetchAllWithReport(ctx, services, hashes, &iface.FetchOptions{
+		Length:             &length,
+		Exclude:            options.Exclude,
+		ShouldExclude:      options.ShouldExclude,
+		ProgressChan:       options.ProgressChan,
+		Timeout:            options.Timeout,
+		Concurrency:        options.Concurrency,
+		Retries:            options.Retries,
+		RetryBackoff:       options.RetryBackoff,
+		MaxRetryBackoff:    options.MaxRetryBackoff,
+		SinceClockTime:     options.SinceClockTime,
+		Frontier:           options.Frontier,
+		AccessController:   options.AccessController,
+		AccessControllerV2: options.AccessControllerV2,
+		VerifySignatures:   options.VerifySignatures,
+		Checkpoint:         options.Checkpoint,
+		Report:             options.Report,
+		Provider:           options.Provider,
+		IO:                 options.IO,
 	})
 
+	if err := checkHeads(hashes, report); err != nil {
+		return nil, err
+	}
+
 	// Combine the fetches with the source entries and take only uniques
 	combined := append(sourceEntries, entries...)
 	combined = append(combined, options.Exclude...)
@@ -259,3 +350,19 @@ func entrySliceRange(entries []iface.IPFSLogEntry, from int, to int) []iface.IPF
 
 	return entries[from:to]
 }
+
+// checkHeads returns an error if one of the requested heads could not be
+// loaded, as the log would silently miss it and its history.
+func checkHeads(heads []cid.Cid, report *entry.FetchReport) error {
+	for _, h := range heads {
+		if err, ok := report.Rejected[h]; ok {
+			return errmsg.ErrLogHeadsNotLoaded.Wrap(fmt.Errorf("%s: %w", h, err))
+		}
+
+		if err, ok := report.Failed[h]; ok {
+			return errmsg.ErrLogHeadsNotLoaded.Wrap(fmt.Errorf("%s: %w", h, err))
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,143 @@
+package ipfslog // import "berty.tech/go-ipfs-log"
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-msgio"
+
+	"berty.tech/go-ipfs-log/entry"
+	"berty.tech/go-ipfs-log/errmsg"
+	"berty.tech/go-ipfs-log/iface"
+)
+
+// SnapshotVersion is the version of the snapshot encoding written by WriteSnapshot.
+const SnapshotVersion = 1
+
+const snapshotMagic = "ipfs-log/snapshot"
+
+// maxSnapshotFrameSize is the maximum size of a single entry in a snapshot.
+const maxSnapshotFrameSize = 16 << 20
+
+type snapshotHeader struct {
+	Magic     string    `json:"magic"`
+	Version   int       `json:"version"`
+	ID        string    `json:"id"`
+	Heads     []cid.Cid `json:"heads"`
+	ClockID   []byte    `json:"clock_id,omitempty"`
+	ClockTime int       `json:"clock_time,omitempty"`
+	Count     int       `json:"count"`
+}
+
+type SnapshotOptions struct {
+	// Verify checks the signature and the log ID of every entry.
+	Verify bool
+}
+
+// WriteSnapshot writes a snapshot to w.
+//
+// The snapshot is written as a sequence of varint length-prefixed frames, a
+// header holding the version, the log ID, its heads and its clock, followed
+// by one frame per entry.
+func WriteSnapshot(w io.Writer, snapshot *Snapshot) error {
+	if snapshot == nil {
+		return errmsg.ErrSnapshotNotDefined
+	}
+
+	header := &snapshotHeader{
+		Magic:   snapshotMagic,
+		Version: SnapshotVersion,
+		ID:      snapshot.ID,
+		Heads:   snapshot.Heads,
+		Count:   len(snapshot.Values),
+	}
+
+	if snapshot.Clock != nil {
+		header.ClockID = snapshot.Clock.GetID()
+		header.ClockTime = snapshot.Clock.GetTime()
+	}
+
+	writer := msgio.NewVarintWriter(w)
+
+	if err := writeSnapshotFrame(writer, header); err != nil {
+		return err
+	}
+
+	for _, e := range snapshot.Values {
+		if err := writeSnapshotFrame(writer, entry.ToRecord(e)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func writeSnapshotFrame(writer msgio.Writer, obj interface{}) error {
+	payload, err := json.Marshal(obj)
+	if err != nil {
+		return errmsg.ErrJSONSerializationFailed.Wrap(err)
+	}
+
+	if err := writer.WriteMsg(payload); err != nil {
+		return errmsg.ErrSnapshotWriteFailed.Wrap(err)
+	}
+
+	return nil
+}
+
+// ReadSnapshot reads a snapshot written by WriteSnapshot from r.
+//
+// Entries are decoded as entry.Entry, their signatures are not checked.
+func ReadSnapshot(r io.Reader) (*Snapshot, error) {
+	reader := msgio.NewVarintReaderSize(r, maxSnapshotFrameSize)
+
+	header := &snapshotHeader{}
+	if err := readSnapshotFrame(reader, header); err != nil {
+		return nil, err
+	}
+
+	if header.Magic != snapshotMagic {
+		return nil, errmsg.ErrSnapshotReadFailed.Wrap(fmt.Errorf("not a snapshot"))
+	}
+
+	if header.Version != SnapshotVersion {
+		return nil, errmsg.ErrSnapshotVersionNotSupported.Wrap(fmt.Errorf("version %d", header.Version))
+	}
+
+	if header.Count < 0 {
+		return nil, errmsg.ErrSnapshotReadFailed.Wrap(fmt.Errorf("invalid entry count"))
+	}
+
+	values := make([]iface.IPFSLogEntry, 0, minInt(header.Count, 1024))
+	for i := 0; i < header.Count; i++ {
+		record := &entry.Record{}
+		if err := readSnapshotFrame(reader, record); err != nil {
+			return nil, err
+		}
+
+		values = append(values, record.ToEntry(&entry.Entry{}, &entry.LamportClock{}, nil))
+	}
+
+	return &Snapshot{
+		ID:     header.ID,
+		Heads:  header.Heads,
+		Values: values,
+		Clock:  entry.NewLamportClock(header.ClockID, header.ClockTime),
+	}, nil
+}
+
+func readSnapshotFrame(reader msgio.Reader, obj interface{}) error {
+	payload, err := reader.ReadMsg()
+	if err != nil {
+		return errmsg.ErrSnapshotReadFailed.Wrap(err)
+	}
+	defer reader.ReleaseMsg(payload)
+
+	if err := json.Unmarshal(payload, obj); err != nil {
+		return errmsg.ErrSnapshotReadFailed.Wrap(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,41 @@
+// Package coreapi provides an iface.Storage backed by a kubo CoreAPI.
+package coreapi // import "berty.tech/go-ipfs-log/storage/coreapi"
+
+import (
+	"context"
+
+	"github.com/ipfs/boxo/path"
+	"github.com/ipfs/go-cid"
+	format "github.com/ipfs/go-ipld-format"
+	coreiface "github.com/ipfs/kubo/core/coreiface"
+
+	"berty.tech/go-ipfs-log/iface"
+)
+
+type coreAPIStorage struct {
+	api coreiface.CoreAPI
+}
+
+// New creates a storage using the DAG and pinning APIs of an IPFS node.
+func New(api coreiface.CoreAPI) iface.Storage {
+	return &coreAPIStorage{api: api}
+}
+
+func (s *coreAPIStorage) Put(ctx context.Context, node format.Node) error {
+	return s.api.Dag().Add(ctx, node)
+}
+
+func (s *coreAPIStorage) Get(ctx context.Context, c cid.Cid) (format.Node, error) {
+	return s.api.Dag().Get(ctx, c)
+}
+
+func (s *coreAPIStorage) GetMany(ctx context.Context, cids []cid.Cid) <-chan *format.NodeOption {
+	return s.api.Dag().GetMany(ctx, cids)
+}
+
+func (s *coreAPIStorage) Pin(ctx context.Context, c cid.Cid) error {
+	return s.api.Pin().Add(ctx, path.FromCid(c))
+}
+
+var _ iface.Storage = (*coreAPIStorage)(nil)
+var _ iface.StoragePinner = (*coreAPIStorage)(nil)
@@ -0,0 +1,46 @@
+// Package storage provides adapters turning common IPFS building blocks into an iface.Storage.
+package storage // import "berty.tech/go-ipfs-log/storage"
+
+import (
+	"context"
+
+	"github.com/ipfs/boxo/blockservice"
+	"github.com/ipfs/boxo/blockstore"
+	"github.com/ipfs/boxo/ipld/merkledag"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	format "github.com/ipfs/go-ipld-format"
+
+	"berty.tech/go-ipfs-log/iface"
+)
+
+type dagServiceStorage struct {
+	dag format.DAGService
+}
+
+// NewDAGService creates a storage backed by a DAGService.
+func NewDAGService(dag format.DAGService) iface.Storage {
+	return &dagServiceStorage{dag: dag}
+}
+
+// NewDatastore creates a storage keeping blocks in a datastore, without any
+// network exchange.
+func NewDatastore(ds datastore.Batching) iface.Storage {
+	bs := blockservice.New(blockstore.NewBlockstore(ds), nil)
+
+	return NewDAGService(merkledag.NewDAGService(bs))
+}
+
+func (s *dagServiceStorage) Put(ctx context.Context, node format.Node) error {
+	return s.dag.Add(ctx, node)
+}
+
+func (s *dagServiceStorage) Get(ctx context.Context, c cid.Cid) (format.Node, error) {
+	return s.dag.Get(ctx, c)
+}
+
+func (s *dagServiceStorage) GetMany(ctx context.Context, cids []cid.Cid) <-chan *format.NodeOption {
+	return s.dag.GetMany(ctx, cids)
+}
+
+var _ iface.Storage = (*dagServiceStorage)(nil)
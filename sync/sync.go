@@ -0,0 +1,249 @@
+// Package sync implements a heads exchange protocol replicating IPFS Logs between peers.
+package sync // import "berty.tech/go-ipfs-log/sync"
+
+import (
+	"context"
+	"encoding/json"
+	gosync "sync"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/libp2p/go-msgio"
+
+	ipfslog "berty.tech/go-ipfs-log"
+	"berty.tech/go-ipfs-log/entry"
+	"berty.tech/go-ipfs-log/errmsg"
+	"berty.tech/go-ipfs-log/iface"
+)
+
+// ProtocolID is the libp2p protocol used to exchange heads.
+const ProtocolID = protocol.ID("/ipfs-log/heads-exchange/1.0.0")
+
+const maxMessageSize = 1 << 20
+
+type Options struct {
+	// Timeout bounds an exchange, including fetching the missing entries.
+	Timeout time.Duration
+
+	// Concurrency is the number of entries fetched in parallel.
+	Concurrency int
+
+	// OnError is called when an exchange initiated by a remote peer fails
+	// after the heads have been sent, as that peer is not told about it.
+	OnError func(p peer.ID, logID string, err error)
+}
+
+// Service answers heads exchange requests for registered logs and
+// initiates exchanges with remote peers.
+type Service struct {
+	host        host.Host
+	timeout     time.Duration
+	concurrency int
+	onError     func(p peer.ID, logID string, err error)
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	muLogs gosync.RWMutex
+	logs   map[string]*ipfslog.IPFSLog
+}
+
+// NewService creates a sync service and registers its stream handler on the given host.
+func NewService(h host.Host, options *Options) *Service {
+	if options == nil {
+		options = &Options{}
+	}
+
+	if options.Timeout == 0 {
+		options.Timeout = time.Minute
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	s := &Service{
+		host:        h,
+		timeout:     options.Timeout,
+		concurrency: options.Concurrency,
+		onError:     options.OnError,
+		ctx:         ctx,
+		cancel:      cancel,
+		logs:        map[string]*ipfslog.IPFSLog{},
+	}
+
+	h.SetStreamHandler(ProtocolID, s.handleStream)
+
+	return s
+}
+
+// Register makes a log available to remote peers, replacing any log previously
+// registered with the same ID.
+func (s *Service) Register(l *ipfslog.IPFSLog) {
+	s.muLogs.Lock()
+	s.logs[l.ID] = l
+	s.muLogs.Unlock()
+}
+
+// Unregister stops serving the log with the given ID.
+func (s *Service) Unregister(logID string) {
+	s.muLogs.Lock()
+	delete(s.logs, logID)
+	s.muLogs.Unlock()
+}
+
+// Close removes the stream handler and cancels running exchanges.
+func (s *Service) Close() error {
+	s.host.RemoveStreamHandler(ProtocolID)
+	s.cancel()
+
+	return nil
+}
+
+func (s *Service) getLog(logID string) (*ipfslog.IPFSLog, bool) {
+	s.muLogs.RLock()
+	l, ok := s.logs[logID]
+	s.muLogs.RUnlock()
+
+	return l, ok
+}
+
+// Sync exchanges the heads of a registered log with a remote peer, then
+// fetches and joins the entries missing locally. The remote peer does the same
+// on its side.
+func (s *Service) Sync(ctx context.Context, p peer.ID, logID string) error {
+	l, ok := s.getLog(logID)
+	if !ok {
+		return errmsg.ErrSyncLogNotRegistered
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	stream, err := s.host.NewStream(ctx, p, ProtocolID)
+	if err != nil {
+		return errmsg.ErrSyncExchangeFailed.Wrap(err)
+	}
+	defer stream.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = stream.SetDeadline(deadline)
+	}
+
+	if err := writeHeads(stream, l.ToJSONLog()); err != nil {
+		_ = stream.Reset()
+		return errmsg.ErrSyncExchangeFailed.Wrap(err)
+	}
+
+	remote, err := readHeads(stream)
+	if err != nil {
+		_ = stream.Reset()
+		return errmsg.ErrSyncExchangeFailed.Wrap(err)
+	}
+
+	// an empty ID means the remote peer doesn't serve this log
+	if remote.ID != logID {
+		return errmsg.ErrSyncLogNotRegistered
+	}
+
+	return s.fetchAndJoin(ctx, l, remote.Heads)
+}
+
+func (s *Service) handleStream(stream network.Stream) {
+	defer stream.Close()
+
+	ctx, cancel := context.WithTimeout(s.ctx, s.timeout)
+	defer cancel()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = stream.SetDeadline(deadline)
+	}
+
+	remote, err := readHeads(stream)
+	if err != nil {
+		_ = stream.Reset()
+		return
+	}
+
+	l, ok := s.getLog(remote.ID)
+	if !ok {
+		_ = writeHeads(stream, &iface.JSONLog{})
+		return
+	}
+
+	if err := writeHeads(stream, l.ToJSONLog()); err != nil {
+		_ = stream.Reset()
+		return
+	}
+
+	if err := s.fetchAndJoin(ctx, l, remote.Heads); err != nil && s.onError != nil {
+		s.onError(stream.Conn().RemotePeer(), remote.ID, err)
+	}
+}
+
+// fetchAndJoin retrieves the entries reachable from heads which are not in
+// the log yet, and joins them.
+func (s *Service) fetchAndJoin(ctx context.Context, l *ipfslog.IPFSLog, heads []cid.Cid) error {
+	var missing []cid.Cid
+	for _, h := range heads {
+		if !l.Has(h) {
+			missing = append(missing, h)
+		}
+	}
+
+	if len(missing) == 0 {
+		return nil
+	}
+
+	entries, report := entry.FetchAllWithReport(ctx, l.Storage, missing, &iface.FetchOptions{
+		ShouldExclude: l.Has,
+		Concurrency:   s.concurrency,
+		IO:            l.IO(),
+	})
+
+	// only join the fetched entries once they are rooted in the log
+	if !report.Complete() {
+		return errmsg.ErrSyncIncomplete
+	}
+
+	other, err := ipfslog.NewLog(l.Storage, l.Identity, &ipfslog.LogOptions{
+		ID:      l.ID,
+		Entries: entry.NewOrderedMapFromEntries(entries),
+		SortFn:  l.SortFn,
+		IO:      l.IO(),
+	})
+	if err != nil {
+		return errmsg.ErrSyncExchangeFailed.Wrap(err)
+	}
+
+	if _, err := l.Join(other, -1); err != nil {
+		return errmsg.ErrSyncExchangeFailed.Wrap(err)
+	}
+
+	return nil
+}
+
+func writeHeads(stream network.Stream, heads *iface.JSONLog) error {
+	payload, err := json.Marshal(heads)
+	if err != nil {
+		return errmsg.ErrJSONSerializationFailed.Wrap(err)
+	}
+
+	return msgio.NewVarintWriter(stream).WriteMsg(payload)
+}
+
+func readHeads(stream network.Stream) (*iface.JSONLog, error) {
+	payload, err := msgio.NewVarintReaderSize(stream, maxMessageSize).ReadMsg()
+	if err != nil {
+		return nil, err
+	}
+
+	heads := &iface.JSONLog{}
+	if err := json.Unmarshal(payload, heads); err != nil {
+		return nil, errmsg.ErrJSONSerializationFailed.Wrap(err)
+	}
+
+	return heads, nil
+}
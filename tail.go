@@ -0,0 +1,101 @@
+package ipfslog // import "berty.tech/go-ipfs-log"
+
+import (
+	"context"
+
+	"github.com/ipfs/go-cid"
+
+	"berty.tech/go-ipfs-log/errmsg"
+	"berty.tech/go-ipfs-log/iface"
+)
+
+// Tail returns a channel yielding the entries of the log following the one
+// identified by from, or all of them if from is undefined, then the entries
+// added by Append or Join as they arrive, until ctx is done.
+//
+// Entries added together are yielded in the sort order of the log, an entry
+// joined late can follow entries newer than it.
+func (l *IPFSLog) Tail(ctx context.Context, from cid.Cid) (<-chan iface.IPFSLogEntry, error) {
+	// subscribe first to not miss entries added while reading the log
+	ctx, cancel := context.WithCancel(ctx)
+	sub := l.Subscribe(ctx, nil)
+
+	l.lock.RLock()
+	entries, keys := l.linearized()
+
+	// entries up to from are never yielded
+	pos := -1
+	if from.Defined() {
+		var ok bool
+		if _, pos, ok = l.linearPosition(from.String()); !ok {
+			l.lock.RUnlock()
+			cancel()
+			return nil, errmsg.ErrTailEntryNotFound
+		}
+	}
+	l.lock.RUnlock()
+
+	out := make(chan iface.IPFSLogEntry)
+
+	go func() {
+		defer close(out)
+		defer cancel()
+
+		send := func(entries []iface.IPFSLogEntry) bool {
+			for _, e := range entries {
+				select {
+				case out <- e:
+				case <-ctx.Done():
+					return false
+				}
+			}
+
+			return true
+		}
+
+		if !send(entries[pos+1:]) {
+			return
+		}
+
+		// events only signal changes, the entries added since the last
+		// ones yielded are found in the log so that dropped events don't
+		// lose entries
+		for range sub.Out() {
+			l.lock.RLock()
+			current, currentKeys := l.linearized()
+			l.lock.RUnlock()
+
+			added := linearAdded(entries, keys, current, currentKeys)
+			entries, keys = current, currentKeys
+
+			if !send(added) {
+				return
+			}
+		}
+	}()
+
+	return out, nil
+}
+
+// linearAdded returns the entries of a linearization which are not in a
+// previous one, in order.
+func linearAdded(previous []iface.IPFSLogEntry, previousKeys []string, current []iface.IPFSLogEntry, currentKeys []string) []iface.IPFSLogEntry {
+	// appended entries extend the cached order in place
+	if len(current) >= len(previous) && (len(previous) == 0 || &current[0] == &previous[0]) {
+		return current[len(previous):]
+	}
+
+	known := make(map[string]struct{}, len(previousKeys))
+	for _, k := range previousKeys {
+		known[k] = struct{}{}
+	}
+
+	var added []iface.IPFSLogEntry
+	for i, k := range currentKeys {
+		if _, ok := known[k]; !ok {
+			added = append(added, current[i])
+		}
+	}
+
+	return added
+}
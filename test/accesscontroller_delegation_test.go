@@ -0,0 +1,228 @@
+package test
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	ipfslog "berty.tech/go-ipfs-log"
+	"berty.tech/go-ipfs-log/accesscontroller"
+	"berty.tech/go-ipfs-log/errmsg"
+	idp "berty.tech/go-ipfs-log/identityprovider"
+	ks "berty.tech/go-ipfs-log/keystore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDelegatedAccessController(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	m := mocknet.New()
+	defer m.Close()
+	ipfs, closeNode := NewMemoryServices(ctx, t, m)
+	defer closeNode()
+
+	keystore, err := ks.NewKeystore(dssync.MutexWrap(NewIdentityDataStore(t)))
+	require.NoError(t, err)
+
+	var (
+		identities [3]*idp.Identity
+		keys       [3]crypto.PrivKey
+	)
+
+	for i, char := range []rune{'A', 'B', 'C'} {
+		identity, err := idp.CreateIdentity(ctx, &idp.CreateIdentityOptions{
+			Keystore: keystore,
+			ID:       fmt.Sprintf("user%c", char),
+			Type:     "orbitdb",
+		})
+		require.NoError(t, err)
+
+		identities[i] = identity
+
+		keys[i], err = keystore.GetKey(ctx, identity.ID)
+		require.NoError(t, err)
+	}
+
+	owner, device, other := identities[0], identities[1], identities[2]
+	ownerKey, deviceKey := keys[0], keys[1]
+	owners := []string{hex.EncodeToString(owner.PublicKey)}
+
+	hour := time.Now().Add(time.Hour)
+
+	delegate := func(t *testing.T, issuer crypto.PrivKey, audience *idp.Identity, scope []string, expiry time.Time) *accesscontroller.Delegation {
+		t.Helper()
+
+		d, err := accesscontroller.Delegate(issuer, hex.EncodeToString(audience.PublicKey), scope, expiry)
+		require.NoError(t, err)
+
+		return d
+	}
+
+	withChainAt := func(t *testing.T, writtenAt time.Time, chain ...*accesscontroller.Delegation) *ipfslog.AppendOptions {
+		t.Helper()
+
+		encoded, err := accesscontroller.EncodeDelegationChain(chain)
+		require.NoError(t, err)
+
+		return &ipfslog.AppendOptions{AdditionalData: map[string]string{
+			accesscontroller.DelegationChainKey: encoded,
+			accesscontroller.DelegationTimeKey:  strconv.FormatInt(writtenAt.Unix(), 10),
+		}}
+	}
+
+	withChain := func(t *testing.T, chain ...*accesscontroller.Delegation) *ipfslog.AppendOptions {
+		t.Helper()
+
+		return withChainAt(t, time.Now(), chain...)
+	}
+
+	newLog := func(t *testing.T, identity *idp.Identity, ac accesscontroller.Interface) *ipfslog.IPFSLog {
+		t.Helper()
+
+		l, err := ipfslog.NewLog(ipfs, identity, &ipfslog.LogOptions{ID: "X", AccessController: ac})
+		require.NoError(t, err)
+
+		return l
+	}
+
+	t.Run("allows the owners", func(t *testing.T) {
+		log1 := newLog(t, owner, accesscontroller.NewDelegated(owners, nil))
+
+		_, err := log1.Append(ctx, []byte("one"), nil)
+		require.NoError(t, err)
+	})
+
+	t.Run("allows a delegated identity", func(t *testing.T) {
+		ac := accesscontroller.NewDelegated(owners, nil)
+		log1 := newLog(t, device, ac)
+
+		_, err := log1.Append(ctx, []byte("one"), nil)
+		require.ErrorIs(t, err, errmsg.ErrLogAppendDenied)
+
+		_, err = log1.Append(ctx, []byte("one"), withChain(t, delegate(t, ownerKey, device, []string{"X"}, hour)))
+		require.NoError(t, err)
+
+		// the chain is stored and signed along with the entry
+		log2, err := ipfslog.NewFromEntryHash(ctx, ipfs, owner, log1.Heads().At(0).GetHash(), &ipfslog.LogOptions{ID: "X"}, &ipfslog.FetchOptions{AccessController: ac, VerifySignatures: true})
+		require.NoError(t, err)
+		require.Equal(t, []string{"one"}, entriesAsStrings(log2.Values()))
+	})
+
+	t.Run("allows a chain referenced by CID", func(t *testing.T) {
+		c, err := accesscontroller.SaveDelegationChain(ctx, ipfs, []*accesscontroller.Delegation{delegate(t, ownerKey, device, []string{"X"}, time.Time{})})
+		require.NoError(t, err)
+
+		opts := &ipfslog.AppendOptions{AdditionalData: map[string]string{accesscontroller.DelegationChainCIDKey: c.String()}}
+
+		log1 := newLog(t, device, accesscontroller.NewDelegated(owners, nil))
+		_, err = log1.Append(ctx, []byte("one"), opts)
+		require.ErrorIs(t, err, errmsg.ErrIPFSNotDefined)
+
+		log1 = newLog(t, device, accesscontroller.NewDelegated(owners, &accesscontroller.DelegatedOptions{Storage: ipfs}))
+		_, err = log1.Append(ctx, []byte("one"), opts)
+		require.NoError(t, err)
+	})
+
+	t.Run("allows re-delegations narrowing the delegation", func(t *testing.T) {
+		root := delegate(t, ownerKey, device, []string{"X", "Y"}, hour)
+
+		log1 := newLog(t, other, accesscontroller.NewDelegated(owners, nil))
+		_, err := log1.Append(ctx, []byte("one"), withChain(t, root, delegate(t, deviceKey, other, []string{"X"}, hour.Add(-time.Minute))))
+		require.NoError(t, err)
+
+		for name, leaf := range map[string]*accesscontroller.Delegation{
+			"wider scope":    delegate(t, deviceKey, other, []string{accesscontroller.DelegationScopeAll}, hour),
+			"later expiry":   delegate(t, deviceKey, other, []string{"X"}, hour.Add(time.Minute)),
+			"no expiry":      delegate(t, deviceKey, other, []string{"X"}, time.Time{}),
+			"unknown issuer": delegate(t, keys[2], other, []string{"X"}, hour),
+		} {
+			_, err := log1.Append(ctx, []byte(name), withChain(t, root, leaf))
+			require.ErrorIs(t, err, errmsg.ErrDelegationInvalid, name)
+		}
+	})
+
+	t.Run("denies invalid chains", func(t *testing.T) {
+		log1 := newLog(t, other, accesscontroller.NewDelegated(owners, nil))
+
+		// not rooted at an owner
+		_, err := log1.Append(ctx, []byte("one"), withChain(t, delegate(t, deviceKey, other, []string{"X"}, hour)))
+		require.ErrorIs(t, err, errmsg.ErrDelegationInvalid)
+
+		// tampered
+		d := delegate(t, ownerKey, device, []string{"X"}, hour)
+		d.Audience = hex.EncodeToString(other.PublicKey)
+
+		_, err = log1.Append(ctx, []byte("one"), withChain(t, d))
+		require.ErrorIs(t, err, errmsg.ErrDelegationInvalid)
+
+		// delegated to another identity
+		_, err = log1.Append(ctx, []byte("one"), withChain(t, delegate(t, ownerKey, device, []string{"X"}, hour)))
+		require.ErrorIs(t, err, errmsg.ErrLogAppendDenied)
+		require.NotErrorIs(t, err, errmsg.ErrDelegationInvalid)
+
+		// delegated to an identity ID rather than its public key
+		d, err = accesscontroller.Delegate(ownerKey, other.ID, []string{"X"}, hour)
+		require.NoError(t, err)
+
+		_, err = log1.Append(ctx, []byte("one"), withChain(t, d))
+		require.ErrorIs(t, err, errmsg.ErrLogAppendDenied)
+	})
+
+	t.Run("denies logs out of scope", func(t *testing.T) {
+		log1 := newLog(t, device, accesscontroller.NewDelegated(owners, nil))
+
+		_, err := log1.Append(ctx, []byte("one"), withChain(t, delegate(t, ownerKey, device, []string{"Y"}, hour)))
+		require.ErrorIs(t, err, errmsg.ErrLogAppendDenied)
+	})
+
+	t.Run("denies entries written after the expiry", func(t *testing.T) {
+		ac := accesscontroller.NewDelegated(owners, nil)
+		log1 := newLog(t, device, ac)
+
+		d := delegate(t, ownerKey, device, []string{"X"}, hour)
+
+		e, err := log1.Append(ctx, []byte("one"), withChain(t, d))
+		require.NoError(t, err)
+
+		// the proven chain is cached, its expiry is still checked
+		_, err = log1.Append(ctx, []byte("two"), withChainAt(t, hour.Add(time.Second), d))
+		require.ErrorIs(t, err, errmsg.ErrDelegationExpired)
+
+		// the time is required by expiring chains
+		encoded, err := accesscontroller.EncodeDelegationChain([]*accesscontroller.Delegation{d})
+		require.NoError(t, err)
+
+		_, err = log1.Append(ctx, []byte("two"), &ipfslog.AppendOptions{AdditionalData: map[string]string{accesscontroller.DelegationChainKey: encoded}})
+		require.ErrorContains(t, err, errmsg.ErrDelegationInvalid.Error())
+
+		// an expired delegate can't backdate an entry following a later one
+		expired := delegate(t, ownerKey, device, []string{"X"}, time.Now().Add(-time.Minute))
+
+		_, err = log1.Append(ctx, []byte("two"), withChainAt(t, time.Now().Add(-time.Hour), expired))
+		require.ErrorIs(t, err, errmsg.ErrDelegationBackdated)
+		require.Equal(t, 1, log1.Len())
+
+		// nor when the entry is loaded by another replica
+		unchecked := newLog(t, device, nil)
+
+		_, err = unchecked.Append(ctx, []byte("one"), withChain(t, d))
+		require.NoError(t, err)
+
+		backdated, err := unchecked.Append(ctx, []byte("two"), withChainAt(t, time.Now().Add(-time.Hour), expired))
+		require.NoError(t, err)
+
+		_, err = ipfslog.NewFromEntryHash(ctx, ipfs, owner, backdated.GetHash(), &ipfslog.LogOptions{ID: "X"}, &ipfslog.FetchOptions{AccessController: accesscontroller.NewDelegated(owners, nil)})
+		require.ErrorContains(t, err, errmsg.ErrDelegationBackdated.Error())
+
+		log2, err := ipfslog.NewFromEntryHash(ctx, ipfs, owner, e.GetHash(), &ipfslog.LogOptions{ID: "X"}, &ipfslog.FetchOptions{AccessController: ac})
+		require.NoError(t, err)
+		require.Equal(t, 1, log2.Len())
+	})
+}
@@ -0,0 +1,268 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	ipfslog "berty.tech/go-ipfs-log"
+	"berty.tech/go-ipfs-log/accesscontroller"
+	"berty.tech/go-ipfs-log/errmsg"
+	idp "berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/iface"
+	ks "berty.tech/go-ipfs-log/keystore"
+	"github.com/ipfs/go-cid"
+	dssync "github.com/ipfs/go-datastore/sync"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInLogAccessController(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	m := mocknet.New()
+	defer m.Close()
+	ipfs, closeNode := NewMemoryServices(ctx, t, m)
+	defer closeNode()
+
+	keystore, err := ks.NewKeystore(dssync.MutexWrap(NewIdentityDataStore(t)))
+	require.NoError(t, err)
+
+	var identities [4]*idp.Identity
+	for i, char := range []rune{'A', 'B', 'C', 'D'} {
+		identity, err := idp.CreateIdentity(ctx, &idp.CreateIdentityOptions{
+			Keystore: keystore,
+			ID:       fmt.Sprintf("user%c", char),
+			Type:     "orbitdb",
+		})
+		require.NoError(t, err)
+
+		identities[i] = identity
+	}
+
+	admin, writer, other, otherAdmin := identities[0], identities[1], identities[2], identities[3]
+
+	newLog := func(t *testing.T, identity *idp.Identity) *ipfslog.IPFSLog {
+		t.Helper()
+
+		l, err := ipfslog.NewLog(ipfs, identity, &ipfslog.LogOptions{ID: "X", AccessController: accesscontroller.NewInLog(admin.ID)})
+		require.NoError(t, err)
+
+		return l
+	}
+
+	join := func(t *testing.T, l *ipfslog.IPFSLog, other *ipfslog.IPFSLog) {
+		t.Helper()
+
+		_, err := l.JoinWithOptions(ctx, other, nil)
+		require.NoError(t, err)
+	}
+
+	t.Run("grants and revokes the write role", func(t *testing.T) {
+		logAdmin := newLog(t, admin)
+		logWriter := newLog(t, writer)
+
+		_, err := logAdmin.Append(ctx, []byte("A1"), nil)
+		require.NoError(t, err)
+
+		_, err = logWriter.Append(ctx, []byte("B1"), nil)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), errmsg.ErrLogAppendDenied.Error())
+
+		_, err = logAdmin.Append(ctx, grant(t, writer.ID, accesscontroller.RoleWrite), nil)
+		require.NoError(t, err)
+
+		join(t, logWriter, logAdmin)
+
+		_, err = logWriter.Append(ctx, []byte("B1"), nil)
+		require.NoError(t, err)
+
+		// writers can't grant roles
+		_, err = logWriter.Append(ctx, grant(t, other.ID, accesscontroller.RoleWrite), nil)
+		require.Error(t, err)
+
+		join(t, logAdmin, logWriter)
+		require.Equal(t, 3, logAdmin.Len())
+
+		_, err = logAdmin.Append(ctx, revoke(t, writer.ID), nil)
+		require.NoError(t, err)
+
+		// an entry concurrent to the revocation is still accepted
+		_, err = logWriter.Append(ctx, []byte("B2"), nil)
+		require.NoError(t, err)
+
+		join(t, logAdmin, logWriter)
+		require.Equal(t, 5, logAdmin.Len())
+
+		// but not once the revocation is known
+		join(t, logWriter, logAdmin)
+
+		_, err = logWriter.Append(ctx, []byte("B3"), nil)
+		require.Error(t, err)
+	})
+
+	t.Run("accepts entries joined along with their grant", func(t *testing.T) {
+		logAdmin := newLog(t, admin)
+		logWriter := newLog(t, writer)
+
+		_, err := logAdmin.Append(ctx, grant(t, writer.ID, accesscontroller.RoleWrite), nil)
+		require.NoError(t, err)
+
+		join(t, logWriter, logAdmin)
+
+		_, err = logWriter.Append(ctx, []byte("B1"), nil)
+		require.NoError(t, err)
+
+		reader := newLog(t, other)
+		join(t, reader, logWriter)
+		require.Equal(t, 2, reader.Len())
+	})
+
+	t.Run("loads a log from its heads", func(t *testing.T) {
+		logAdmin := newLog(t, admin)
+		logWriter := newLog(t, writer)
+
+		_, err := logAdmin.Append(ctx, grant(t, writer.ID, accesscontroller.RoleWrite), nil)
+		require.NoError(t, err)
+
+		join(t, logWriter, logAdmin)
+
+		_, err = logWriter.Append(ctx, []byte("B1"), nil)
+		require.NoError(t, err)
+
+		head, err := logWriter.Append(ctx, []byte("B2"), nil)
+		require.NoError(t, err)
+
+		// the grant is fetched after the entries it allows
+		loaded, err := ipfslog.NewFromEntryHash(ctx, ipfs, other, head.GetHash(), &ipfslog.LogOptions{ID: "X"}, &ipfslog.FetchOptions{AccessController: accesscontroller.NewInLog(admin.ID)})
+		require.NoError(t, err)
+		require.Equal(t, 3, loaded.Len())
+
+		// the grant of another admin is rejected, along with what follows it
+		_, err = ipfslog.NewFromEntryHash(ctx, ipfs, other, head.GetHash(), &ipfslog.LogOptions{ID: "X"}, &ipfslog.FetchOptions{AccessController: accesscontroller.NewInLog(otherAdmin.ID)})
+		require.ErrorContains(t, err, errmsg.ErrLogHeadsNotLoaded.Error())
+	})
+
+	t.Run("lets admins grant roles", func(t *testing.T) {
+		logAdmin := newLog(t, admin)
+		logOtherAdmin := newLog(t, otherAdmin)
+		logOther := newLog(t, other)
+
+		_, err := logAdmin.Append(ctx, grant(t, otherAdmin.ID, accesscontroller.RoleAdmin), nil)
+		require.NoError(t, err)
+
+		join(t, logOtherAdmin, logAdmin)
+
+		_, err = logOtherAdmin.Append(ctx, grant(t, other.ID, accesscontroller.RoleWrite), nil)
+		require.NoError(t, err)
+
+		join(t, logOther, logOtherAdmin)
+
+		_, err = logOther.Append(ctx, []byte("C1"), nil)
+		require.NoError(t, err)
+	})
+
+	t.Run("resolves concurrent grants and revocations deterministically", func(t *testing.T) {
+		logAdmin := newLog(t, admin)
+
+		_, err := logAdmin.Append(ctx, grant(t, otherAdmin.ID, accesscontroller.RoleAdmin), nil)
+		require.NoError(t, err)
+
+		_, err = logAdmin.Append(ctx, grant(t, other.ID, accesscontroller.RoleWrite), nil)
+		require.NoError(t, err)
+
+		logOtherAdmin := newLog(t, otherAdmin)
+		join(t, logOtherAdmin, logAdmin)
+
+		// the admins concurrently grant and revoke the role of the same key
+		_, err = logAdmin.Append(ctx, grant(t, other.ID, accesscontroller.RoleAdmin), nil)
+		require.NoError(t, err)
+
+		_, err = logOtherAdmin.Append(ctx, revoke(t, other.ID), nil)
+		require.NoError(t, err)
+
+		for _, order := range [][2]*ipfslog.IPFSLog{{logAdmin, logOtherAdmin}, {logOtherAdmin, logAdmin}} {
+			logOther := newLog(t, other)
+			join(t, logOther, order[0])
+			join(t, logOther, order[1])
+
+			_, err = logOther.Append(ctx, []byte("C1"), nil)
+			require.Error(t, err)
+		}
+	})
+
+	t.Run("caches the state of the checked entries", func(t *testing.T) {
+		ac := accesscontroller.NewInLog(admin.ID)
+
+		l, err := ipfslog.NewLog(ipfs, admin, &ipfslog.LogOptions{ID: "X", AccessController: ac})
+		require.NoError(t, err)
+
+		var head iface.IPFSLogEntry
+		for i := 0; i < 20; i++ {
+			head, err = l.Append(ctx, []byte(fmt.Sprintf("A%d", i)), nil)
+			require.NoError(t, err)
+		}
+
+		view := &countingView{entries: l.Values()}
+
+		// the ancestors of the head were checked along with the appends
+		require.NoError(t, ac.CanAppendV2(ctx, head, nil, view))
+		require.Equal(t, 0, view.gets)
+
+		require.NoError(t, accesscontroller.NewInLog(admin.ID).CanAppendV2(ctx, head, nil, view))
+		require.Equal(t, 19, view.gets)
+	})
+
+	t.Run("refuses invalid roles", func(t *testing.T) {
+		_, err := accesscontroller.Grant(writer.ID, accesscontroller.Role("owner"))
+		require.Equal(t, errmsg.ErrCapabilityInvalid, err)
+	})
+}
+
+// countingView is a LogView counting the entries looked up.
+type countingView struct {
+	entries iface.IPFSLogOrderedEntries
+	gets    int
+}
+
+func (v *countingView) GetLogEntries() []accesscontroller.LogEntry {
+	var entries []accesscontroller.LogEntry
+	for _, e := range v.entries.Slice() {
+		entries = append(entries, e)
+	}
+
+	return entries
+}
+
+func (v *countingView) GetLogID() string { return "X" }
+
+func (v *countingView) GetEntry(c cid.Cid) (accesscontroller.CausalLogEntry, bool) {
+	v.gets++
+
+	return v.entries.Get(c.String())
+}
+
+func (v *countingView) GetAncestors(context.Context, accesscontroller.CausalLogEntry) ([]accesscontroller.CausalLogEntry, error) {
+	return nil, nil
+}
+
+func (v *countingView) GetHeads() []accesscontroller.CausalLogEntry { return nil }
+
+func grant(t *testing.T, key string, role accesscontroller.Role) []byte {
+	t.Helper()
+
+	payload, err := accesscontroller.Grant(key, role)
+	require.NoError(t, err)
+
+	return payload
+}
+
+func revoke(t *testing.T, key string) []byte {
+	t.Helper()
+
+	payload, err := accesscontroller.Revoke(key)
+	require.NoError(t, err)
+
+	return payload
+}
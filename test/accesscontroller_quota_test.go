@@ -0,0 +1,216 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	ipfslog "berty.tech/go-ipfs-log"
+	"berty.tech/go-ipfs-log/accesscontroller"
+	"berty.tech/go-ipfs-log/entry"
+	"berty.tech/go-ipfs-log/errmsg"
+	idp "berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/iface"
+	ks "berty.tech/go-ipfs-log/keystore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuotaAccessController(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	m := mocknet.New()
+	defer m.Close()
+	ipfs, closeNode := NewMemoryServices(ctx, t, m)
+	defer closeNode()
+
+	keystore, err := ks.NewKeystore(dssync.MutexWrap(NewIdentityDataStore(t)))
+	require.NoError(t, err)
+
+	var identities [2]*idp.Identity
+	for i, char := range []rune{'A', 'B'} {
+		identity, err := idp.CreateIdentity(ctx, &idp.CreateIdentityOptions{
+			Keystore: keystore,
+			ID:       fmt.Sprintf("user%c", char),
+			Type:     "orbitdb",
+		})
+		require.NoError(t, err)
+
+		identities[i] = identity
+	}
+
+	requireQuotaError := func(t *testing.T, err error, limit accesscontroller.QuotaLimit) {
+		t.Helper()
+
+		require.ErrorIs(t, err, errmsg.ErrQuotaExceeded)
+
+		var quotaErr *accesscontroller.QuotaError
+		require.True(t, errors.As(err, &quotaErr))
+		require.Equal(t, limit, quotaErr.Limit)
+		require.Equal(t, identities[0].ID, quotaErr.Author)
+	}
+
+	newLog := func(t *testing.T, identity *idp.Identity, ac accesscontroller.Interface) *ipfslog.IPFSLog {
+		t.Helper()
+
+		l, err := ipfslog.NewLog(ipfs, identity, &ipfslog.LogOptions{ID: "X", AccessController: ac})
+		require.NoError(t, err)
+
+		return l
+	}
+
+	t.Run("limits the entries within a window", func(t *testing.T) {
+		log1 := newLog(t, identities[0], accesscontroller.NewQuota(nil, &accesscontroller.QuotaOptions{MaxEntries: 2, Window: 5}))
+
+		for _, payload := range []string{"A1", "A2"} {
+			_, err := log1.Append(ctx, []byte(payload), nil)
+			require.NoError(t, err)
+		}
+
+		_, err := log1.Append(ctx, []byte("A3"), nil)
+		requireQuotaError(t, err, accesscontroller.QuotaLimitRate)
+		require.Contains(t, err.Error(), errmsg.ErrLogAppendDenied.Error())
+
+		// the window moves along with the clock of the log
+		other, err := ipfslog.NewLog(ipfs, identities[1], &ipfslog.LogOptions{
+			ID:    "X",
+			Clock: entry.NewLamportClock(identities[1].PublicKey, 10),
+		})
+		require.NoError(t, err)
+
+		_, err = other.Append(ctx, []byte("B1"), nil)
+		require.NoError(t, err)
+
+		_, err = log1.Join(other, -1)
+		require.NoError(t, err)
+
+		_, err = log1.Append(ctx, []byte("A3"), nil)
+		require.NoError(t, err)
+	})
+
+	t.Run("limits the total payload bytes", func(t *testing.T) {
+		log1 := newLog(t, identities[0], accesscontroller.NewQuota(nil, &accesscontroller.QuotaOptions{MaxTotalBytes: 10}))
+
+		for _, payload := range []string{"12345", "12345"} {
+			_, err := log1.Append(ctx, []byte(payload), nil)
+			require.NoError(t, err)
+		}
+
+		_, err := log1.Append(ctx, []byte("1"), nil)
+		requireQuotaError(t, err, accesscontroller.QuotaLimitTotalBytes)
+	})
+
+	t.Run("limits the payload size", func(t *testing.T) {
+		log1 := newLog(t, identities[0], accesscontroller.NewQuota(nil, &accesscontroller.QuotaOptions{MaxEntrySize: 4}))
+
+		_, err := log1.Append(ctx, []byte("1234"), nil)
+		require.NoError(t, err)
+
+		_, err = log1.Append(ctx, []byte("12345"), nil)
+		requireQuotaError(t, err, accesscontroller.QuotaLimitEntrySize)
+	})
+
+	t.Run("limits the joined entries", func(t *testing.T) {
+		other := newLog(t, identities[0], nil)
+		for i := 1; i <= 4; i++ {
+			_, err := other.Append(ctx, []byte(fmt.Sprintf("A%d", i)), nil)
+			require.NoError(t, err)
+		}
+
+		log1 := newLog(t, identities[1], accesscontroller.NewQuota(nil, &accesscontroller.QuotaOptions{MaxEntries: 2, Window: 100}))
+
+		result, err := log1.JoinWithOptions(ctx, other, &ipfslog.JoinOptions{Policy: ipfslog.JoinCausalSubset})
+		require.NoError(t, err)
+		require.Equal(t, []string{"A1", "A2"}, entriesAsStrings(log1.Values()))
+		require.Len(t, result.Rejected, 2)
+
+		for _, r := range result.Rejected {
+			require.Equal(t, ipfslog.JoinRejectedAccess, r.Reason)
+			requireQuotaError(t, r.Err, accesscontroller.QuotaLimitRate)
+		}
+	})
+
+	t.Run("calls the wrapped access controller", func(t *testing.T) {
+		log1 := newLog(t, identities[0], accesscontroller.NewQuota(&TestACL{refIdentity: identities[0]}, &accesscontroller.QuotaOptions{MaxEntrySize: 10}))
+
+		_, err := log1.Append(ctx, []byte("one"), nil)
+		require.Error(t, err)
+		require.NotErrorIs(t, err, errmsg.ErrQuotaExceeded)
+	})
+
+	t.Run("counts the entries once", func(t *testing.T) {
+		quota := accesscontroller.NewQuota(nil, &accesscontroller.QuotaOptions{MaxEntries: 2})
+		log1 := newLog(t, identities[0], quota)
+
+		var head iface.IPFSLogEntry
+		for _, payload := range []string{"A1", "A2"} {
+			head, err = log1.Append(ctx, []byte(payload), nil)
+			require.NoError(t, err)
+		}
+
+		log2, err := ipfslog.NewFromEntryHash(ctx, ipfs, identities[1], head.GetHash(), &ipfslog.LogOptions{ID: "X"}, &ipfslog.FetchOptions{AccessController: quota})
+		require.NoError(t, err)
+		require.Equal(t, 2, log2.Len())
+	})
+
+	t.Run("does not count the entries of a failed join", func(t *testing.T) {
+		other := newLog(t, identities[0], nil)
+		for _, payload := range []string{"A1", "denied"} {
+			_, err := other.Append(ctx, []byte(payload), nil)
+			require.NoError(t, err)
+		}
+
+		log1 := newLog(t, identities[0], accesscontroller.NewQuota(denyPayloadACL("denied"), &accesscontroller.QuotaOptions{MaxEntries: 2}))
+
+		_, err := log1.Join(other, -1)
+		require.ErrorContains(t, err, "denied payload")
+		require.Equal(t, 0, log1.Len())
+
+		for _, payload := range []string{"A1", "A2"} {
+			_, err := log1.Append(ctx, []byte(payload), nil)
+			require.NoError(t, err)
+		}
+	})
+
+	t.Run("counts the entries of each log instance", func(t *testing.T) {
+		quota := accesscontroller.NewQuota(nil, &accesscontroller.QuotaOptions{MaxEntries: 2})
+
+		for i := 0; i < 2; i++ {
+			log1 := newLog(t, identities[0], quota)
+			for j := 1; j <= 2; j++ {
+				_, err := log1.Append(ctx, []byte(fmt.Sprintf("A%d-%d", j, i)), nil)
+				require.NoError(t, err)
+			}
+		}
+	})
+
+	t.Run("verifies the identity of the authors", func(t *testing.T) {
+		log1 := newLog(t, identities[0], nil)
+
+		e, err := log1.Append(ctx, []byte("A1"), nil)
+		require.NoError(t, err)
+
+		forged := *e.GetIdentity()
+		forged.ID = identities[1].ID
+
+		e = e.Copy()
+		e.SetIdentity(&forged)
+
+		err = accesscontroller.NewQuota(nil, &accesscontroller.QuotaOptions{MaxEntries: 2}).CanAppend(e, nil, nil)
+		require.ErrorContains(t, err, errmsg.ErrIdentityUnknown.Error())
+	})
+}
+
+// denyPayloadACL denies the entries with a given payload.
+type denyPayloadACL string
+
+func (d denyPayloadACL) CanAppend(e accesscontroller.LogEntry, _ idp.Interface, _ accesscontroller.CanAppendAdditionalContext) error {
+	if string(e.GetPayload()) == string(d) {
+		return errors.New("denied payload")
+	}
+
+	return nil
+}
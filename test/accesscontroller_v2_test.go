@@ -0,0 +1,205 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	ipfslog "berty.tech/go-ipfs-log"
+	"berty.tech/go-ipfs-log/accesscontroller"
+	"berty.tech/go-ipfs-log/entry"
+	"berty.tech/go-ipfs-log/errmsg"
+	idp "berty.tech/go-ipfs-log/identityprovider"
+	ks "berty.tech/go-ipfs-log/keystore"
+	"github.com/ipfs/go-cid"
+	dssync "github.com/ipfs/go-datastore/sync"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// funcACL is an InterfaceV2 access controller calling a function.
+type funcACL func(ctx context.Context, entry accesscontroller.LogEntry, view accesscontroller.LogView) error
+
+func (f funcACL) CanAppendV2(ctx context.Context, entry accesscontroller.LogEntry, _ idp.Interface, view accesscontroller.LogView) error {
+	return f(ctx, entry, view)
+}
+
+func TestAccessControllerV2(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	m := mocknet.New()
+	defer m.Close()
+	ipfs, closeNode := NewMemoryServices(ctx, t, m)
+	defer closeNode()
+
+	keystore, err := ks.NewKeystore(dssync.MutexWrap(NewIdentityDataStore(t)))
+	require.NoError(t, err)
+
+	var identities [2]*idp.Identity
+	for i, char := range []rune{'A', 'B'} {
+		identity, err := idp.CreateIdentity(ctx, &idp.CreateIdentityOptions{
+			Keystore: keystore,
+			ID:       fmt.Sprintf("user%c", char),
+			Type:     "orbitdb",
+		})
+		require.NoError(t, err)
+
+		identities[i] = identity
+	}
+
+	t.Run("gives a view of the log on append", func(t *testing.T) {
+		var (
+			heads     []string
+			ancestors []string
+		)
+
+		ac := funcACL(func(ctx context.Context, entry accesscontroller.LogEntry, view accesscontroller.LogView) error {
+			require.Equal(t, "X", view.GetLogID())
+
+			heads = nil
+			for _, h := range view.GetHeads() {
+				heads = append(heads, string(h.GetPayload()))
+
+				e, ok := view.GetEntry(h.GetHash())
+				require.True(t, ok)
+				require.Equal(t, h.GetHash(), e.GetHash())
+			}
+
+			entries, err := view.GetAncestors(ctx, entry.(accesscontroller.CausalLogEntry))
+			require.NoError(t, err)
+
+			ancestors = nil
+			for _, e := range entries {
+				ancestors = append(ancestors, string(e.GetPayload()))
+			}
+
+			return nil
+		})
+
+		log1, err := ipfslog.NewLog(ipfs, identities[0], &ipfslog.LogOptions{ID: "X", AccessControllerV2: ac})
+		require.NoError(t, err)
+
+		for i := 1; i <= 3; i++ {
+			_, err = log1.Append(ctx, []byte(fmt.Sprintf("A%d", i)), nil)
+			require.NoError(t, err)
+		}
+
+		require.Equal(t, []string{"A2"}, heads)
+		require.ElementsMatch(t, []string{"A1", "A2"}, ancestors)
+	})
+
+	t.Run("looks up the joined entries", func(t *testing.T) {
+		other, err := ipfslog.NewLog(ipfs, identities[1], &ipfslog.LogOptions{ID: "X"})
+		require.NoError(t, err)
+
+		for i := 1; i <= 3; i++ {
+			_, err = other.Append(ctx, []byte(fmt.Sprintf("B%d", i)), nil)
+			require.NoError(t, err)
+		}
+
+		var (
+			lock      sync.Mutex
+			ancestors = map[string]int{}
+		)
+
+		ac := funcACL(func(ctx context.Context, entry accesscontroller.LogEntry, view accesscontroller.LogView) error {
+			entries, err := view.GetAncestors(ctx, entry.(accesscontroller.CausalLogEntry))
+			require.NoError(t, err)
+
+			lock.Lock()
+			ancestors[string(entry.GetPayload())] = len(entries)
+			lock.Unlock()
+
+			return nil
+		})
+
+		log1, err := ipfslog.NewLog(ipfs, identities[0], &ipfslog.LogOptions{ID: "X", AccessControllerV2: ac})
+		require.NoError(t, err)
+
+		_, err = log1.Join(other, -1)
+		require.NoError(t, err)
+		require.Equal(t, map[string]int{"B1": 0, "B2": 1, "B3": 2}, ancestors)
+	})
+
+	t.Run("passes the context of the check", func(t *testing.T) {
+		ac := funcACL(func(ctx context.Context, entry accesscontroller.LogEntry, view accesscontroller.LogView) error {
+			// a call to a policy service
+			<-ctx.Done()
+
+			return ctx.Err()
+		})
+
+		log1, err := ipfslog.NewLog(ipfs, identities[0], &ipfslog.LogOptions{ID: "X", AccessControllerV2: ac})
+		require.NoError(t, err)
+
+		canceled, cancel := context.WithCancel(ctx)
+		cancel()
+
+		_, err = log1.Append(canceled, []byte("one"), nil)
+		require.Error(t, err)
+		require.ErrorIs(t, err, context.Canceled)
+		require.Equal(t, 0, log1.Len())
+
+		other, err := ipfslog.NewLog(ipfs, identities[1], &ipfslog.LogOptions{ID: "X"})
+		require.NoError(t, err)
+
+		_, err = other.Append(ctx, []byte("B1"), nil)
+		require.NoError(t, err)
+
+		_, err = log1.JoinWithOptions(canceled, other, nil)
+		require.Error(t, err)
+		require.Equal(t, 0, log1.Len())
+	})
+
+	t.Run("checks fetched entries", func(t *testing.T) {
+		log1, err := ipfslog.NewLog(ipfs, identities[0], &ipfslog.LogOptions{ID: "X"})
+		require.NoError(t, err)
+
+		for i := 1; i <= 3; i++ {
+			_, err = log1.Append(ctx, []byte(fmt.Sprintf("A%d", i)), nil)
+			require.NoError(t, err)
+		}
+
+		ac := funcACL(func(ctx context.Context, entry accesscontroller.LogEntry, view accesscontroller.LogView) error {
+			require.Equal(t, "X", view.GetLogID())
+
+			if string(entry.GetPayload()) == "A2" {
+				return errmsg.ErrLogAppendDenied
+			}
+
+			return nil
+		})
+
+		// A3 follows a rejected entry, A1 is not traversed
+		res, report := entry.FetchAllWithReport(ctx, ipfs, []cid.Cid{log1.Heads().At(0).GetHash()}, &entry.FetchOptions{AccessControllerV2: ac})
+		require.Empty(t, res)
+		require.Len(t, report.Rejected, 2)
+
+		_, err = ipfslog.NewFromEntryHash(ctx, ipfs, identities[1], log1.Heads().At(0).GetHash(), &ipfslog.LogOptions{ID: "X"}, &ipfslog.FetchOptions{AccessControllerV2: ac})
+		require.ErrorContains(t, err, errmsg.ErrLogHeadsNotLoaded.Error())
+	})
+
+	t.Run("adapts v1 controllers", func(t *testing.T) {
+		log1, err := ipfslog.NewLog(ipfs, identities[0], &ipfslog.LogOptions{ID: "X"})
+		require.NoError(t, err)
+
+		e, err := log1.Append(ctx, []byte("one"), nil)
+		require.NoError(t, err)
+
+		ac := accesscontroller.FromV1(&TestACL{refIdentity: identities[1]})
+		require.NoError(t, ac.CanAppendV2(ctx, e, identities[0].Provider, nil))
+
+		denied := accesscontroller.FromV1(&TestACL{refIdentity: identities[0]})
+		require.Error(t, denied.CanAppendV2(ctx, e, identities[0].Provider, nil))
+
+		canceled, cancel := context.WithCancel(ctx)
+		cancel()
+		require.ErrorIs(t, ac.CanAppendV2(canceled, e, identities[0].Provider, nil), context.Canceled)
+
+		// controllers implementing both interfaces are called directly
+		inLog := accesscontroller.NewInLog(identities[0].ID)
+		require.Equal(t, inLog, accesscontroller.FromV1(inLog))
+	})
+}
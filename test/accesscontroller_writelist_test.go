@@ -0,0 +1,146 @@
+package test
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"testing"
+
+	ipfslog "berty.tech/go-ipfs-log"
+	"berty.tech/go-ipfs-log/accesscontroller"
+	"berty.tech/go-ipfs-log/errmsg"
+	idp "berty.tech/go-ipfs-log/identityprovider"
+	ks "berty.tech/go-ipfs-log/keystore"
+	cid "github.com/ipfs/go-cid"
+	dssync "github.com/ipfs/go-datastore/sync"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteListAccessController(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	m := mocknet.New()
+	defer m.Close()
+	ipfs, closeNode := NewMemoryServices(ctx, t, m)
+	defer closeNode()
+
+	keystore, err := ks.NewKeystore(dssync.MutexWrap(NewIdentityDataStore(t)))
+	require.NoError(t, err)
+
+	var identities [2]*idp.Identity
+	for i, char := range []rune{'A', 'B'} {
+		identity, err := idp.CreateIdentity(ctx, &idp.CreateIdentityOptions{
+			Keystore: keystore,
+			ID:       fmt.Sprintf("user%c", char),
+			Type:     "orbitdb",
+		})
+		require.NoError(t, err)
+
+		identities[i] = identity
+	}
+
+	// joinFrom joins a log written by each identity into a log using the
+	// access controller
+	joinFrom := func(t *testing.T, ac accesscontroller.Interface) []string {
+		t.Helper()
+
+		log1, err := ipfslog.NewLog(ipfs, identities[0], &ipfslog.LogOptions{ID: "X", AccessController: ac})
+		require.NoError(t, err)
+
+		for _, identity := range identities {
+			other, err := ipfslog.NewLog(ipfs, identity, &ipfslog.LogOptions{ID: "X"})
+			require.NoError(t, err)
+
+			_, err = other.Append(ctx, []byte(identity.ID[:8]), nil)
+			require.NoError(t, err)
+
+			_, _ = log1.JoinWithOptions(ctx, other, &ipfslog.JoinOptions{Policy: ipfslog.JoinCausalSubset})
+		}
+
+		return entriesAsStrings(log1.Values())
+	}
+
+	t.Run("allows listed identity IDs", func(t *testing.T) {
+		require.Equal(t, []string{identities[0].ID[:8]}, joinFrom(t, accesscontroller.NewWriteList(identities[0].ID)))
+	})
+
+	t.Run("allows listed public keys", func(t *testing.T) {
+		ac := accesscontroller.NewWriteList(hex.EncodeToString(identities[1].PublicKey))
+		require.Equal(t, []string{identities[1].ID[:8]}, joinFrom(t, ac))
+	})
+
+	t.Run("allows anyone with the wildcard", func(t *testing.T) {
+		require.Len(t, joinFrom(t, accesscontroller.NewWriteList(accesscontroller.WriteListWildcard)), 2)
+	})
+
+	t.Run("denies appends of unlisted identities", func(t *testing.T) {
+		log1, err := ipfslog.NewLog(ipfs, identities[1], &ipfslog.LogOptions{ID: "X", AccessController: accesscontroller.NewWriteList(identities[0].ID)})
+		require.NoError(t, err)
+
+		_, err = log1.Append(ctx, []byte("one"), nil)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), errmsg.ErrLogAppendDenied.Error())
+	})
+
+	t.Run("denies forged identities", func(t *testing.T) {
+		forged := *identities[1]
+		forged.ID = identities[0].ID
+
+		e := &entryWithIdentity{identity: &forged}
+		err := accesscontroller.NewWriteList(identities[0].ID).CanAppend(e, identities[0].Provider, nil)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), errmsg.ErrIdentityUnknown.Error())
+	})
+
+	t.Run("is stored by CID", func(t *testing.T) {
+		ac := accesscontroller.NewWriteList(identities[0].ID, accesscontroller.WriteListWildcard)
+
+		c, err := ac.Save(ctx, ipfs)
+		require.NoError(t, err)
+
+		// the manifest is content addressed
+		again, err := ac.Save(ctx, ipfs)
+		require.NoError(t, err)
+		require.Equal(t, c, again)
+
+		loaded, err := accesscontroller.LoadWriteList(ctx, ipfs, c)
+		require.NoError(t, err)
+		require.Equal(t, ac, loaded)
+
+		empty, err := accesscontroller.NewWriteList().Save(ctx, ipfs)
+		require.NoError(t, err)
+
+		loaded, err = accesscontroller.LoadWriteList(ctx, ipfs, empty)
+		require.NoError(t, err)
+		require.Empty(t, loaded.Write)
+	})
+
+	t.Run("refuses other manifests", func(t *testing.T) {
+		node, err := cbornode.WrapObject(map[string]interface{}{"type": "other"}, mhTypeSha256, -1)
+		require.NoError(t, err)
+		require.NoError(t, ipfs.Put(ctx, node))
+
+		_, err = accesscontroller.LoadWriteList(ctx, ipfs, node.Cid())
+		require.Equal(t, errmsg.ErrManifestInvalid, err)
+
+		_, err = accesscontroller.LoadWriteList(ctx, ipfs, cid.Undef)
+		require.Error(t, err)
+	})
+}
+
+const mhTypeSha256 = 0x12
+
+type entryWithIdentity struct {
+	identity *idp.Identity
+}
+
+func (e *entryWithIdentity) GetPayload() []byte {
+	return nil
+}
+
+func (e *entryWithIdentity) GetIdentity() *idp.Identity {
+	return e.identity
+}
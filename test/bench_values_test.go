@@ -0,0 +1,152 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	ipfslog "berty.tech/go-ipfs-log"
+	"berty.tech/go-ipfs-log/entry"
+	idp "berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/iface"
+	"berty.tech/go-ipfs-log/keystore"
+	"github.com/ipfs/go-cid"
+	dssync "github.com/ipfs/go-datastore/sync"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	"github.com/stretchr/testify/require"
+)
+
+const benchValuesEntries = 100000
+
+// createUnsignedEntries creates a chain of entries with a fork every 100
+// entries, they are not signed nor stored to keep the setup fast.
+func createUnsignedEntries(identity *idp.Identity, count int) ([]iface.IPFSLogEntry, []iface.IPFSLogEntry) {
+	prefix := cid.Prefix{Version: 1, Codec: cid.DagCBOR, MhType: 0x12 /* sha2-256 */, MhLength: -1}
+
+	entries := make([]iface.IPFSLogEntry, 0, count)
+	var heads []iface.IPFSLogEntry
+
+	for i := 0; i < count; i++ {
+		next := make([]cid.Cid, len(heads))
+		time := 0
+		for j, h := range heads {
+			next[j] = h.GetHash()
+			if h.GetClock().GetTime() > time {
+				time = h.GetClock().GetTime()
+			}
+		}
+
+		payload := []byte(fmt.Sprintf("entry%d", i))
+		hash, _ := prefix.Sum(payload)
+
+		// concurrent writers use their own clock ID
+		clockID := identity.PublicKey
+		if i%100 == 99 {
+			clockID = []byte(fmt.Sprintf("fork%d", i))
+		}
+
+		e := &entry.Entry{
+			Payload:  payload,
+			LogID:    "A",
+			Next:     next,
+			Refs:     []cid.Cid{},
+			V:        2,
+			Hash:     hash,
+			Clock:    entry.NewLamportClock(clockID, time+1),
+			Identity: identity,
+		}
+
+		entries = append(entries, e)
+
+		// a fork is concurrent to the previous entry, and merged by the next one
+		if i%100 == 99 && len(heads) > 0 {
+			e.Next = heads[0].GetNext()
+			e.Clock = entry.NewLamportClock(clockID, heads[0].GetClock().GetTime())
+			heads = append(heads, e)
+		} else {
+			heads = []iface.IPFSLogEntry{e}
+		}
+	}
+
+	return entries, heads
+}
+
+func BenchmarkValues(b *testing.B) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	m := mocknet.New()
+	defer m.Close()
+
+	ipfs, closeNode := NewMemoryServices(ctx, b, m)
+	defer closeNode()
+
+	ks, err := keystore.NewKeystore(dssync.MutexWrap(NewIdentityDataStore(b)))
+	require.NoError(b, err)
+
+	identity, err := idp.CreateIdentity(ctx, &idp.CreateIdentityOptions{
+		Keystore: ks,
+		ID:       "userA",
+		Type:     "orbitdb",
+	})
+	require.NoError(b, err)
+
+	entries, heads := createUnsignedEntries(identity, benchValuesEntries)
+
+	newLog := func() *ipfslog.IPFSLog {
+		log, err := ipfslog.NewLog(ipfs, identity, &ipfslog.LogOptions{
+			ID:      "A",
+			Entries: entry.NewOrderedMapFromEntries(entries),
+			Heads:   heads,
+		})
+		require.NoError(b, err)
+
+		return log
+	}
+
+	b.Run("traversal", func(b *testing.B) {
+		for n := 0; n < b.N; n++ {
+			b.StopTimer()
+			log := newLog()
+			b.StartTimer()
+
+			require.Equal(b, benchValuesEntries, log.Values().Len())
+		}
+	})
+
+	b.Run("cached", func(b *testing.B) {
+		log := newLog()
+		log.Values()
+
+		b.ResetTimer()
+		for n := 0; n < b.N; n++ {
+			require.Equal(b, benchValuesEntries, log.Values().Len())
+		}
+	})
+
+	b.Run("iterator", func(b *testing.B) {
+		log := newLog()
+		log.Values()
+		amount := 100
+
+		b.ResetTimer()
+		for n := 0; n < b.N; n++ {
+			output := make(chan iface.IPFSLogEntry, amount)
+			require.NoError(b, log.Iterator(&ipfslog.IteratorOptions{Amount: &amount}, output))
+			require.Len(b, output, amount)
+		}
+	})
+
+	b.Run("append then values", func(b *testing.B) {
+		log := newLog()
+		log.Values()
+
+		b.ResetTimer()
+		for n := 0; n < b.N; n++ {
+			_, err := log.Append(ctx, []byte(fmt.Sprintf("%d", n)), nil)
+			require.NoError(b, err)
+
+			require.Equal(b, benchValuesEntries+n+1, log.Values().Len())
+		}
+	})
+}
@@ -0,0 +1,200 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	ipfslog "berty.tech/go-ipfs-log"
+	"berty.tech/go-ipfs-log/entry"
+	idp "berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/iface"
+	ks "berty.tech/go-ipfs-log/keystore"
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	dssync "github.com/ipfs/go-datastore/sync"
+	format "github.com/ipfs/go-ipld-format"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// interruptingStorage cancels the fetch after a number of reads, as if the
+// process had been killed.
+type interruptingStorage struct {
+	iface.Storage
+
+	lock   sync.Mutex
+	limit  int
+	reads  int
+	cancel context.CancelFunc
+}
+
+func (s *interruptingStorage) Get(ctx context.Context, c cid.Cid) (format.Node, error) {
+	s.lock.Lock()
+	s.reads++
+	if s.reads > s.limit {
+		s.cancel()
+	}
+	s.lock.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return s.Storage.Get(ctx, c)
+}
+
+func TestFetcherCheckpoint(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	m := mocknet.New()
+	defer m.Close()
+	ipfs, closeNode := NewMemoryServices(ctx, t, m)
+	defer closeNode()
+
+	keystore, err := ks.NewKeystore(dssync.MutexWrap(NewIdentityDataStore(t)))
+	require.NoError(t, err)
+
+	var identities [2]*idp.Identity
+	for i, char := range []rune{'A', 'B'} {
+		identity, err := idp.CreateIdentity(ctx, &idp.CreateIdentityOptions{
+			Keystore: keystore,
+			ID:       fmt.Sprintf("user%c", char),
+			Type:     "orbitdb",
+		})
+		require.NoError(t, err)
+
+		identities[i] = identity
+	}
+
+	logA, err := ipfslog.NewLog(ipfs, identities[0], &ipfslog.LogOptions{ID: "X"})
+	require.NoError(t, err)
+
+	logB, err := ipfslog.NewLog(ipfs, identities[1], &ipfslog.LogOptions{ID: "X"})
+	require.NoError(t, err)
+
+	for i := 0; i < 20; i++ {
+		_, err := logA.Append(ctx, []byte(fmt.Sprintf("A%d", i)), &ipfslog.AppendOptions{PointerCount: 4})
+		require.NoError(t, err)
+
+		_, err = logB.Append(ctx, []byte(fmt.Sprintf("B%d", i)), nil)
+		require.NoError(t, err)
+
+		if i%5 == 4 {
+			_, err = logA.Join(logB, -1)
+			require.NoError(t, err)
+		}
+	}
+
+	heads := []cid.Cid{}
+	for _, h := range logA.Heads().Slice() {
+		heads = append(heads, h.GetHash())
+	}
+
+	hashes := func(entries []iface.IPFSLogEntry) []string {
+		ret := make([]string, len(entries))
+		for i, e := range entries {
+			ret[i] = e.GetHash().String()
+		}
+
+		return ret
+	}
+
+	checkpointKeys := func(t *testing.T, store ds.Datastore) int {
+		t.Helper()
+
+		results, err := store.Query(ctx, query.Query{KeysOnly: true})
+		require.NoError(t, err)
+
+		all, err := results.Rest()
+		require.NoError(t, err)
+
+		return len(all)
+	}
+
+	expected, report := entry.FetchAllWithReport(ctx, ipfs, heads, &entry.FetchOptions{Concurrency: 1})
+	require.True(t, report.Complete())
+	require.Len(t, expected, logA.Len())
+
+	t.Run("resumes an interrupted fetch", func(t *testing.T) {
+		store := dssync.MutexWrap(ds.NewMapDatastore())
+
+		cctx, ccancel := context.WithCancel(ctx)
+		defer ccancel()
+
+		interrupted, report := entry.FetchAllWithReport(cctx, &interruptingStorage{Storage: ipfs, limit: 10, cancel: ccancel}, heads, &entry.FetchOptions{
+			Concurrency: 1,
+			Checkpoint:  store,
+		})
+		require.NotEmpty(t, report.Failed)
+		require.NoError(t, report.Checkpoint)
+		require.NotEmpty(t, interrupted)
+		require.Less(t, len(interrupted), len(expected))
+		require.NotZero(t, checkpointKeys(t, store))
+
+		storage := newFlakyStorage(ipfs, nil)
+
+		resumed, report := entry.FetchAllWithReport(ctx, storage, heads, &entry.FetchOptions{
+			Concurrency: 1,
+			Checkpoint:  store,
+		})
+		require.True(t, report.Complete())
+		require.NoError(t, report.Checkpoint)
+		require.ElementsMatch(t, hashes(expected), hashes(resumed))
+
+		// the entries loaded before the interruption are not traversed again
+		for _, e := range interrupted {
+			require.Equal(t, 1, storage.reads[e.GetHash()])
+		}
+
+		// the checkpoint is cleared once the fetch is complete
+		require.Zero(t, checkpointKeys(t, store))
+	})
+
+	t.Run("resumes from the checkpoint alone", func(t *testing.T) {
+		store := dssync.MutexWrap(ds.NewMapDatastore())
+
+		cctx, ccancel := context.WithCancel(ctx)
+		defer ccancel()
+
+		_, report := entry.FetchAllWithReport(cctx, &interruptingStorage{Storage: ipfs, limit: 25, cancel: ccancel}, heads, &entry.FetchOptions{
+			Concurrency: 1,
+			Checkpoint:  store,
+		})
+		require.NotEmpty(t, report.Failed)
+
+		resumed, report := entry.FetchAllWithReport(ctx, ipfs, nil, &entry.FetchOptions{
+			Concurrency: 1,
+			Checkpoint:  store,
+		})
+		require.True(t, report.Complete())
+		require.ElementsMatch(t, hashes(expected), hashes(resumed))
+	})
+
+	t.Run("loads a log through a checkpoint", func(t *testing.T) {
+		store := dssync.MutexWrap(ds.NewMapDatastore())
+
+		hash, err := logA.ToMultihash(ctx)
+		require.NoError(t, err)
+
+		cctx, ccancel := context.WithCancel(ctx)
+		defer ccancel()
+
+		// interrupted once the heads are loaded
+		storage := &interruptingStorage{Storage: ipfs, limit: 25, cancel: ccancel}
+
+		interrupted, err := ipfslog.NewFromMultihash(cctx, storage, identities[0], hash, &ipfslog.LogOptions{}, &ipfslog.FetchOptions{Concurrency: 1, Checkpoint: store})
+		require.NoError(t, err)
+		require.NotZero(t, interrupted.Len())
+		require.Less(t, interrupted.Len(), logA.Len())
+		require.Subset(t, logA.Values().Keys(), interrupted.Values().Keys())
+		require.NotZero(t, checkpointKeys(t, store))
+
+		res, err := ipfslog.NewFromMultihash(ctx, ipfs, identities[0], hash, &ipfslog.LogOptions{}, &ipfslog.FetchOptions{Checkpoint: store})
+		require.NoError(t, err)
+		require.Equal(t, logA.Values().Keys(), res.Values().Keys())
+	})
+}
@@ -0,0 +1,194 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	ipfslog "berty.tech/go-ipfs-log"
+	"berty.tech/go-ipfs-log/entry"
+	idp "berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/iface"
+	ks "berty.tech/go-ipfs-log/keystore"
+	cid "github.com/ipfs/go-cid"
+	dssync "github.com/ipfs/go-datastore/sync"
+	format "github.com/ipfs/go-ipld-format"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// flakyStorage fails to read the given blocks a number of times before
+// returning them.
+type flakyStorage struct {
+	iface.Storage
+
+	lock     sync.Mutex
+	failures map[cid.Cid]int
+	reads    map[cid.Cid]int
+}
+
+func newFlakyStorage(storage iface.Storage, failures map[cid.Cid]int) *flakyStorage {
+	return &flakyStorage{
+		Storage:  storage,
+		failures: failures,
+		reads:    map[cid.Cid]int{},
+	}
+}
+
+func (s *flakyStorage) Get(ctx context.Context, c cid.Cid) (format.Node, error) {
+	s.lock.Lock()
+	s.reads[c]++
+	fail := s.reads[c] <= s.failures[c]
+	s.lock.Unlock()
+
+	if fail {
+		return nil, fmt.Errorf("unable to read block %s", c)
+	}
+
+	return s.Storage.Get(ctx, c)
+}
+
+func TestFetcherReport(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	m := mocknet.New()
+	defer m.Close()
+	ipfs, closeNode := NewMemoryServices(ctx, t, m)
+	defer closeNode()
+
+	keystore, err := ks.NewKeystore(dssync.MutexWrap(NewIdentityDataStore(t)))
+	require.NoError(t, err)
+
+	identity, err := idp.CreateIdentity(ctx, &idp.CreateIdentityOptions{
+		Keystore: keystore,
+		ID:       "userA",
+		Type:     "orbitdb",
+	})
+	require.NoError(t, err)
+
+	log1, err := ipfslog.NewLog(ipfs, identity, &ipfslog.LogOptions{ID: "X"})
+	require.NoError(t, err)
+
+	var entries []iface.IPFSLogEntry
+	for i := 0; i < 10; i++ {
+		e, err := log1.Append(ctx, []byte(fmt.Sprintf("entry%d", i)), nil)
+		require.NoError(t, err)
+
+		entries = append(entries, e)
+	}
+
+	head := entries[len(entries)-1].GetHash()
+	flaky := entries[5].GetHash()
+
+	t.Run("retries failed reads", func(t *testing.T) {
+		storage := newFlakyStorage(ipfs, map[cid.Cid]int{flaky: 2})
+
+		res, report := entry.FetchAllWithReport(ctx, storage, []cid.Cid{head}, &entry.FetchOptions{
+			Retries:      3,
+			RetryBackoff: time.Millisecond,
+		})
+		require.Len(t, res, 10)
+		require.True(t, report.Complete())
+		require.Empty(t, report.Failed)
+		require.Equal(t, 3, storage.reads[flaky])
+	})
+
+	t.Run("reports failed reads", func(t *testing.T) {
+		storage := newFlakyStorage(ipfs, map[cid.Cid]int{flaky: 2})
+
+		res, report := entry.FetchAllWithReport(ctx, storage, []cid.Cid{head}, &entry.FetchOptions{})
+		require.Len(t, res, 4)
+		require.False(t, report.Complete())
+		require.Len(t, report.Failed, 1)
+		require.Contains(t, report.Failed, flaky)
+		require.Error(t, report.Failed[flaky])
+	})
+
+	t.Run("gives up after the last retry", func(t *testing.T) {
+		storage := newFlakyStorage(ipfs, map[cid.Cid]int{flaky: 10})
+
+		_, report := entry.FetchAllWithReport(ctx, storage, []cid.Cid{head}, &entry.FetchOptions{
+			Retries:      2,
+			RetryBackoff: time.Millisecond,
+		})
+		require.Contains(t, report.Failed, flaky)
+		require.Equal(t, 3, storage.reads[flaky])
+	})
+
+	t.Run("reports truncated entries", func(t *testing.T) {
+		res, report := entry.FetchAllWithReport(ctx, ipfs, []cid.Cid{head}, &entry.FetchOptions{Length: intPtr(3)})
+		require.Len(t, res, 3)
+		require.False(t, report.Complete())
+		require.Empty(t, report.Failed)
+		require.NotEmpty(t, report.Truncated)
+
+		for _, c := range report.Truncated {
+			for _, e := range res {
+				require.NotEqual(t, e.GetHash(), c)
+			}
+		}
+	})
+
+	t.Run("reports excluded entries", func(t *testing.T) {
+		excluded := entries[2].GetHash()
+
+		res, report := entry.FetchAllWithReport(ctx, ipfs, []cid.Cid{head}, &entry.FetchOptions{
+			ShouldExclude: func(c cid.Cid) bool { return c.Equals(excluded) },
+		})
+		require.Len(t, res, 7)
+		require.True(t, report.Complete())
+		require.Equal(t, []cid.Cid{excluded}, report.Excluded)
+	})
+
+	t.Run("reports through the log loaders", func(t *testing.T) {
+		logHash, err := log1.ToMultihash(ctx)
+		require.NoError(t, err)
+
+		loaders := map[string]func(storage iface.Storage, report *entry.FetchReport) (*ipfslog.IPFSLog, error){
+			"NewFromEntryHash": func(storage iface.Storage, report *entry.FetchReport) (*ipfslog.IPFSLog, error) {
+				return ipfslog.NewFromEntryHash(ctx, storage, identity, head, &ipfslog.LogOptions{ID: "X"}, &ipfslog.FetchOptions{Report: report})
+			},
+			"NewFromMultihash": func(storage iface.Storage, report *entry.FetchReport) (*ipfslog.IPFSLog, error) {
+				return ipfslog.NewFromMultihash(ctx, storage, identity, logHash, &ipfslog.LogOptions{}, &ipfslog.FetchOptions{Report: report})
+			},
+			"NewFromJSON": func(storage iface.Storage, report *entry.FetchReport) (*ipfslog.IPFSLog, error) {
+				return ipfslog.NewFromJSON(ctx, storage, identity, log1.ToJSONLog(), &ipfslog.LogOptions{}, &entry.FetchOptions{Report: report})
+			},
+			"NewFromEntry": func(storage iface.Storage, report *entry.FetchReport) (*ipfslog.IPFSLog, error) {
+				return ipfslog.NewFromEntry(ctx, storage, identity, []iface.IPFSLogEntry{entries[len(entries)-1]}, &ipfslog.LogOptions{}, &entry.FetchOptions{Report: report})
+			},
+		}
+
+		for name, load := range loaders {
+			report := &entry.FetchReport{}
+			_, err := load(newFlakyStorage(ipfs, map[cid.Cid]int{flaky: 1}), report)
+			require.NoError(t, err, name)
+			require.False(t, report.Complete(), name)
+			require.Contains(t, report.Failed, flaky, name)
+
+			report = &entry.FetchReport{}
+			l, err := load(ipfs, report)
+			require.NoError(t, err, name)
+			require.True(t, report.Complete(), name)
+			require.Equal(t, 10, l.Values().Len(), name)
+		}
+	})
+
+	t.Run("forwards the fetch options of NewFromJSON", func(t *testing.T) {
+		storage := newFlakyStorage(ipfs, map[cid.Cid]int{flaky: 2})
+		report := &entry.FetchReport{}
+
+		l, err := ipfslog.NewFromJSON(ctx, storage, identity, log1.ToJSONLog(), &ipfslog.LogOptions{}, &entry.FetchOptions{
+			Retries:        2,
+			RetryBackoff:   time.Millisecond,
+			SinceClockTime: 2,
+			Report:         report,
+		})
+		require.NoError(t, err)
+		require.True(t, report.Complete())
+		require.Equal(t, 8, l.Values().Len())
+	})
+}
@@ -0,0 +1,136 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	ipfslog "berty.tech/go-ipfs-log"
+	"berty.tech/go-ipfs-log/entry"
+	"berty.tech/go-ipfs-log/errmsg"
+	idp "berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/iface"
+	"berty.tech/go-ipfs-log/io/cbor"
+	ks "berty.tech/go-ipfs-log/keystore"
+	cid "github.com/ipfs/go-cid"
+	dssync "github.com/ipfs/go-datastore/sync"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFetcherVerification(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	m := mocknet.New()
+	defer m.Close()
+	ipfs, closeNode := NewMemoryServices(ctx, t, m)
+	defer closeNode()
+
+	keystore, err := ks.NewKeystore(dssync.MutexWrap(NewIdentityDataStore(t)))
+	require.NoError(t, err)
+
+	var identities [2]*idp.Identity
+	for i, char := range []rune{'A', 'B'} {
+		identity, err := idp.CreateIdentity(ctx, &idp.CreateIdentityOptions{
+			Keystore: keystore,
+			ID:       fmt.Sprintf("user%c", char),
+			Type:     "orbitdb",
+		})
+		require.NoError(t, err)
+
+		identities[i] = identity
+	}
+
+	logA, err := ipfslog.NewLog(ipfs, identities[0], &ipfslog.LogOptions{ID: "X"})
+	require.NoError(t, err)
+
+	var last iface.IPFSLogEntry
+	for i := 1; i <= 5; i++ {
+		last, err = logA.Append(ctx, []byte(fmt.Sprintf("A%d", i)), nil)
+		require.NoError(t, err)
+	}
+
+	// forged reuses the signature of the last entry for another payload
+	forged := last.Copy()
+	forged.SetPayload([]byte("forged"))
+	forged.SetNext([]cid.Cid{last.GetHash()})
+	forged.SetClock(entry.NewLamportClock(last.GetClock().GetID(), last.GetClock().GetTime()+1))
+
+	io, err := cbor.IO(&entry.Entry{}, &entry.LamportClock{})
+	require.NoError(t, err)
+
+	forgedHash, err := entry.ToMultihashWithIO(ctx, forged, ipfs, nil, io)
+	require.NoError(t, err)
+
+	t.Run("loads valid entries", func(t *testing.T) {
+		res, report := entry.FetchAllWithReport(ctx, ipfs, []cid.Cid{last.GetHash()}, &entry.FetchOptions{
+			VerifySignatures: true,
+			Provider:         identities[0].Provider,
+			AccessController: &TestACL{refIdentity: identities[1]},
+		})
+		require.Len(t, res, 5)
+		require.True(t, report.Complete())
+	})
+
+	t.Run("rejects an invalid signature without traversing its ancestors", func(t *testing.T) {
+		storage := newFlakyStorage(ipfs, nil)
+
+		res, report := entry.FetchAllWithReport(ctx, storage, []cid.Cid{forgedHash}, &entry.FetchOptions{
+			VerifySignatures: true,
+			Provider:         identities[0].Provider,
+		})
+		require.Empty(t, res)
+		require.False(t, report.Complete())
+		require.Len(t, report.Rejected, 1)
+		require.Contains(t, report.Rejected[forgedHash].Error(), errmsg.ErrSigNotVerified.Error())
+		require.Equal(t, map[cid.Cid]int{forgedHash: 1}, storage.reads)
+	})
+
+	t.Run("loads an invalid signature when not verifying", func(t *testing.T) {
+		res, report := entry.FetchAllWithReport(ctx, ipfs, []cid.Cid{forgedHash}, &entry.FetchOptions{})
+		require.Len(t, res, 6)
+		require.True(t, report.Complete())
+	})
+
+	t.Run("requires an identity provider to verify signatures", func(t *testing.T) {
+		res, report := entry.FetchAllWithReport(ctx, ipfs, []cid.Cid{last.GetHash()}, &entry.FetchOptions{VerifySignatures: true})
+		require.Empty(t, res)
+		require.Equal(t, errmsg.ErrIdentityProviderNotDefined, report.Rejected[last.GetHash()])
+	})
+
+	t.Run("rejects entries refused by the access controller", func(t *testing.T) {
+		logB, err := ipfslog.NewLog(ipfs, identities[1], &ipfslog.LogOptions{ID: "X"})
+		require.NoError(t, err)
+
+		_, err = logB.Join(logA, -1)
+		require.NoError(t, err)
+
+		var head iface.IPFSLogEntry
+		for i := 1; i <= 3; i++ {
+			head, err = logB.Append(ctx, []byte(fmt.Sprintf("B%d", i)), nil)
+			require.NoError(t, err)
+		}
+
+		storage := newFlakyStorage(ipfs, nil)
+
+		res, report := entry.FetchAllWithReport(ctx, storage, []cid.Cid{head.GetHash()}, &entry.FetchOptions{
+			Provider:         identities[0].Provider,
+			AccessController: &TestACL{refIdentity: identities[1]},
+		})
+		require.Empty(t, res)
+		require.Len(t, report.Rejected, 1)
+		require.Contains(t, report.Rejected[head.GetHash()].Error(), errmsg.ErrLogAppendDenied.Error())
+		require.Len(t, storage.reads, 1)
+	})
+
+	t.Run("verifies the entries of a log loaded from a hash", func(t *testing.T) {
+		_, err := ipfslog.NewFromEntryHash(ctx, ipfs, identities[0], forgedHash, &ipfslog.LogOptions{ID: "X"}, &ipfslog.FetchOptions{VerifySignatures: true})
+		require.ErrorContains(t, err, errmsg.ErrLogHeadsNotLoaded.Error())
+		require.ErrorContains(t, err, errmsg.ErrSigNotVerified.Error())
+
+		res, err := ipfslog.NewFromEntryHash(ctx, ipfs, identities[0], last.GetHash(), &ipfslog.LogOptions{ID: "X"}, &ipfslog.FetchOptions{VerifySignatures: true})
+		require.NoError(t, err)
+		require.Equal(t, []string{"A1", "A2", "A3", "A4", "A5"}, entriesAsStrings(res.Values()))
+	})
+}
@@ -0,0 +1,181 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	ipfslog "berty.tech/go-ipfs-log"
+	"berty.tech/go-ipfs-log/errmsg"
+	idp "berty.tech/go-ipfs-log/identityprovider"
+	ks "berty.tech/go-ipfs-log/keystore"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDIDKeyIdentityProvider(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	m := mocknet.New()
+	defer m.Close()
+	ipfs, closeNode := NewMemoryServices(ctx, t, m)
+	defer closeNode()
+
+	require.NoError(t, idp.AddIdentityProvider(idp.NewDIDKeyIdentityProvider))
+	defer idp.RemoveIdentityProvider("did:key")
+
+	keystore, err := ks.NewKeystore(dssync.MutexWrap(ds.NewMapDatastore()))
+	require.NoError(t, err)
+
+	reader, err := idp.CreateIdentity(ctx, &idp.CreateIdentityOptions{
+		Keystore: keystore,
+		ID:       "reader",
+		Type:     "orbitdb",
+	})
+	require.NoError(t, err)
+
+	for keyType, prefix := range map[ks.KeyType]string{
+		ks.KeyTypeEd25519:   "did:key:z6Mk",
+		ks.KeyTypeSecp256k1: "did:key:zQ3s",
+	} {
+		keyType, prefix := keyType, prefix
+
+		t.Run(fmt.Sprintf("creates %s identities", keyType), func(t *testing.T) {
+			options := &idp.CreateIdentityOptions{
+				Keystore: keystore,
+				ID:       fmt.Sprintf("writer-%s", keyType),
+				Type:     "did:key",
+				KeyType:  keyType,
+			}
+
+			identity, err := idp.CreateIdentity(ctx, options)
+			require.NoError(t, err)
+			require.True(t, strings.HasPrefix(identity.ID, prefix), identity.ID)
+			require.Equal(t, "did:key", identity.Type)
+			require.NoError(t, idp.VerifyIdentity(identity))
+
+			// the DID is derived from the signing key
+			pubKey, err := identity.GetPublicKey()
+			require.NoError(t, err)
+
+			didKey, err := idp.PublicKeyFromDIDKey(identity.ID)
+			require.NoError(t, err)
+			require.True(t, pubKey.Equals(didKey))
+
+			did, err := idp.DIDKeyFromPublicKey(pubKey)
+			require.NoError(t, err)
+			require.Equal(t, identity.ID, did)
+
+			// the same key is used again
+			again, err := idp.CreateIdentity(ctx, options)
+			require.NoError(t, err)
+			require.Equal(t, identity.ID, again.ID)
+			require.Equal(t, identity.PublicKey, again.PublicKey)
+
+			log1, err := ipfslog.NewLog(ipfs, identity, &ipfslog.LogOptions{ID: "X"})
+			require.NoError(t, err)
+
+			for _, payload := range []string{"one", "two"} {
+				_, err = log1.Append(ctx, []byte(payload), nil)
+				require.NoError(t, err)
+			}
+
+			log2, err := ipfslog.NewLog(ipfs, reader, &ipfslog.LogOptions{ID: "X"})
+			require.NoError(t, err)
+
+			_, err = log2.Join(log1, -1)
+			require.NoError(t, err)
+			require.Equal(t, []string{"one", "two"}, entriesAsStrings(log2.Values()))
+			require.Equal(t, identity.ID, log2.Values().At(0).GetIdentity().ID)
+		})
+	}
+
+	t.Run("rotates the key", func(t *testing.T) {
+		options := &idp.CreateIdentityOptions{
+			Keystore: keystore,
+			ID:       "rotated",
+			Type:     "did:key",
+			KeyType:  ks.KeyTypeEd25519,
+		}
+
+		identity, err := idp.CreateIdentity(ctx, options)
+		require.NoError(t, err)
+
+		log1, err := ipfslog.NewLog(ipfs, identity, &ipfslog.LogOptions{ID: "X"})
+		require.NoError(t, err)
+
+		_, err = log1.Append(ctx, []byte("one"), nil)
+		require.NoError(t, err)
+
+		rotated, rotation, err := idp.RotateIdentity(ctx, identity, options)
+		require.NoError(t, err)
+		require.NoError(t, rotation.Verify())
+		require.NoError(t, idp.VerifyIdentity(rotated))
+		require.NotEqual(t, identity.ID, rotated.ID)
+
+		// the DID is the one of the new key
+		pubKey, err := rotated.GetPublicKey()
+		require.NoError(t, err)
+
+		newKey, err := rotation.NewPublicKey()
+		require.NoError(t, err)
+		require.True(t, pubKey.Equals(newKey))
+
+		// the previous key is not kept under the previous DID
+		_, err = keystore.GetKey(ctx, identity.ID)
+		require.ErrorContains(t, err, errmsg.ErrKeyNotInKeystore.Error())
+
+		log1.SetIdentity(rotated)
+
+		e, err := log1.Append(ctx, []byte("two"), nil)
+		require.NoError(t, err)
+		require.Equal(t, rotated.ID, e.GetIdentity().ID)
+		require.NoError(t, e.Verify(rotated.Provider, log1.IO()))
+
+		log2, err := ipfslog.NewLog(ipfs, reader, &ipfslog.LogOptions{ID: "X"})
+		require.NoError(t, err)
+
+		_, err = log2.Join(log1, -1)
+		require.NoError(t, err)
+		require.Equal(t, []string{"one", "two"}, entriesAsStrings(log2.Values()))
+	})
+
+	t.Run("rejects identities claiming another DID", func(t *testing.T) {
+		victim, err := idp.CreateIdentity(ctx, &idp.CreateIdentityOptions{
+			Keystore: keystore,
+			ID:       "victim",
+			Type:     "did:key",
+			KeyType:  ks.KeyTypeEd25519,
+		})
+		require.NoError(t, err)
+
+		attacker, err := idp.CreateIdentity(ctx, &idp.CreateIdentityOptions{
+			Keystore: keystore,
+			ID:       "attacker",
+			Type:     "did:key",
+			KeyType:  ks.KeyTypeEd25519,
+		})
+		require.NoError(t, err)
+
+		forged := *attacker
+		forged.ID = victim.ID
+		require.Error(t, idp.VerifyIdentity(&forged))
+
+		forged = *victim
+		forged.PublicKey = attacker.PublicKey
+		forged.Signatures = attacker.Signatures
+		require.Error(t, idp.VerifyIdentity(&forged))
+	})
+
+	t.Run("rejects invalid DIDs", func(t *testing.T) {
+		_, err := idp.PublicKeyFromDIDKey("did:web:example.com")
+		require.Equal(t, errmsg.ErrDIDKeyInvalid, err)
+
+		_, err = idp.PublicKeyFromDIDKey("did:key:not-base58")
+		require.Equal(t, errmsg.ErrDIDKeyInvalid, err)
+	})
+}
@@ -0,0 +1,128 @@
+package test
+
+import (
+	"context"
+	"testing"
+
+	ipfslog "berty.tech/go-ipfs-log"
+	"berty.tech/go-ipfs-log/errmsg"
+	idp "berty.tech/go-ipfs-log/identityprovider"
+	ks "berty.tech/go-ipfs-log/keystore"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdentityVerification(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	m := mocknet.New()
+	defer m.Close()
+	ipfs, closeNode := NewMemoryServices(ctx, t, m)
+	defer closeNode()
+
+	keystore, err := ks.NewKeystore(dssync.MutexWrap(NewIdentityDataStore(t)))
+	require.NoError(t, err)
+
+	victim, err := idp.CreateIdentity(ctx, &idp.CreateIdentityOptions{
+		Keystore: keystore,
+		ID:       "userA",
+		Type:     "orbitdb",
+	})
+	require.NoError(t, err)
+
+	// the attacker has its own keystore
+	attackerKeystore, err := ks.NewKeystore(dssync.MutexWrap(ds.NewMapDatastore()))
+	require.NoError(t, err)
+
+	attacker, err := idp.CreateIdentity(ctx, &idp.CreateIdentityOptions{
+		Keystore: attackerKeystore,
+		ID:       "attacker",
+		Type:     "orbitdb",
+	})
+	require.NoError(t, err)
+
+	attackerKey, err := attackerKeystore.GetKey(ctx, attacker.ID)
+	require.NoError(t, err)
+
+	t.Run("verifies identities", func(t *testing.T) {
+		require.NoError(t, idp.VerifyIdentity(victim))
+		require.NoError(t, idp.VerifyIdentity(attacker))
+
+		// verified identities are cached, a modified copy is verified again
+		modified := *victim
+		modified.Signatures = &idp.IdentitySignature{
+			ID:        victim.Signatures.ID,
+			PublicKey: attacker.Signatures.PublicKey,
+		}
+		require.Error(t, idp.VerifyIdentity(&modified))
+
+		modified.Signatures = &idp.IdentitySignature{
+			ID:        attacker.Signatures.ID,
+			PublicKey: victim.Signatures.PublicKey,
+		}
+		require.Error(t, idp.VerifyIdentity(&modified))
+
+		modified = *victim
+		modified.PublicKey = attacker.PublicKey
+		require.Error(t, idp.VerifyIdentity(&modified))
+
+		require.Equal(t, errmsg.ErrIdentityNotDefined, idp.VerifyIdentity(nil))
+	})
+
+	t.Run("rejects entries of forged identities", func(t *testing.T) {
+		idSignature, err := attackerKey.Sign([]byte(victim.ID))
+		require.NoError(t, err)
+
+		// the forged identity claims the ID of the victim with the key of the
+		// attacker, the key of the victim ID never signed it
+		forged := &idp.Identity{
+			ID:        victim.ID,
+			PublicKey: attacker.PublicKey,
+			Signatures: &idp.IdentitySignature{
+				ID:        idSignature,
+				PublicKey: victim.Signatures.PublicKey,
+			},
+			Type:     victim.Type,
+			Provider: attacker.Provider,
+		}
+		require.NoError(t, attackerKeystore.PutKey(ctx, victim.ID, attackerKey))
+
+		forgedLog, err := ipfslog.NewLog(ipfs, forged, &ipfslog.LogOptions{ID: "X"})
+		require.NoError(t, err)
+
+		e, err := forgedLog.Append(ctx, []byte("forged"), nil)
+		require.NoError(t, err)
+		require.Error(t, e.Verify(victim.Provider, forgedLog.IO()))
+
+		log1, err := ipfslog.NewLog(ipfs, victim, &ipfslog.LogOptions{ID: "X"})
+		require.NoError(t, err)
+
+		result, err := log1.JoinWithOptions(ctx, forgedLog, nil)
+		require.Error(t, err)
+		require.Empty(t, result.Accepted)
+		require.Len(t, result.Rejected, 1)
+		require.Equal(t, ipfslog.JoinRejectedSignature, result.Rejected[0].Reason)
+		require.Equal(t, 0, log1.Len())
+
+		// loading fails on the rejected heads
+		_, err = ipfslog.NewFromEntryHash(ctx, ipfs, victim, e.GetHash(), &ipfslog.LogOptions{ID: "X"}, &ipfslog.FetchOptions{VerifySignatures: true})
+		require.ErrorContains(t, err, errmsg.ErrLogHeadsNotLoaded.Error())
+	})
+
+	t.Run("rejects entries signed by another key than their identity", func(t *testing.T) {
+		attackerLog, err := ipfslog.NewLog(ipfs, attacker, &ipfslog.LogOptions{ID: "X"})
+		require.NoError(t, err)
+
+		e, err := attackerLog.Append(ctx, []byte("one"), nil)
+		require.NoError(t, err)
+
+		// the entry claims to be from the victim
+		e.SetIdentity(victim)
+
+		err = e.Verify(victim.Provider, attackerLog.IO())
+		require.Equal(t, errmsg.ErrIdentityKeyMismatch, err)
+	})
+}
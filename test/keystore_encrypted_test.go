@@ -0,0 +1,239 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math"
+	"testing"
+
+	ipfslog "berty.tech/go-ipfs-log"
+	"berty.tech/go-ipfs-log/errmsg"
+	idp "berty.tech/go-ipfs-log/identityprovider"
+	ks "berty.tech/go-ipfs-log/keystore"
+	ds "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncryptedKeystore(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// keep the key derivation fast
+	options := &ks.EncryptedKeystoreOptions{Memory: 1024}
+
+	passphrase := []byte("correct horse battery staple")
+
+	t.Run("encrypts keys at rest", func(t *testing.T) {
+		store := dssync.MutexWrap(ds.NewMapDatastore())
+
+		keystore, err := ks.NewEncryptedKeystore(store, options)
+		require.NoError(t, err)
+		require.True(t, keystore.IsLocked())
+
+		_, err = keystore.CreateKey(ctx, "key")
+		require.Equal(t, errmsg.ErrKeystoreLocked, err)
+
+		require.NoError(t, keystore.Unlock(ctx, passphrase))
+		require.False(t, keystore.IsLocked())
+
+		priv, err := keystore.CreateKeyWithType(ctx, "key", ks.KeyTypeEd25519)
+		require.NoError(t, err)
+
+		raw, err := priv.Raw()
+		require.NoError(t, err)
+
+		results, err := store.Query(ctx, query.Query{})
+		require.NoError(t, err)
+
+		all, err := results.Rest()
+		require.NoError(t, err)
+
+		for _, e := range all {
+			require.False(t, bytes.Contains(e.Value, raw[:32]))
+		}
+
+		// a new instance requires the passphrase
+		reopened, err := ks.NewEncryptedKeystore(store, options)
+		require.NoError(t, err)
+
+		has, err := reopened.HasKey(ctx, "key")
+		require.NoError(t, err)
+		require.True(t, has)
+
+		_, err = reopened.GetKey(ctx, "key")
+		require.Equal(t, errmsg.ErrKeystoreLocked, err)
+
+		require.Equal(t, errmsg.ErrKeystorePassphraseInvalid, reopened.Unlock(ctx, []byte("wrong")))
+		require.True(t, reopened.IsLocked())
+
+		require.NoError(t, reopened.Unlock(ctx, passphrase))
+
+		stored, err := reopened.GetKey(ctx, "key")
+		require.NoError(t, err)
+		require.True(t, priv.Equals(stored))
+	})
+
+	t.Run("forgets keys once locked", func(t *testing.T) {
+		keystore, err := ks.NewEncryptedKeystore(dssync.MutexWrap(ds.NewMapDatastore()), options)
+		require.NoError(t, err)
+
+		require.NoError(t, keystore.Unlock(ctx, passphrase))
+
+		_, err = keystore.CreateKey(ctx, "key")
+		require.NoError(t, err)
+
+		keystore.Lock()
+
+		_, err = keystore.GetKey(ctx, "key")
+		require.Equal(t, errmsg.ErrKeystoreLocked, err)
+	})
+
+	t.Run("changes the passphrase", func(t *testing.T) {
+		store := dssync.MutexWrap(ds.NewMapDatastore())
+
+		keystore, err := ks.NewEncryptedKeystore(store, options)
+		require.NoError(t, err)
+
+		require.NoError(t, keystore.Unlock(ctx, passphrase))
+
+		priv, err := keystore.CreateKey(ctx, "key")
+		require.NoError(t, err)
+
+		newPassphrase := []byte("another passphrase")
+
+		require.Equal(t, errmsg.ErrKeystorePassphraseInvalid, keystore.ChangePassphrase(ctx, []byte("wrong"), newPassphrase))
+		require.NoError(t, keystore.ChangePassphrase(ctx, passphrase, newPassphrase))
+
+		reopened, err := ks.NewEncryptedKeystore(store, options)
+		require.NoError(t, err)
+
+		require.Equal(t, errmsg.ErrKeystorePassphraseInvalid, reopened.Unlock(ctx, passphrase))
+		require.NoError(t, reopened.Unlock(ctx, newPassphrase))
+
+		stored, err := reopened.GetKey(ctx, "key")
+		require.NoError(t, err)
+		require.True(t, priv.Equals(stored))
+	})
+
+	t.Run("migrates a plaintext keystore in place", func(t *testing.T) {
+		store := dssync.MutexWrap(NewIdentityDataStore(t))
+
+		plaintext, err := ks.NewKeystore(store)
+		require.NoError(t, err)
+
+		userA, err := plaintext.GetKey(ctx, "userA")
+		require.NoError(t, err)
+
+		ed25519, _, err := crypto.GenerateEd25519Key(nil)
+		require.NoError(t, err)
+		require.NoError(t, plaintext.PutKey(ctx, "device", ed25519))
+
+		keystore, err := ks.NewEncryptedKeystore(store, options)
+		require.NoError(t, err)
+
+		require.NoError(t, keystore.Unlock(ctx, passphrase))
+		require.NoError(t, keystore.Migrate(ctx, store))
+
+		has, err := store.Has(ctx, ds.NewKey("userA"))
+		require.NoError(t, err)
+		require.False(t, has)
+
+		migrated, err := keystore.GetKey(ctx, "userA")
+		require.NoError(t, err)
+		require.True(t, userA.Equals(migrated))
+
+		migrated, err = keystore.GetKey(ctx, "device")
+		require.NoError(t, err)
+		require.True(t, ed25519.Equals(migrated))
+	})
+
+	t.Run("signs log entries", func(t *testing.T) {
+		m := mocknet.New()
+		defer m.Close()
+		ipfs, closeNode := NewMemoryServices(ctx, t, m)
+		defer closeNode()
+
+		keystore, err := ks.NewEncryptedKeystore(dssync.MutexWrap(ds.NewMapDatastore()), options)
+		require.NoError(t, err)
+
+		require.NoError(t, keystore.Unlock(ctx, passphrase))
+
+		identity, err := idp.CreateIdentity(ctx, &idp.CreateIdentityOptions{
+			Keystore: keystore,
+			ID:       "userA",
+			Type:     "orbitdb",
+		})
+		require.NoError(t, err)
+
+		log1, err := ipfslog.NewLog(ipfs, identity, &ipfslog.LogOptions{ID: "X"})
+		require.NoError(t, err)
+
+		e, err := log1.Append(ctx, []byte("one"), nil)
+		require.NoError(t, err)
+		require.NoError(t, e.Verify(identity.Provider, log1.IO()))
+
+		keystore.Lock()
+
+		_, err = log1.Append(ctx, []byte("two"), nil)
+		require.Error(t, err)
+	})
+	t.Run("refuses out of bounds derivation parameters", func(t *testing.T) {
+		_, err := ks.NewEncryptedKeystore(dssync.MutexWrap(ds.NewMapDatastore()), &ks.EncryptedKeystoreOptions{Memory: 2 * 1024 * 1024})
+		require.ErrorIs(t, err, errmsg.ErrKDFParamsInvalid)
+
+		store := dssync.MutexWrap(ds.NewMapDatastore())
+
+		keystore, err := ks.NewEncryptedKeystore(store, options)
+		require.NoError(t, err)
+		require.NoError(t, keystore.Unlock(ctx, passphrase))
+
+		_, err = keystore.CreateKey(ctx, "key")
+		require.NoError(t, err)
+
+		exported, err := keystore.ExportKey(ctx, "key", passphrase)
+		require.NoError(t, err)
+
+		tamper := func(t *testing.T, data []byte, field string, value uint64) []byte {
+			t.Helper()
+
+			fields := map[string]interface{}{}
+			require.NoError(t, json.Unmarshal(data, &fields))
+			fields[field] = value
+
+			tampered, err := json.Marshal(fields)
+			require.NoError(t, err)
+
+			return tampered
+		}
+
+		cases := map[string]struct {
+			field string
+			value uint64
+		}{
+			"zero threads":     {"threads", 0},
+			"zero time":        {"time", 0},
+			"oversized time":   {"time", math.MaxUint32},
+			"oversized memory": {"memory", math.MaxUint32},
+		}
+
+		paramsKey := ds.NewKey("/encrypted-keystore/params")
+		params, err := store.Get(ctx, paramsKey)
+		require.NoError(t, err)
+
+		for name, c := range cases {
+			_, err := keystore.ImportKey(ctx, tamper(t, exported, c.field, c.value), passphrase)
+			require.ErrorIs(t, err, errmsg.ErrKDFParamsInvalid, name)
+
+			require.NoError(t, store.Put(ctx, paramsKey, tamper(t, params, c.field, c.value)))
+
+			reopened, err := ks.NewEncryptedKeystore(store, options)
+			require.NoError(t, err)
+			require.ErrorIs(t, reopened.Unlock(ctx, passphrase), errmsg.ErrKDFParamsInvalid, name)
+		}
+	})
+}
@@ -0,0 +1,328 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"testing"
+
+	ipfslog "berty.tech/go-ipfs-log"
+	"berty.tech/go-ipfs-log/errmsg"
+	idp "berty.tech/go-ipfs-log/identityprovider"
+	ks "berty.tech/go-ipfs-log/keystore"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeystoreKeyTypes(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for keyType, libp2pType := range map[ks.KeyType]int{
+		ks.KeyTypeDefault:   crypto.Secp256k1,
+		ks.KeyTypeSecp256k1: crypto.Secp256k1,
+		ks.KeyTypeEd25519:   crypto.Ed25519,
+		ks.KeyTypeECDSA:     crypto.ECDSA,
+	} {
+		keyType, libp2pType := keyType, libp2pType
+
+		t.Run(fmt.Sprintf("round-trips %s keys", keyType), func(t *testing.T) {
+			datastore := dssync.MutexWrap(NewIdentityDataStore(t))
+
+			keystore, err := ks.NewKeystore(datastore)
+			require.NoError(t, err)
+
+			priv, err := keystore.CreateKeyWithType(ctx, "key", keyType)
+			require.NoError(t, err)
+			require.Equal(t, libp2pType, int(priv.Type()))
+
+			// read it from the datastore rather than the cache
+			reopened, err := ks.NewKeystore(datastore)
+			require.NoError(t, err)
+
+			stored, err := reopened.GetKey(ctx, "key")
+			require.NoError(t, err)
+			require.True(t, priv.Equals(stored))
+
+			sig, err := reopened.Sign(stored, []byte("data"))
+			require.NoError(t, err)
+			require.NoError(t, keystore.Verify(sig, priv.GetPublic(), []byte("data")))
+		})
+	}
+
+	t.Run("reads raw Secp256k1 keys", func(t *testing.T) {
+		keystore, err := ks.NewKeystore(dssync.MutexWrap(NewIdentityDataStore(t)))
+		require.NoError(t, err)
+
+		priv, err := keystore.GetKey(ctx, "userA")
+		require.NoError(t, err)
+		require.Equal(t, crypto.Secp256k1, int(priv.Type()))
+	})
+
+	t.Run("stores an existing libp2p key", func(t *testing.T) {
+		keystore, err := ks.NewKeystore(dssync.MutexWrap(NewIdentityDataStore(t)))
+		require.NoError(t, err)
+
+		priv, _, err := crypto.GenerateEd25519Key(rand.Reader)
+		require.NoError(t, err)
+
+		require.NoError(t, keystore.PutKey(ctx, "device", priv))
+
+		stored, err := keystore.GetKey(ctx, "device")
+		require.NoError(t, err)
+		require.True(t, priv.Equals(stored))
+	})
+
+	t.Run("refuses unsupported key types", func(t *testing.T) {
+		keystore, err := ks.NewKeystore(dssync.MutexWrap(NewIdentityDataStore(t)))
+		require.NoError(t, err)
+
+		_, err = keystore.CreateKeyWithType(ctx, "key", ks.KeyType(42))
+		require.Equal(t, errmsg.ErrKeyTypeNotSupported, err)
+
+		priv, _, err := crypto.GenerateRSAKeyPair(2048, rand.Reader)
+		require.NoError(t, err)
+		require.Equal(t, errmsg.ErrKeyTypeNotSupported, keystore.PutKey(ctx, "key", priv))
+	})
+}
+
+func TestLogKeyTypes(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	m := mocknet.New()
+	defer m.Close()
+	ipfs, closeNode := NewMemoryServices(ctx, t, m)
+	defer closeNode()
+
+	keystore, err := ks.NewKeystore(dssync.MutexWrap(NewIdentityDataStore(t)))
+	require.NoError(t, err)
+
+	reader, err := idp.CreateIdentity(ctx, &idp.CreateIdentityOptions{
+		Keystore: keystore,
+		ID:       "userA",
+		Type:     "orbitdb",
+	})
+	require.NoError(t, err)
+
+	for _, keyType := range []ks.KeyType{ks.KeyTypeEd25519, ks.KeyTypeECDSA} {
+		t.Run(fmt.Sprintf("signs and verifies entries with %s keys", keyType), func(t *testing.T) {
+			identity, err := idp.CreateIdentity(ctx, &idp.CreateIdentityOptions{
+				Keystore: keystore,
+				ID:       fmt.Sprintf("writer-%s", keyType),
+				Type:     "orbitdb",
+				KeyType:  keyType,
+			})
+			require.NoError(t, err)
+
+			pubKey, err := identity.GetPublicKey()
+			require.NoError(t, err)
+			require.Equal(t, keyType.String(), pubKey.Type().String())
+
+			log1, err := ipfslog.NewLog(ipfs, identity, &ipfslog.LogOptions{ID: "X"})
+			require.NoError(t, err)
+
+			e, err := log1.Append(ctx, []byte("one"), nil)
+			require.NoError(t, err)
+			require.NoError(t, e.Verify(reader.Provider, log1.IO()))
+
+			_, err = log1.Append(ctx, []byte("two"), nil)
+			require.NoError(t, err)
+
+			// joining verifies the signatures of the entries
+			log2, err := ipfslog.NewLog(ipfs, reader, &ipfslog.LogOptions{ID: "X"})
+			require.NoError(t, err)
+
+			_, err = log2.Join(log1, -1)
+			require.NoError(t, err)
+			require.Equal(t, []string{"one", "two"}, entriesAsStrings(log2.Values()))
+
+			// as does loading with signature verification
+			log3, err := ipfslog.NewFromEntryHash(ctx, ipfs, reader, log1.Heads().At(0).GetHash(), &ipfslog.LogOptions{ID: "X"}, &ipfslog.FetchOptions{VerifySignatures: true})
+			require.NoError(t, err)
+			require.Equal(t, 2, log3.Len())
+		})
+	}
+}
+
+func TestKeystoreLifecycle(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	newKeystores := map[string]func(t *testing.T) ks.LifecycleInterface{
+		"plaintext": func(t *testing.T) ks.LifecycleInterface {
+			keystore, err := ks.NewKeystore(dssync.MutexWrap(ds.NewMapDatastore()))
+			require.NoError(t, err)
+
+			return keystore
+		},
+		"encrypted": func(t *testing.T) ks.LifecycleInterface {
+			keystore, err := ks.NewEncryptedKeystore(dssync.MutexWrap(ds.NewMapDatastore()), &ks.EncryptedKeystoreOptions{Memory: 1024})
+			require.NoError(t, err)
+			require.NoError(t, keystore.Unlock(ctx, []byte("passphrase")))
+
+			return keystore
+		},
+	}
+
+	for name, newKeystore := range newKeystores {
+		newKeystore := newKeystore
+
+		t.Run(fmt.Sprintf("lists and deletes %s keys", name), func(t *testing.T) {
+			keystore := newKeystore(t)
+
+			for _, id := range []string{"a", "b", "c"} {
+				_, err := keystore.CreateKey(ctx, id)
+				require.NoError(t, err)
+			}
+
+			ids, err := keystore.ListKeys(ctx)
+			require.NoError(t, err)
+			require.ElementsMatch(t, []string{"a", "b", "c"}, ids)
+
+			require.NoError(t, keystore.DeleteKey(ctx, "b"))
+
+			ids, err = keystore.ListKeys(ctx)
+			require.NoError(t, err)
+			require.ElementsMatch(t, []string{"a", "c"}, ids)
+
+			_, err = keystore.GetKey(ctx, "b")
+			require.Error(t, err)
+		})
+
+		t.Run(fmt.Sprintf("exports %s keys", name), func(t *testing.T) {
+			keystore := newKeystore(t)
+
+			priv, err := keystore.CreateKeyWithType(ctx, "device", ks.KeyTypeEd25519)
+			require.NoError(t, err)
+
+			exported, err := keystore.ExportKey(ctx, "device", []byte("export passphrase"))
+			require.NoError(t, err)
+
+			raw, err := priv.Raw()
+			require.NoError(t, err)
+			require.False(t, bytes.Contains(exported, raw[:32]))
+
+			for target, newTarget := range newKeystores {
+				other := newTarget(t)
+
+				_, err = other.ImportKey(ctx, exported, []byte("wrong"))
+				require.Equal(t, errmsg.ErrKeystorePassphraseInvalid, err, target)
+
+				id, err := other.ImportKey(ctx, exported, []byte("export passphrase"))
+				require.NoError(t, err, target)
+				require.Equal(t, "device", id, target)
+
+				imported, err := other.GetKey(ctx, "device")
+				require.NoError(t, err, target)
+				require.True(t, priv.Equals(imported), target)
+			}
+		})
+
+		t.Run(fmt.Sprintf("rotates %s keys", name), func(t *testing.T) {
+			keystore := newKeystore(t)
+
+			previous, err := keystore.CreateKey(ctx, "key")
+			require.NoError(t, err)
+
+			rotation, err := keystore.RotateKey(ctx, "key", ks.KeyTypeEd25519)
+			require.NoError(t, err)
+			require.NoError(t, rotation.Verify())
+			require.Equal(t, "key", rotation.ID)
+
+			next, err := keystore.GetKey(ctx, "key")
+			require.NoError(t, err)
+			require.False(t, previous.Equals(next))
+
+			previousPub, err := rotation.PreviousPublicKey()
+			require.NoError(t, err)
+			require.True(t, previous.GetPublic().Equals(previousPub))
+
+			nextPub, err := rotation.NewPublicKey()
+			require.NoError(t, err)
+			require.True(t, next.GetPublic().Equals(nextPub))
+
+			// a rotation signed by another key is refused
+			forged := *rotation
+			forged.PreviousKey = rotation.NewKey
+			require.Error(t, forged.Verify())
+		})
+	}
+}
+
+func TestLogKeyRotation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	m := mocknet.New()
+	defer m.Close()
+	ipfs, closeNode := NewMemoryServices(ctx, t, m)
+	defer closeNode()
+
+	keystore, err := ks.NewKeystore(dssync.MutexWrap(NewIdentityDataStore(t)))
+	require.NoError(t, err)
+
+	options := &idp.CreateIdentityOptions{
+		Keystore: keystore,
+		ID:       "userA",
+		Type:     "orbitdb",
+	}
+
+	identity, err := idp.CreateIdentity(ctx, options)
+	require.NoError(t, err)
+
+	log1, err := ipfslog.NewLog(ipfs, identity, &ipfslog.LogOptions{ID: "X"})
+	require.NoError(t, err)
+
+	_, err = log1.Append(ctx, []byte("one"), nil)
+	require.NoError(t, err)
+
+	rotated, rotation, err := idp.RotateIdentity(ctx, identity, options)
+	require.NoError(t, err)
+	require.NoError(t, rotation.Verify())
+	require.Equal(t, identity.ID, rotated.ID)
+	require.NotEqual(t, identity.PublicKey, rotated.PublicKey)
+
+	log1.SetIdentity(rotated)
+
+	_, err = log1.Append(ctx, []byte("two"), nil)
+	require.NoError(t, err)
+
+	entries := log1.Values().Slice()
+	require.Equal(t, identity.PublicKey, entries[0].GetIdentity().PublicKey)
+	require.Equal(t, rotated.PublicKey, entries[1].GetIdentity().PublicKey)
+
+	// entries signed with the retired key are still verified
+	reader, err := idp.CreateIdentity(ctx, &idp.CreateIdentityOptions{
+		Keystore: keystore,
+		ID:       "userB",
+		Type:     "orbitdb",
+	})
+	require.NoError(t, err)
+
+	log2, err := ipfslog.NewLog(ipfs, reader, &ipfslog.LogOptions{ID: "X"})
+	require.NoError(t, err)
+
+	_, err = log2.Join(log1, -1)
+	require.NoError(t, err)
+	require.Equal(t, []string{"one", "two"}, entriesAsStrings(log2.Values()))
+
+	log3, err := ipfslog.NewFromEntryHash(ctx, ipfs, reader, log1.Heads().At(0).GetHash(), &ipfslog.LogOptions{ID: "X"}, &ipfslog.FetchOptions{VerifySignatures: true})
+	require.NoError(t, err)
+	require.Equal(t, 2, log3.Len())
+	// the key is kept when the options describe another identity
+	_, _, err = idp.RotateIdentity(ctx, rotated, &idp.CreateIdentityOptions{
+		Keystore: keystore,
+		ID:       "userB",
+		Type:     "orbitdb",
+	})
+	require.ErrorIs(t, err, errmsg.ErrKeyRotationInvalid)
+
+	e, err := log1.Append(ctx, []byte("three"), nil)
+	require.NoError(t, err)
+	require.NoError(t, e.Verify(rotated.Provider, log1.IO()))
+}
@@ -8,13 +8,16 @@ import (
 
 	"berty.tech/go-ipfs-log/enc"
 	"berty.tech/go-ipfs-log/io/cbor"
+	"berty.tech/go-ipfs-log/io/jsonable"
 
 	ipfslog "berty.tech/go-ipfs-log"
 	"berty.tech/go-ipfs-log/entry"
+	"berty.tech/go-ipfs-log/errmsg"
 	idp "berty.tech/go-ipfs-log/identityprovider"
 	"berty.tech/go-ipfs-log/iface"
 	"berty.tech/go-ipfs-log/keystore"
 	dssync "github.com/ipfs/go-datastore/sync"
+	cbornode "github.com/ipfs/go-ipld-cbor"
 	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
 	"github.com/stretchr/testify/require"
 )
@@ -198,22 +201,14 @@ func TestLogAppendEncrypted(t *testing.T) {
 		h, err := l.Append(ctx, []byte("helloA4"), nil)
 		require.NoError(t, err)
 
-		l2, err := ipfslog.NewFromEntryHash(ctx, ipfs, identity, h.GetHash(),
+		_, err = ipfslog.NewFromEntryHash(ctx, ipfs, identity, h.GetHash(),
 			&ipfslog.LogOptions{
 				ID: "A",
 				IO: cborioDiff,
 			}, &ipfslog.FetchOptions{})
-		require.NoError(t, err)
+		require.ErrorContains(t, err, errmsg.ErrLogHeadsNotLoaded.Error())
 
 		require.Equal(t, 4, l.Values().Len())
-		require.Equal(t, 0, l2.Values().Len())
-
-		var result []string
-		for _, v := range l2.Values().Keys() {
-			result = append(result, string(l2.Values().UnsafeGet(v).GetPayload()))
-		}
-
-		require.Empty(t, result)
 	})
 
 	t.Run("NewFromEntryHash - fails with no key", func(t *testing.T) {
@@ -250,3 +245,141 @@ func TestLogAppendEncrypted(t *testing.T) {
 		require.Equal(t, result, []string{"helloA4"})
 	})
 }
+
+func TestLogAppendEncryptedPayload(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	m := mocknet.New()
+	defer m.Close()
+	ipfs, closeNode := NewMemoryServices(ctx, t, m)
+	defer closeNode()
+
+	datastore := dssync.MutexWrap(NewIdentityDataStore(t))
+	keystore, err := keystore.NewKeystore(datastore)
+	require.NoError(t, err)
+
+	identity, err := idp.CreateIdentity(ctx, &idp.CreateIdentityOptions{
+		Keystore: keystore,
+		ID:       "userA",
+		Type:     "orbitdb",
+	})
+	require.NoError(t, err)
+
+	cborioDefault, err := cbor.IO(&entry.Entry{}, &entry.LamportClock{})
+	require.NoError(t, err)
+
+	newKey := func(last byte) enc.SharedKey {
+		key, err := enc.NewSecretbox([]byte{
+			'0', '1', '2', '3', '4', '5', '6', '7', '8', '9',
+			0, 1, 2, 3, 4, 5, 6, 7, 8, 9,
+			'0', '1', '2', '3', '4', '5', '6', '7', '8', '9',
+			'a', last,
+		})
+		require.NoError(t, err)
+
+		return key
+	}
+
+	cborio := cborioDefault.ApplyOptions(&cbor.Options{PayloadKey: newKey('b')})
+	cborioDiff := cborioDefault.ApplyOptions(&cbor.Options{PayloadKey: newKey('c')})
+	cborioLinks := cborioDefault.ApplyOptions(&cbor.Options{PayloadKey: newKey('b'), LinkKey: newKey('d')})
+
+	appendAll := func(t *testing.T, io iface.IO) (*ipfslog.IPFSLog, iface.IPFSLogEntry) {
+		t.Helper()
+
+		l, err := ipfslog.NewLog(ipfs, identity, &ipfslog.LogOptions{ID: "X", IO: io})
+		require.NoError(t, err)
+
+		var last iface.IPFSLogEntry
+		for _, payload := range []string{"helloA1", "helloA2", "helloA3"} {
+			last, err = l.Append(ctx, []byte(payload), nil)
+			require.NoError(t, err)
+		}
+
+		return l, last
+	}
+
+	load := func(t *testing.T, h iface.IPFSLogEntry, io iface.IO) []string {
+		t.Helper()
+
+		l2, err := ipfslog.NewFromEntryHash(ctx, ipfs, identity, h.GetHash(),
+			&ipfslog.LogOptions{
+				ID: "X",
+				IO: io,
+			}, &ipfslog.FetchOptions{VerifySignatures: true})
+		require.NoError(t, err)
+
+		return entriesAsStrings(l2.Values())
+	}
+
+	t.Run("stores sealed payloads", func(t *testing.T) {
+		l, h := appendAll(t, cborio)
+		require.Equal(t, []string{"helloA1", "helloA2", "helloA3"}, entriesAsStrings(l.Values()))
+
+		node, err := ipfs.Get(ctx, h.GetHash())
+		require.NoError(t, err)
+		require.NotContains(t, string(node.RawData()), "helloA3")
+
+		require.NoError(t, h.Verify(identity.Provider, cborio))
+	})
+
+	t.Run("decrypts and verifies payloads with the same key", func(t *testing.T) {
+		_, h := appendAll(t, cborio)
+		require.Equal(t, []string{"helloA1", "helloA2", "helloA3"}, load(t, h, cborio))
+	})
+
+	t.Run("verifies along with encrypted links", func(t *testing.T) {
+		_, h := appendAll(t, cborioLinks)
+		require.NoError(t, h.Verify(identity.Provider, cborioLinks))
+		require.Equal(t, []string{"helloA1", "helloA2", "helloA3"}, load(t, h, cborioLinks))
+	})
+
+	t.Run("fails with diff keys", func(t *testing.T) {
+		_, h := appendAll(t, cborio)
+
+		_, err := ipfslog.NewFromEntryHash(ctx, ipfs, identity, h.GetHash(), &ipfslog.LogOptions{ID: "X", IO: cborioDiff}, &ipfslog.FetchOptions{VerifySignatures: true})
+		require.ErrorContains(t, err, errmsg.ErrLogHeadsNotLoaded.Error())
+	})
+
+	t.Run("verifies without key", func(t *testing.T) {
+		_, h := appendAll(t, cborio)
+		require.Equal(t, []string{"", "", ""}, load(t, h, cborioDefault))
+	})
+
+	t.Run("fails with tampered payload", func(t *testing.T) {
+		_, h := appendAll(t, cborio)
+
+		tampered := h.Copy()
+		tampered.SetPayload([]byte("helloB3"))
+
+		require.Error(t, tampered.Verify(identity.Provider, cborio))
+
+		// readers without the key can't check the clear payload
+		require.Error(t, tampered.Verify(identity.Provider, cborioDefault))
+		require.NoError(t, h.Copy().Verify(identity.Provider, cborio))
+	})
+
+	t.Run("ignores the clear payload of sealed blocks", func(t *testing.T) {
+		_, h := appendAll(t, cborio)
+
+		node, err := ipfs.Get(ctx, h.GetHash())
+		require.NoError(t, err)
+
+		obj := &jsonable.EntryV2{}
+		require.NoError(t, cbornode.DecodeInto(node.RawData(), obj))
+		require.NotEmpty(t, obj.EncryptedPayload)
+
+		obj.Payload = "forged"
+		forged, err := cbornode.WrapObject(obj, math.MaxUint64, -1)
+		require.NoError(t, err)
+		require.NoError(t, ipfs.Put(ctx, forged))
+
+		for _, io := range []*cbor.IOCbor{cborioDefault, cborio} {
+			e, err := io.DecodeRawEntry(forged, forged.Cid(), identity.Provider)
+			require.NoError(t, err)
+			require.NotEqual(t, "forged", string(e.GetPayload()))
+			require.NoError(t, e.Verify(identity.Provider, io))
+		}
+	})
+}
@@ -0,0 +1,131 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	ipfslog "berty.tech/go-ipfs-log"
+	"berty.tech/go-ipfs-log/errmsg"
+	idp "berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/iface"
+	ks "berty.tech/go-ipfs-log/keystore"
+	"berty.tech/go-ipfs-log/storage"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	carv2 "github.com/ipld/go-car/v2"
+	carstorage "github.com/ipld/go-car/v2/storage"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogCAR(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	m := mocknet.New()
+	defer m.Close()
+	ipfs, closeNode := NewMemoryServices(ctx, t, m)
+	defer closeNode()
+
+	keystore, err := ks.NewKeystore(dssync.MutexWrap(NewIdentityDataStore(t)))
+	require.NoError(t, err)
+
+	identities := make([]*idp.Identity, 4)
+	for i, char := range []rune{'C', 'B', 'D', 'A'} {
+		identity, err := idp.CreateIdentity(ctx, &idp.CreateIdentityOptions{
+			Keystore: keystore,
+			ID:       fmt.Sprintf("user%c", char),
+			Type:     "orbitdb",
+		})
+		require.NoError(t, err)
+
+		identities[i] = identity
+	}
+
+	// the imported logs are loaded in a storage without any network access
+	newOfflineStorage := func() iface.Storage {
+		return storage.NewDatastore(dssync.MutexWrap(datastore.NewMapDatastore()))
+	}
+
+	t.Run("exports and imports a CARv1", func(t *testing.T) {
+		fixture, err := CreateLogWithSixteenEntries(ctx, ipfs, identities)
+		require.NoError(t, err)
+
+		buf := bytes.NewBuffer(nil)
+		require.NoError(t, ipfslog.ExportCAR(ctx, fixture.Log, buf))
+
+		l, err := ipfslog.ImportCAR(ctx, newOfflineStorage(), identities[0], buf, &ipfslog.LogOptions{}, nil)
+		require.NoError(t, err)
+
+		require.Equal(t, fixture.Log.ID, l.ID)
+		require.Equal(t, fixture.ExpectedData, entriesAsStrings(l.Values()))
+		require.Equal(t, fixture.Log.ToJSONLog(), l.ToJSONLog())
+	})
+
+	t.Run("exports and imports a CARv2", func(t *testing.T) {
+		fixture, err := CreateLogWithSixteenEntries(ctx, ipfs, identities)
+		require.NoError(t, err)
+
+		f, err := os.Create(filepath.Join(t.TempDir(), "log.car"))
+		require.NoError(t, err)
+		defer f.Close()
+
+		require.NoError(t, ipfslog.ExportCAR(ctx, fixture.Log, f))
+
+		_, err = f.Seek(0, io.SeekStart)
+		require.NoError(t, err)
+
+		version, err := carv2.ReadVersion(f)
+		require.NoError(t, err)
+		require.Equal(t, uint64(2), version)
+
+		_, err = f.Seek(0, io.SeekStart)
+		require.NoError(t, err)
+
+		l, err := ipfslog.ImportCAR(ctx, newOfflineStorage(), identities[0], f, &ipfslog.LogOptions{}, nil)
+		require.NoError(t, err)
+		require.Equal(t, fixture.ExpectedData, entriesAsStrings(l.Values()))
+	})
+
+	t.Run("fails to import a CAR with a missing entry", func(t *testing.T) {
+		fixture, err := CreateLogWithSixteenEntries(ctx, ipfs, identities)
+		require.NoError(t, err)
+
+		buf := bytes.NewBuffer(nil)
+		require.NoError(t, ipfslog.ExportCAR(ctx, fixture.Log, buf))
+
+		reader, err := carv2.NewBlockReader(buf)
+		require.NoError(t, err)
+
+		// copy every block but the one of an entry referenced by others
+		missing := fixture.Log.Values().At(3).GetHash()
+		truncated := bytes.NewBuffer(nil)
+		car, err := carstorage.NewWritable(truncated, reader.Roots, carv2.WriteAsCarV1(true))
+		require.NoError(t, err)
+
+		for {
+			block, err := reader.Next()
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+
+			if block.Cid().Equals(missing) {
+				continue
+			}
+
+			require.NoError(t, car.Put(ctx, block.Cid().KeyString(), block.RawData()))
+		}
+		require.NoError(t, car.Finalize())
+
+		_, err = ipfslog.ImportCAR(ctx, newOfflineStorage(), identities[0], truncated, &ipfslog.LogOptions{}, nil)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), errmsg.ErrCARMissingBlock.Error())
+		require.Contains(t, err.Error(), missing.String())
+	})
+}
@@ -0,0 +1,62 @@
+//go:build go1.23
+
+package test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	ipfslog "berty.tech/go-ipfs-log"
+	idp "berty.tech/go-ipfs-log/identityprovider"
+	ks "berty.tech/go-ipfs-log/keystore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogAll(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	m := mocknet.New()
+	defer m.Close()
+	ipfs, closeNode := NewMemoryServices(ctx, t, m)
+	defer closeNode()
+
+	keystore, err := ks.NewKeystore(dssync.MutexWrap(NewIdentityDataStore(t)))
+	require.NoError(t, err)
+
+	identity, err := idp.CreateIdentity(ctx, &idp.CreateIdentityOptions{
+		Keystore: keystore,
+		ID:       "userA",
+		Type:     "orbitdb",
+	})
+	require.NoError(t, err)
+
+	l, err := ipfslog.NewLog(ipfs, identity, &ipfslog.LogOptions{ID: "X"})
+	require.NoError(t, err)
+
+	for i := 0; i < 10; i++ {
+		_, err := l.Append(ctx, []byte(fmt.Sprintf("entry%d", i)), nil)
+		require.NoError(t, err)
+	}
+
+	var payloads []string
+	for e, err := range l.All(ctx, &ipfslog.CursorOptions{Reverse: true}) {
+		require.NoError(t, err)
+		payloads = append(payloads, string(e.GetPayload()))
+
+		if len(payloads) == 3 {
+			break
+		}
+	}
+	require.Equal(t, []string{"entry9", "entry8", "entry7"}, payloads)
+
+	cctx, ccancel := context.WithCancel(ctx)
+	ccancel()
+
+	for _, err := range l.All(cctx, nil) {
+		require.ErrorIs(t, err, context.Canceled)
+	}
+}
@@ -0,0 +1,202 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	ipfslog "berty.tech/go-ipfs-log"
+	"berty.tech/go-ipfs-log/entry/sorting"
+	"berty.tech/go-ipfs-log/errmsg"
+	idp "berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/iface"
+	ks "berty.tech/go-ipfs-log/keystore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func cursorPayloads(t *testing.T, ctx context.Context, c *ipfslog.Cursor, amount int) []string {
+	t.Helper()
+
+	var payloads []string
+	for (amount < 0 || len(payloads) < amount) && c.Next(ctx) {
+		payloads = append(payloads, string(c.Entry().GetPayload()))
+	}
+	require.NoError(t, c.Err())
+
+	return payloads
+}
+
+func TestLogCursor(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	m := mocknet.New()
+	defer m.Close()
+	ipfs, closeNode := NewMemoryServices(ctx, t, m)
+	defer closeNode()
+
+	keystore, err := ks.NewKeystore(dssync.MutexWrap(NewIdentityDataStore(t)))
+	require.NoError(t, err)
+
+	identity, err := idp.CreateIdentity(ctx, &idp.CreateIdentityOptions{
+		Keystore: keystore,
+		ID:       "userA",
+		Type:     "orbitdb",
+	})
+	require.NoError(t, err)
+
+	l, err := ipfslog.NewLog(ipfs, identity, &ipfslog.LogOptions{ID: "X"})
+	require.NoError(t, err)
+
+	var expected []string
+	for i := 0; i < 100; i++ {
+		payload := fmt.Sprintf("entry%d", i)
+		_, err := l.Append(ctx, []byte(payload), nil)
+		require.NoError(t, err)
+
+		expected = append(expected, payload)
+	}
+
+	reversed := make([]string, len(expected))
+	for i := range expected {
+		reversed[len(expected)-1-i] = expected[i]
+	}
+
+	t.Run("iterates forward", func(t *testing.T) {
+		c, err := l.NewCursor(nil)
+		require.NoError(t, err)
+		require.Equal(t, expected, cursorPayloads(t, ctx, c, -1))
+		require.Nil(t, c.Entry())
+		require.False(t, c.Next(ctx))
+	})
+
+	t.Run("iterates in reverse", func(t *testing.T) {
+		c, err := l.NewCursor(&ipfslog.CursorOptions{Reverse: true})
+		require.NoError(t, err)
+		require.Equal(t, reversed, cursorPayloads(t, ctx, c, -1))
+	})
+
+	t.Run("pages using resume tokens", func(t *testing.T) {
+		for _, reverse := range []bool{false, true} {
+			var pages []string
+			token := ""
+
+			for {
+				c, err := l.NewCursor(&ipfslog.CursorOptions{Reverse: reverse, Token: token})
+				require.NoError(t, err)
+
+				page := cursorPayloads(t, ctx, c, 30)
+				if len(page) == 0 {
+					break
+				}
+
+				pages = append(pages, page...)
+				token = c.Token()
+				require.NotEmpty(t, token)
+			}
+
+			if reverse {
+				require.Equal(t, reversed, pages)
+			} else {
+				require.Equal(t, expected, pages)
+			}
+		}
+	})
+
+	t.Run("resumes after entries were appended", func(t *testing.T) {
+		l2, err := ipfslog.NewLog(ipfs, identity, &ipfslog.LogOptions{ID: "Y"})
+		require.NoError(t, err)
+
+		for i := 0; i < 5; i++ {
+			_, err := l2.Append(ctx, []byte(fmt.Sprintf("entry%d", i)), nil)
+			require.NoError(t, err)
+		}
+
+		c, err := l2.NewCursor(nil)
+		require.NoError(t, err)
+		require.Equal(t, []string{"entry0", "entry1", "entry2", "entry3", "entry4"}, cursorPayloads(t, ctx, c, -1))
+
+		// the cursor is exhausted, keep the token of the last entry
+		c, err = l2.NewCursor(&ipfslog.CursorOptions{Reverse: true})
+		require.NoError(t, err)
+		require.True(t, c.Next(ctx))
+		token := c.Token()
+
+		_, err = l2.Append(ctx, []byte("entry5"), nil)
+		require.NoError(t, err)
+
+		c, err = l2.NewCursor(&ipfslog.CursorOptions{Token: token})
+		require.NoError(t, err)
+		require.Equal(t, []string{"entry5"}, cursorPayloads(t, ctx, c, -1))
+	})
+
+	t.Run("resumes after an entry which is not in the log anymore", func(t *testing.T) {
+		c, err := l.NewCursor(nil)
+		require.NoError(t, err)
+		require.Equal(t, expected[:10], cursorPayloads(t, ctx, c, 10))
+		token := c.Token()
+
+		size := 50
+		trimmed, err := ipfslog.NewLog(ipfs, identity, &ipfslog.LogOptions{ID: "X"})
+		require.NoError(t, err)
+
+		_, err = trimmed.JoinWithOptions(ctx, l, &ipfslog.JoinOptions{Size: &size})
+		require.NoError(t, err)
+
+		c, err = trimmed.NewCursor(&ipfslog.CursorOptions{Token: token})
+		require.NoError(t, err)
+		require.Equal(t, expected[50:], cursorPayloads(t, ctx, c, -1))
+
+		c, err = trimmed.NewCursor(&ipfslog.CursorOptions{Token: token, Reverse: true})
+		require.NoError(t, err)
+		require.Empty(t, cursorPayloads(t, ctx, c, -1))
+
+		// the position can't be found without the default sort function
+		sorted, err := ipfslog.NewLog(ipfs, identity, &ipfslog.LogOptions{ID: "X", SortFn: sorting.FirstWriteWins})
+		require.NoError(t, err)
+
+		_, err = sorted.JoinWithOptions(ctx, l, &ipfslog.JoinOptions{Size: &size})
+		require.NoError(t, err)
+
+		_, err = sorted.NewCursor(&ipfslog.CursorOptions{Token: token})
+		require.ErrorContains(t, err, errmsg.ErrCursorTokenNotFound.Error())
+	})
+
+	t.Run("stops when the context is done", func(t *testing.T) {
+		c, err := l.NewCursor(nil)
+		require.NoError(t, err)
+
+		cctx, ccancel := context.WithCancel(ctx)
+		require.True(t, c.Next(cctx))
+		ccancel()
+
+		require.False(t, c.Next(cctx))
+		require.ErrorIs(t, c.Err(), context.Canceled)
+	})
+
+	t.Run("rejects invalid tokens", func(t *testing.T) {
+		_, err := l.NewCursor(&ipfslog.CursorOptions{Token: "not a token"})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), errmsg.ErrCursorTokenInvalid.Error())
+	})
+
+	t.Run("iterates over an empty log", func(t *testing.T) {
+		empty, err := ipfslog.NewLog(ipfs, identity, &ipfslog.LogOptions{ID: "Z"})
+		require.NoError(t, err)
+
+		c, err := empty.NewCursor(nil)
+		require.NoError(t, err)
+		require.False(t, c.Next(ctx))
+		require.Equal(t, "", c.Token())
+
+		var entries []iface.IPFSLogEntry
+		c, err = empty.NewCursor(&ipfslog.CursorOptions{Reverse: true})
+		require.NoError(t, err)
+		for c.Next(ctx) {
+			entries = append(entries, c.Entry())
+		}
+		require.Empty(t, entries)
+	})
+}
@@ -0,0 +1,167 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	ipfslog "berty.tech/go-ipfs-log"
+	idp "berty.tech/go-ipfs-log/identityprovider"
+	ks "berty.tech/go-ipfs-log/keystore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func nextEvent(t *testing.T, sub *ipfslog.Subscription) ipfslog.Event {
+	t.Helper()
+
+	select {
+	case evt, ok := <-sub.Out():
+		require.True(t, ok)
+		return evt
+	case <-time.After(time.Second * 5):
+		t.Fatal("timed out waiting for an event")
+		return nil
+	}
+}
+
+func TestLogEvents(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	m := mocknet.New()
+	defer m.Close()
+	ipfs, closeNode := NewMemoryServices(ctx, t, m)
+	defer closeNode()
+
+	keystore, err := ks.NewKeystore(dssync.MutexWrap(NewIdentityDataStore(t)))
+	require.NoError(t, err)
+
+	var identities [2]*idp.Identity
+	for i, char := range []rune{'A', 'B'} {
+		identity, err := idp.CreateIdentity(ctx, &idp.CreateIdentityOptions{
+			Keystore: keystore,
+			ID:       fmt.Sprintf("user%c", char),
+			Type:     "orbitdb",
+		})
+		require.NoError(t, err)
+
+		identities[i] = identity
+	}
+
+	t.Run("emits append events", func(t *testing.T) {
+		l, err := ipfslog.NewLog(ipfs, identities[0], &ipfslog.LogOptions{ID: "A"})
+		require.NoError(t, err)
+
+		sub := l.Subscribe(ctx, nil)
+
+		e, err := l.Append(ctx, []byte("one"), nil)
+		require.NoError(t, err)
+
+		appended, ok := nextEvent(t, sub).(ipfslog.EventAppended)
+		require.True(t, ok)
+		require.Equal(t, e.GetHash(), appended.Entry.GetHash())
+
+		heads, ok := nextEvent(t, sub).(ipfslog.EventHeadsReplaced)
+		require.True(t, ok)
+		require.Len(t, heads.Heads, 1)
+		require.Equal(t, e.GetHash(), heads.Heads[0].GetHash())
+	})
+
+	t.Run("emits join events", func(t *testing.T) {
+		l1, err := ipfslog.NewLog(ipfs, identities[0], &ipfslog.LogOptions{ID: "A"})
+		require.NoError(t, err)
+
+		l2, err := ipfslog.NewLog(ipfs, identities[1], &ipfslog.LogOptions{ID: "A"})
+		require.NoError(t, err)
+
+		_, err = l1.Append(ctx, []byte("one"), nil)
+		require.NoError(t, err)
+
+		for i := 0; i < 3; i++ {
+			_, err = l2.Append(ctx, []byte(fmt.Sprintf("two%d", i)), nil)
+			require.NoError(t, err)
+		}
+
+		sub := l1.Subscribe(ctx, nil)
+
+		_, err = l1.Join(l2, -1)
+		require.NoError(t, err)
+
+		joined, ok := nextEvent(t, sub).(ipfslog.EventJoined)
+		require.True(t, ok)
+		require.Len(t, joined.Entries, 3)
+
+		heads, ok := nextEvent(t, sub).(ipfslog.EventHeadsReplaced)
+		require.True(t, ok)
+		require.Len(t, heads.Heads, 2)
+
+		// joining again does not add anything
+		_, err = l1.Join(l2, -1)
+		require.NoError(t, err)
+
+		select {
+		case evt := <-sub.Out():
+			t.Fatalf("unexpected event %T", evt)
+		default:
+		}
+	})
+
+	t.Run("emits join rejected events", func(t *testing.T) {
+		l1, err := ipfslog.NewLog(ipfs, identities[0], &ipfslog.LogOptions{ID: "A", AccessController: &TestACL{refIdentity: identities[1]}})
+		require.NoError(t, err)
+
+		l2, err := ipfslog.NewLog(ipfs, identities[1], &ipfslog.LogOptions{ID: "A"})
+		require.NoError(t, err)
+
+		e, err := l2.Append(ctx, []byte("two"), nil)
+		require.NoError(t, err)
+
+		sub := l1.Subscribe(ctx, nil)
+
+		_, err = l1.Join(l2, -1)
+		require.Error(t, err)
+
+		rejected, ok := nextEvent(t, sub).(ipfslog.EventJoinRejected)
+		require.True(t, ok)
+		require.Equal(t, e.GetHash(), rejected.Entry.GetHash())
+		require.Error(t, rejected.Err)
+	})
+
+	t.Run("does not block on a lagging subscriber", func(t *testing.T) {
+		l, err := ipfslog.NewLog(ipfs, identities[0], &ipfslog.LogOptions{ID: "A"})
+		require.NoError(t, err)
+
+		sub := l.Subscribe(ctx, &ipfslog.SubscribeOptions{BufferSize: 1})
+
+		for i := 0; i < 5; i++ {
+			_, err := l.Append(ctx, []byte(fmt.Sprintf("entry%d", i)), nil)
+			require.NoError(t, err)
+		}
+
+		require.Equal(t, uint64(9), sub.Dropped())
+		_, ok := nextEvent(t, sub).(ipfslog.EventAppended)
+		require.True(t, ok)
+	})
+
+	t.Run("closes the subscription when the context is done", func(t *testing.T) {
+		l, err := ipfslog.NewLog(ipfs, identities[0], &ipfslog.LogOptions{ID: "A"})
+		require.NoError(t, err)
+
+		subCtx, subCancel := context.WithCancel(ctx)
+		sub := l.Subscribe(subCtx, nil)
+		subCancel()
+
+		select {
+		case _, ok := <-sub.Out():
+			require.False(t, ok)
+		case <-time.After(time.Second * 5):
+			t.Fatal("subscription not closed")
+		}
+
+		_, err = l.Append(ctx, []byte("one"), nil)
+		require.NoError(t, err)
+	})
+}
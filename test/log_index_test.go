@@ -0,0 +1,201 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	ipfslog "berty.tech/go-ipfs-log"
+	"berty.tech/go-ipfs-log/entry/dsindex"
+	idp "berty.tech/go-ipfs-log/identityprovider"
+	ks "berty.tech/go-ipfs-log/keystore"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogIndex(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	m := mocknet.New()
+	defer m.Close()
+	ipfs, closeNode := NewMemoryServices(ctx, t, m)
+	defer closeNode()
+
+	keystore, err := ks.NewKeystore(dssync.MutexWrap(NewIdentityDataStore(t)))
+	require.NoError(t, err)
+
+	var identities [2]*idp.Identity
+	for i, char := range []rune{'A', 'B'} {
+		identity, err := idp.CreateIdentity(ctx, &idp.CreateIdentityOptions{
+			Keystore: keystore,
+			ID:       fmt.Sprintf("user%c", char),
+			Type:     "orbitdb",
+		})
+		require.NoError(t, err)
+
+		identities[i] = identity
+	}
+
+	t.Run("reopens a log from its index", func(t *testing.T) {
+		ds := dssync.MutexWrap(datastore.NewMapDatastore())
+
+		index, err := dsindex.Open(ctx, ds, nil)
+		require.NoError(t, err)
+
+		logA, err := ipfslog.NewLog(ipfs, identities[0], &ipfslog.LogOptions{ID: "X", Index: index})
+		require.NoError(t, err)
+
+		logB, err := ipfslog.NewLog(ipfs, identities[1], &ipfslog.LogOptions{ID: "X"})
+		require.NoError(t, err)
+
+		for i := 0; i < 10; i++ {
+			_, err := logA.Append(ctx, []byte(fmt.Sprintf("entryA%d", i)), nil)
+			require.NoError(t, err)
+
+			_, err = logB.Append(ctx, []byte(fmt.Sprintf("entryB%d", i)), nil)
+			require.NoError(t, err)
+		}
+
+		_, err = logA.Join(logB, -1)
+		require.NoError(t, err)
+
+		_, err = logA.Append(ctx, []byte("last"), nil)
+		require.NoError(t, err)
+		require.NoError(t, index.Err())
+
+		reopened, err := dsindex.Open(ctx, ds, nil)
+		require.NoError(t, err)
+
+		logC, err := ipfslog.NewLog(ipfs, identities[0], &ipfslog.LogOptions{ID: "X", Index: reopened})
+		require.NoError(t, err)
+
+		require.Equal(t, 21, logC.Len())
+		require.Equal(t, logA.Entries.Keys(), logC.Entries.Keys())
+		require.Equal(t, entriesAsStrings(logA.Values()), entriesAsStrings(logC.Values()))
+		require.Equal(t, logA.ToJSONLog(), logC.ToJSONLog())
+		require.Equal(t, logA.Clock.GetTime(), logC.Clock.GetTime())
+
+		for _, k := range logA.Next.Keys() {
+			next, ok := logC.Next.Get(k)
+			require.True(t, ok)
+			require.Equal(t, logA.Next.UnsafeGet(k).GetHash(), next.GetHash())
+		}
+
+		e := logC.Entries.At(3)
+		require.NotNil(t, e)
+		require.Equal(t, logA.Entries.At(3).GetHash(), e.GetHash())
+		require.Nil(t, logC.Entries.At(21))
+
+		// entries read back from the index are still valid
+		require.NoError(t, e.Verify(identities[0].Provider, logC.IO()))
+
+		// the reopened log keeps being persisted
+		_, err = logC.Append(ctx, []byte("after reopen"), nil)
+		require.NoError(t, err)
+
+		reopened, err = dsindex.Open(ctx, ds, nil)
+		require.NoError(t, err)
+
+		logD, err := ipfslog.NewLog(ipfs, identities[0], &ipfslog.LogOptions{ID: "X", Index: reopened})
+		require.NoError(t, err)
+		require.Equal(t, 22, logD.Len())
+		require.Equal(t, "after reopen", string(logD.Heads().At(0).GetPayload()))
+	})
+
+	t.Run("opens an empty index", func(t *testing.T) {
+		index, err := dsindex.Open(ctx, dssync.MutexWrap(datastore.NewMapDatastore()), nil)
+		require.NoError(t, err)
+
+		l, err := ipfslog.NewLog(ipfs, identities[0], &ipfslog.LogOptions{ID: "X", Index: index})
+		require.NoError(t, err)
+		require.Equal(t, 0, l.Len())
+		require.Equal(t, 0, l.Heads().Len())
+	})
+	t.Run("reverses the entries in place", func(t *testing.T) {
+		ds := dssync.MutexWrap(datastore.NewMapDatastore())
+
+		index, err := dsindex.Open(ctx, ds, nil)
+		require.NoError(t, err)
+
+		l, err := ipfslog.NewLog(ipfs, identities[0], &ipfslog.LogOptions{ID: "X", Index: index})
+		require.NoError(t, err)
+
+		for i := 0; i < 3; i++ {
+			_, err := l.Append(ctx, []byte(fmt.Sprintf("entry%d", i)), nil)
+			require.NoError(t, err)
+		}
+
+		entries := index.Entries()
+		keys := append([]string(nil), entries.Keys()...)
+
+		reversed := entries.Reverse()
+		require.Same(t, entries, reversed)
+		require.NoError(t, index.Err())
+
+		expected := []string{keys[2], keys[1], keys[0]}
+		require.Equal(t, expected, entries.Keys())
+		require.Equal(t, keys[2], entries.At(0).GetHash().String())
+
+		// the order is persisted
+		reopened, err := dsindex.Open(ctx, ds, nil)
+		require.NoError(t, err)
+		require.Equal(t, expected, reopened.Entries().Keys())
+	})
+
+	t.Run("does not keep entries which failed to be persisted", func(t *testing.T) {
+		ds := &failingCommitDatastore{Batching: dssync.MutexWrap(datastore.NewMapDatastore())}
+
+		index, err := dsindex.Open(ctx, ds, nil)
+		require.NoError(t, err)
+
+		l, err := ipfslog.NewLog(ipfs, identities[0], &ipfslog.LogOptions{ID: "X"})
+		require.NoError(t, err)
+
+		e, err := l.Append(ctx, []byte("entry"), nil)
+		require.NoError(t, err)
+
+		ds.fail = true
+		index.Entries().Set(e.GetHash().String(), e)
+		require.Error(t, index.Err())
+
+		ds.fail = false
+		index.Entries().Set(e.GetHash().String(), e)
+
+		reopened, err := dsindex.Open(ctx, ds, nil)
+		require.NoError(t, err)
+
+		persisted, ok := reopened.Entries().Get(e.GetHash().String())
+		require.True(t, ok)
+		require.Equal(t, e.GetHash(), persisted.GetHash())
+	})
+}
+
+type failingCommitDatastore struct {
+	datastore.Batching
+	fail bool
+}
+
+func (d *failingCommitDatastore) Batch(ctx context.Context) (datastore.Batch, error) {
+	batch, err := d.Batching.Batch(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &failingCommitBatch{Batch: batch, datastore: d}, nil
+}
+
+type failingCommitBatch struct {
+	datastore.Batch
+	datastore *failingCommitDatastore
+}
+
+func (b *failingCommitBatch) Commit(ctx context.Context) error {
+	if b.datastore.fail {
+		return fmt.Errorf("commit failed")
+	}
+
+	return b.Batch.Commit(ctx)
+}
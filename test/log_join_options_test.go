@@ -0,0 +1,261 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	ipfslog "berty.tech/go-ipfs-log"
+	"berty.tech/go-ipfs-log/accesscontroller"
+	"berty.tech/go-ipfs-log/entry"
+	"berty.tech/go-ipfs-log/entry/dsindex"
+	"berty.tech/go-ipfs-log/errmsg"
+	idp "berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/iface"
+	ks "berty.tech/go-ipfs-log/keystore"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogJoinWithOptions(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	m := mocknet.New()
+	defer m.Close()
+	ipfs, closeNode := NewMemoryServices(ctx, t, m)
+	defer closeNode()
+
+	keystore, err := ks.NewKeystore(dssync.MutexWrap(NewIdentityDataStore(t)))
+	require.NoError(t, err)
+
+	var identities [3]*idp.Identity
+	for i, char := range []rune{'A', 'B', 'C'} {
+		identity, err := idp.CreateIdentity(ctx, &idp.CreateIdentityOptions{
+			Keystore: keystore,
+			ID:       fmt.Sprintf("user%c", char),
+			Type:     "orbitdb",
+		})
+		require.NoError(t, err)
+
+		identities[i] = identity
+	}
+
+	// createMixedLog creates a log C1 <- C2 <- B1 <- C3 written by userC and userB
+	createMixedLog := func(t *testing.T) (*ipfslog.IPFSLog, []iface.IPFSLogEntry) {
+		t.Helper()
+
+		logC, err := ipfslog.NewLog(ipfs, identities[2], &ipfslog.LogOptions{ID: "X"})
+		require.NoError(t, err)
+
+		logB, err := ipfslog.NewLog(ipfs, identities[1], &ipfslog.LogOptions{ID: "X"})
+		require.NoError(t, err)
+
+		c1, err := logC.Append(ctx, []byte("C1"), nil)
+		require.NoError(t, err)
+
+		c2, err := logC.Append(ctx, []byte("C2"), nil)
+		require.NoError(t, err)
+
+		_, err = logB.Join(logC, -1)
+		require.NoError(t, err)
+
+		b1, err := logB.Append(ctx, []byte("B1"), nil)
+		require.NoError(t, err)
+
+		_, err = logC.Join(logB, -1)
+		require.NoError(t, err)
+
+		c3, err := logC.Append(ctx, []byte("C3"), nil)
+		require.NoError(t, err)
+
+		return logC, []iface.IPFSLogEntry{c1, c2, b1, c3}
+	}
+
+	t.Run("joins all the entries", func(t *testing.T) {
+		other, _ := createMixedLog(t)
+
+		l, err := ipfslog.NewLog(ipfs, identities[0], &ipfslog.LogOptions{ID: "X", Concurrency: 2})
+		require.NoError(t, err)
+
+		result, err := l.JoinWithOptions(ctx, other, nil)
+		require.NoError(t, err)
+		require.Len(t, result.Accepted, 4)
+		require.Empty(t, result.Rejected)
+		require.Equal(t, []string{"C1", "C2", "B1", "C3"}, entriesAsStrings(l.Values()))
+	})
+
+	t.Run("rejects everything with the all-or-nothing policy", func(t *testing.T) {
+		other, _ := createMixedLog(t)
+
+		l, err := ipfslog.NewLog(ipfs, identities[0], &ipfslog.LogOptions{ID: "X", AccessController: &TestACL{refIdentity: identities[1]}})
+		require.NoError(t, err)
+
+		_, err = l.Append(ctx, []byte("A1"), nil)
+		require.NoError(t, err)
+
+		result, err := l.JoinWithOptions(ctx, other, &ipfslog.JoinOptions{Policy: ipfslog.JoinAllOrNothing})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), errmsg.ErrLogJoinFailed.Error())
+
+		require.Empty(t, result.Accepted)
+		require.Len(t, result.Rejected, 1)
+		require.Equal(t, "B1", string(result.Rejected[0].Entry.GetPayload()))
+		require.Equal(t, ipfslog.JoinRejectedAccess, result.Rejected[0].Reason)
+
+		require.Equal(t, []string{"A1"}, entriesAsStrings(l.Values()))
+	})
+
+	t.Run("accepts the valid causal subset", func(t *testing.T) {
+		other, entries := createMixedLog(t)
+
+		l, err := ipfslog.NewLog(ipfs, identities[0], &ipfslog.LogOptions{ID: "X", AccessController: &TestACL{refIdentity: identities[1]}})
+		require.NoError(t, err)
+
+		a1, err := l.Append(ctx, []byte("A1"), nil)
+		require.NoError(t, err)
+
+		result, err := l.JoinWithOptions(ctx, other, &ipfslog.JoinOptions{Policy: ipfslog.JoinCausalSubset})
+		require.NoError(t, err)
+
+		require.ElementsMatch(t, []string{"C1", "C2"}, payloads(result.Accepted))
+		require.Len(t, result.Rejected, 2)
+		require.Equal(t, "B1", string(result.Rejected[0].Entry.GetPayload()))
+		require.Equal(t, ipfslog.JoinRejectedAccess, result.Rejected[0].Reason)
+		require.Equal(t, "C3", string(result.Rejected[1].Entry.GetPayload()))
+		require.Equal(t, ipfslog.JoinRejectedAncestor, result.Rejected[1].Reason)
+
+		require.Equal(t, 3, l.Len())
+		require.ElementsMatch(t, []string{a1.GetHash().String(), entries[1].GetHash().String()}, l.Heads().Keys())
+
+		// the log keeps working after a partial join
+		e, err := l.Append(ctx, []byte("A2"), nil)
+		require.NoError(t, err)
+		require.Len(t, e.GetNext(), 2)
+	})
+
+	t.Run("rejects entries from another log", func(t *testing.T) {
+		logY, err := ipfslog.NewLog(ipfs, identities[2], &ipfslog.LogOptions{ID: "Y"})
+		require.NoError(t, err)
+
+		_, err = logY.Append(ctx, []byte("Y1"), nil)
+		require.NoError(t, err)
+
+		other, err := ipfslog.NewLog(ipfs, identities[2], &ipfslog.LogOptions{ID: "X", Entries: logY.Entries})
+		require.NoError(t, err)
+
+		l, err := ipfslog.NewLog(ipfs, identities[0], &ipfslog.LogOptions{ID: "X"})
+		require.NoError(t, err)
+
+		result, err := l.JoinWithOptions(ctx, other, &ipfslog.JoinOptions{Policy: ipfslog.JoinCausalSubset})
+		require.NoError(t, err)
+		require.Empty(t, result.Accepted)
+		require.Len(t, result.Rejected, 1)
+		require.Equal(t, ipfslog.JoinRejectedLogID, result.Rejected[0].Reason)
+		require.Equal(t, 0, l.Len())
+	})
+
+	t.Run("fails to join a log with another ID", func(t *testing.T) {
+		other, err := ipfslog.NewLog(ipfs, identities[2], &ipfslog.LogOptions{ID: "Y"})
+		require.NoError(t, err)
+
+		_, err = other.Append(ctx, []byte("Y1"), nil)
+		require.NoError(t, err)
+
+		l, err := ipfslog.NewLog(ipfs, identities[0], &ipfslog.LogOptions{ID: "X"})
+		require.NoError(t, err)
+
+		_, err = l.JoinWithOptions(ctx, other, nil)
+		require.ErrorIs(t, err, errmsg.ErrLogJoinIDMismatch)
+		require.Equal(t, 0, l.Len())
+	})
+
+	t.Run("limits the size of the joined log", func(t *testing.T) {
+		other, _ := createMixedLog(t)
+
+		l, err := ipfslog.NewLog(ipfs, identities[0], &ipfslog.LogOptions{ID: "X"})
+		require.NoError(t, err)
+
+		size := 2
+		_, err = l.JoinWithOptions(ctx, other, &ipfslog.JoinOptions{Size: &size})
+		require.NoError(t, err)
+		require.Equal(t, []string{"B1", "C3"}, entriesAsStrings(l.Values()))
+
+		l, err = ipfslog.NewLog(ipfs, identities[0], &ipfslog.LogOptions{ID: "X"})
+		require.NoError(t, err)
+
+		size = 10
+		_, err = l.JoinWithOptions(ctx, other, &ipfslog.JoinOptions{Size: &size})
+		require.NoError(t, err)
+		require.Equal(t, []string{"C1", "C2", "B1", "C3"}, entriesAsStrings(l.Values()))
+	})
+
+	t.Run("refuses to limit the size of an indexed log", func(t *testing.T) {
+		other, _ := createMixedLog(t)
+
+		index, err := dsindex.Open(ctx, dssync.MutexWrap(datastore.NewMapDatastore()), nil)
+		require.NoError(t, err)
+
+		l, err := ipfslog.NewLog(ipfs, identities[0], &ipfslog.LogOptions{ID: "X", Index: index})
+		require.NoError(t, err)
+
+		size := 2
+		_, err = l.JoinWithOptions(ctx, other, &ipfslog.JoinOptions{Size: &size})
+		require.ErrorContains(t, err, errmsg.ErrJoinSizeWithIndex.Error())
+		require.Equal(t, 0, l.Len())
+	})
+
+	t.Run("only shows verified entries to the access controller", func(t *testing.T) {
+		logC, entries := createMixedLog(t)
+
+		// forged reuses the signature of C3 for another payload
+		forged := entries[3].Copy()
+		forged.SetPayload([]byte("forged"))
+
+		c, err := entry.ToMultihashWithIO(ctx, forged, ipfs, nil, logC.IO())
+		require.NoError(t, err)
+		forged.SetHash(c)
+
+		other, err := ipfslog.NewLog(ipfs, identities[2], &ipfslog.LogOptions{
+			ID:      "X",
+			Entries: entry.NewOrderedMapFromEntries(append(entries[:3:3], forged)),
+			Heads:   []iface.IPFSLogEntry{forged},
+		})
+		require.NoError(t, err)
+
+		var seen []string
+		ac := funcACL(func(ctx context.Context, e accesscontroller.LogEntry, view accesscontroller.LogView) error {
+			seen = append(seen, string(e.GetPayload()))
+			for _, v := range view.GetLogEntries() {
+				require.NotEqual(t, "forged", string(v.GetPayload()))
+			}
+
+			return nil
+		})
+
+		l, err := ipfslog.NewLog(ipfs, identities[0], &ipfslog.LogOptions{ID: "X", AccessControllerV2: ac, Concurrency: 1})
+		require.NoError(t, err)
+
+		result, err := l.JoinWithOptions(ctx, other, &ipfslog.JoinOptions{Policy: ipfslog.JoinCausalSubset})
+		require.NoError(t, err)
+		require.Len(t, result.Rejected, 1)
+		require.Equal(t, ipfslog.JoinRejectedSignature, result.Rejected[0].Reason)
+		require.ElementsMatch(t, []string{"C1", "C2", "B1"}, seen)
+	})
+
+	t.Run("stops when the context is done", func(t *testing.T) {
+		other, _ := createMixedLog(t)
+
+		l, err := ipfslog.NewLog(ipfs, identities[0], &ipfslog.LogOptions{ID: "X"})
+		require.NoError(t, err)
+
+		cctx, ccancel := context.WithCancel(ctx)
+		ccancel()
+
+		_, err = l.JoinWithOptions(cctx, other, nil)
+		require.ErrorIs(t, err, context.Canceled)
+		require.Equal(t, 0, l.Len())
+	})
+}
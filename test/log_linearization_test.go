@@ -0,0 +1,85 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	ipfslog "berty.tech/go-ipfs-log"
+	"berty.tech/go-ipfs-log/entry/sorting"
+	idp "berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/iface"
+	ks "berty.tech/go-ipfs-log/keystore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogLinearization(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	m := mocknet.New()
+	defer m.Close()
+	ipfs, closeNode := NewMemoryServices(ctx, t, m)
+	defer closeNode()
+
+	keystore, err := ks.NewKeystore(dssync.MutexWrap(NewIdentityDataStore(t)))
+	require.NoError(t, err)
+
+	var identities [3]*idp.Identity
+	for i, char := range []rune{'A', 'B', 'C'} {
+		identity, err := idp.CreateIdentity(ctx, &idp.CreateIdentityOptions{
+			Keystore: keystore,
+			ID:       fmt.Sprintf("user%c", char),
+			Type:     "orbitdb",
+		})
+		require.NoError(t, err)
+
+		identities[i] = identity
+	}
+
+	sortFns := map[string]iface.EntrySortFn{
+		"default":            nil,
+		"first write wins":   sorting.FirstWriteWins,
+		"sort by entry hash": sorting.SortByEntryHash,
+	}
+
+	for name, sortFn := range sortFns {
+		t.Run(fmt.Sprintf("keeps the order of a full traversal with %s", name), func(t *testing.T) {
+			r := rand.New(rand.NewSource(42))
+
+			var logs [3]*ipfslog.IPFSLog
+			for i := range logs {
+				logs[i], err = ipfslog.NewLog(ipfs, identities[i], &ipfslog.LogOptions{ID: "X", SortFn: sortFn})
+				require.NoError(t, err)
+			}
+
+			for i := 0; i < 60; i++ {
+				a := logs[r.Intn(len(logs))]
+
+				if r.Intn(3) == 0 {
+					b := logs[r.Intn(len(logs))]
+					_, err := a.Join(b, -1)
+					require.NoError(t, err)
+				} else {
+					_, err := a.Append(ctx, []byte(fmt.Sprintf("entry%d", i)), nil)
+					require.NoError(t, err)
+				}
+
+				// a log created from the same entries traverses them from its heads
+				fresh, err := ipfslog.NewLog(ipfs, a.Identity, &ipfslog.LogOptions{
+					ID:      "X",
+					Entries: a.Entries,
+					Heads:   a.Heads().Slice(),
+					SortFn:  sortFn,
+				})
+				require.NoError(t, err)
+
+				require.Equal(t, fresh.Values().Keys(), a.Values().Keys())
+				require.Equal(t, fresh.ToString(nil), a.ToString(nil))
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	ipfslog "berty.tech/go-ipfs-log"
+	"berty.tech/go-ipfs-log/entry"
+	idp "berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/iface"
+	ks "berty.tech/go-ipfs-log/keystore"
+	cid "github.com/ipfs/go-cid"
+	dssync "github.com/ipfs/go-datastore/sync"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogPartialLoad(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	m := mocknet.New()
+	defer m.Close()
+	ipfs, closeNode := NewMemoryServices(ctx, t, m)
+	defer closeNode()
+
+	keystore, err := ks.NewKeystore(dssync.MutexWrap(NewIdentityDataStore(t)))
+	require.NoError(t, err)
+
+	var identities [2]*idp.Identity
+	for i, char := range []rune{'A', 'B'} {
+		identity, err := idp.CreateIdentity(ctx, &idp.CreateIdentityOptions{
+			Keystore: keystore,
+			ID:       fmt.Sprintf("user%c", char),
+			Type:     "orbitdb",
+		})
+		require.NoError(t, err)
+
+		identities[i] = identity
+	}
+
+	t.Run("loads the entries newer than a clock time", func(t *testing.T) {
+		log1, err := ipfslog.NewLog(ipfs, identities[0], &ipfslog.LogOptions{ID: "X"})
+		require.NoError(t, err)
+
+		for i := 1; i <= 20; i++ {
+			_, err := log1.Append(ctx, []byte(fmt.Sprintf("entry%d", i)), &ipfslog.AppendOptions{PointerCount: 16})
+			require.NoError(t, err)
+		}
+
+		hash, err := log1.ToMultihash(ctx)
+		require.NoError(t, err)
+
+		res, err := ipfslog.NewFromMultihash(ctx, ipfs, identities[0], hash, &ipfslog.LogOptions{}, &ipfslog.FetchOptions{SinceClockTime: 15})
+		require.NoError(t, err)
+		require.Equal(t, []string{"entry16", "entry17", "entry18", "entry19", "entry20"}, entriesAsStrings(res.Values()))
+		require.Equal(t, log1.Heads().Keys(), res.Heads().Keys())
+
+		res, err = ipfslog.NewFromEntryHash(ctx, ipfs, identities[0], log1.Heads().At(0).GetHash(), &ipfslog.LogOptions{ID: "X"}, &ipfslog.FetchOptions{SinceClockTime: 18})
+		require.NoError(t, err)
+		require.Equal(t, []string{"entry19", "entry20"}, entriesAsStrings(res.Values()))
+	})
+
+	t.Run("loads the entries not reachable from a frontier", func(t *testing.T) {
+		logA, err := ipfslog.NewLog(ipfs, identities[0], &ipfslog.LogOptions{ID: "X"})
+		require.NoError(t, err)
+
+		logB, err := ipfslog.NewLog(ipfs, identities[1], &ipfslog.LogOptions{ID: "X"})
+		require.NoError(t, err)
+
+		var entriesA []iface.IPFSLogEntry
+		for i := 1; i <= 10; i++ {
+			e, err := logA.Append(ctx, []byte(fmt.Sprintf("A%d", i)), nil)
+			require.NoError(t, err)
+
+			entriesA = append(entriesA, e)
+
+			// B forks from the 6th entry of A
+			if i == 6 {
+				_, err = logB.Join(logA, -1)
+				require.NoError(t, err)
+			}
+		}
+
+		for i := 1; i <= 3; i++ {
+			_, err := logB.Append(ctx, []byte(fmt.Sprintf("B%d", i)), nil)
+			require.NoError(t, err)
+		}
+
+		// the client only knows the 10 first entries of A
+		frontier := []cid.Cid{entriesA[9].GetHash()}
+
+		_, err = logA.Join(logB, -1)
+		require.NoError(t, err)
+
+		merge, err := logA.Append(ctx, []byte("A11"), nil)
+		require.NoError(t, err)
+
+		storage := newFlakyStorage(ipfs, nil)
+
+		res, err := ipfslog.NewFromEntryHash(ctx, storage, identities[0], merge.GetHash(), &ipfslog.LogOptions{ID: "X"}, &ipfslog.FetchOptions{Frontier: frontier})
+		require.NoError(t, err)
+		require.Equal(t, []string{"B1", "B2", "B3", "A11"}, entriesAsStrings(res.Values()))
+
+		// the known part of the log is only walked down to the fork
+		for _, e := range entriesA[:4] {
+			require.Zero(t, storage.reads[e.GetHash()])
+		}
+
+		// the result can be joined into the log of the client
+		client, err := ipfslog.NewLog(ipfs, identities[0], &ipfslog.LogOptions{
+			ID:      "X",
+			Entries: entry.NewOrderedMapFromEntries(entriesA),
+			Heads:   entriesA[9:],
+		})
+		require.NoError(t, err)
+
+		_, err = client.Join(res, -1)
+		require.NoError(t, err)
+		require.Equal(t, entriesAsStrings(logA.Values()), entriesAsStrings(client.Values()))
+	})
+
+	t.Run("loads nothing when the frontier is up to date", func(t *testing.T) {
+		log1, err := ipfslog.NewLog(ipfs, identities[0], &ipfslog.LogOptions{ID: "X"})
+		require.NoError(t, err)
+
+		for i := 1; i <= 5; i++ {
+			_, err := log1.Append(ctx, []byte(fmt.Sprintf("entry%d", i)), nil)
+			require.NoError(t, err)
+		}
+
+		hash, err := log1.ToMultihash(ctx)
+		require.NoError(t, err)
+
+		res, err := ipfslog.NewFromMultihash(ctx, ipfs, identities[0], hash, &ipfslog.LogOptions{}, &ipfslog.FetchOptions{Frontier: []cid.Cid{log1.Heads().At(0).GetHash()}})
+		require.NoError(t, err)
+		require.Equal(t, 0, res.Len())
+	})
+}
@@ -0,0 +1,131 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+
+	ipfslog "berty.tech/go-ipfs-log"
+	"berty.tech/go-ipfs-log/errmsg"
+	idp "berty.tech/go-ipfs-log/identityprovider"
+	ks "berty.tech/go-ipfs-log/keystore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	"github.com/libp2p/go-msgio"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogSnapshot(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	m := mocknet.New()
+	defer m.Close()
+	ipfs, closeNode := NewMemoryServices(ctx, t, m)
+	defer closeNode()
+
+	datastore := dssync.MutexWrap(NewIdentityDataStore(t))
+	keystore, err := ks.NewKeystore(datastore)
+	require.NoError(t, err)
+
+	identities := make([]*idp.Identity, 4)
+	for i, char := range []rune{'C', 'B', 'D', 'A'} {
+		identity, err := idp.CreateIdentity(ctx, &idp.CreateIdentityOptions{
+			Keystore: keystore,
+			ID:       fmt.Sprintf("user%c", char),
+			Type:     "orbitdb",
+		})
+		require.NoError(t, err)
+
+		identities[i] = identity
+	}
+
+	t.Run("exports the clock", func(t *testing.T) {
+		fixture, err := CreateLogWithSixteenEntries(ctx, ipfs, identities)
+		require.NoError(t, err)
+
+		snapshot := fixture.Log.ToSnapshot()
+		require.NotNil(t, snapshot.Clock)
+		require.Equal(t, fixture.Log.Clock.GetTime(), snapshot.Clock.GetTime())
+		require.Equal(t, fixture.Log.Clock.GetID(), snapshot.Clock.GetID())
+	})
+
+	t.Run("writes and reads a snapshot", func(t *testing.T) {
+		fixture, err := CreateLogWithSixteenEntries(ctx, ipfs, identities)
+		require.NoError(t, err)
+
+		buf := bytes.NewBuffer(nil)
+		require.NoError(t, ipfslog.WriteSnapshot(buf, fixture.Log.ToSnapshot()))
+
+		snapshot, err := ipfslog.ReadSnapshot(buf)
+		require.NoError(t, err)
+
+		l, err := ipfslog.NewFromSnapshot(ipfs, identities[0], snapshot, &ipfslog.LogOptions{}, &ipfslog.SnapshotOptions{Verify: true})
+		require.NoError(t, err)
+
+		require.Equal(t, fixture.Log.ID, l.ID)
+		require.Equal(t, fixture.ExpectedData, entriesAsStrings(l.Values()))
+		require.Equal(t, fixture.Log.ToJSONLog(), l.ToJSONLog())
+		require.Equal(t, fixture.Log.Clock.GetTime(), l.Clock.GetTime())
+		require.Equal(t, fixture.Log.ToString(nil), l.ToString(nil))
+
+		// the restored log can be appended to and joined
+		_, err = l.Append(ctx, []byte("after restore"), nil)
+		require.NoError(t, err)
+
+		_, err = fixture.Log.Join(l, -1)
+		require.NoError(t, err)
+		require.Equal(t, 17, fixture.Log.Len())
+	})
+
+	t.Run("fails to verify a tampered snapshot", func(t *testing.T) {
+		fixture, err := CreateLogWithSixteenEntries(ctx, ipfs, identities)
+		require.NoError(t, err)
+
+		snapshot := fixture.Log.ToSnapshot()
+
+		buf := bytes.NewBuffer(nil)
+		require.NoError(t, ipfslog.WriteSnapshot(buf, snapshot))
+
+		snapshot, err = ipfslog.ReadSnapshot(buf)
+		require.NoError(t, err)
+
+		snapshot.Values[3].SetPayload([]byte("tampered"))
+
+		_, err = ipfslog.NewFromSnapshot(ipfs, identities[0], snapshot, &ipfslog.LogOptions{}, &ipfslog.SnapshotOptions{Verify: true})
+		require.Contains(t, err.Error(), errmsg.ErrSigNotVerified.Error())
+
+		_, err = ipfslog.NewFromSnapshot(ipfs, identities[0], snapshot, &ipfslog.LogOptions{}, nil)
+		require.NoError(t, err)
+	})
+
+	t.Run("fails to verify a snapshot with forged hashes", func(t *testing.T) {
+		fixture, err := CreateLogWithSixteenEntries(ctx, ipfs, identities)
+		require.NoError(t, err)
+
+		snapshot := fixture.Log.ToSnapshot()
+		snapshot.Values[3] = snapshot.Values[3].Copy()
+		snapshot.Values[3].SetHash(snapshot.Values[4].GetHash())
+
+		_, err = ipfslog.NewFromSnapshot(ipfs, identities[0], snapshot, &ipfslog.LogOptions{}, &ipfslog.SnapshotOptions{Verify: true})
+		require.Contains(t, err.Error(), errmsg.ErrEntryHashMismatch.Error())
+	})
+
+	t.Run("rejects invalid snapshots", func(t *testing.T) {
+		_, err := ipfslog.ReadSnapshot(bytes.NewBufferString("not a snapshot"))
+		require.Contains(t, err.Error(), errmsg.ErrSnapshotReadFailed.Error())
+
+		_, err = ipfslog.ReadSnapshot(bytes.NewBuffer(nil))
+		require.Contains(t, err.Error(), errmsg.ErrSnapshotReadFailed.Error())
+
+		buf := bytes.NewBuffer(nil)
+		require.NoError(t, msgio.NewVarintWriter(buf).WriteMsg([]byte(`{"magic":"ipfs-log/snapshot","version":99}`)))
+
+		_, err = ipfslog.ReadSnapshot(buf)
+		require.Contains(t, err.Error(), errmsg.ErrSnapshotVersionNotSupported.Error())
+
+		_, err = ipfslog.NewFromSnapshot(ipfs, identities[0], nil, &ipfslog.LogOptions{}, nil)
+		require.Equal(t, err, errmsg.ErrSnapshotNotDefined)
+	})
+}
@@ -0,0 +1,161 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	ipfslog "berty.tech/go-ipfs-log"
+	"berty.tech/go-ipfs-log/errmsg"
+	idp "berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/iface"
+	ks "berty.tech/go-ipfs-log/keystore"
+	"github.com/ipfs/go-cid"
+	dssync "github.com/ipfs/go-datastore/sync"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func readTail(t *testing.T, tail <-chan iface.IPFSLogEntry, amount int) []string {
+	t.Helper()
+
+	var payloads []string
+	for len(payloads) < amount {
+		select {
+		case e, ok := <-tail:
+			require.True(t, ok)
+			payloads = append(payloads, string(e.GetPayload()))
+		case <-time.After(time.Second * 5):
+			t.Fatalf("timed out after %d entries", len(payloads))
+		}
+	}
+
+	return payloads
+}
+
+func TestLogTail(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	m := mocknet.New()
+	defer m.Close()
+	ipfs, closeNode := NewMemoryServices(ctx, t, m)
+	defer closeNode()
+
+	keystore, err := ks.NewKeystore(dssync.MutexWrap(NewIdentityDataStore(t)))
+	require.NoError(t, err)
+
+	var identities [2]*idp.Identity
+	for i, char := range []rune{'A', 'B'} {
+		identity, err := idp.CreateIdentity(ctx, &idp.CreateIdentityOptions{
+			Keystore: keystore,
+			ID:       fmt.Sprintf("user%c", char),
+			Type:     "orbitdb",
+		})
+		require.NoError(t, err)
+
+		identities[i] = identity
+	}
+
+	t.Run("follows appends after a given entry", func(t *testing.T) {
+		l, err := ipfslog.NewLog(ipfs, identities[0], &ipfslog.LogOptions{ID: "X"})
+		require.NoError(t, err)
+
+		var from cid.Cid
+		for i := 0; i < 5; i++ {
+			e, err := l.Append(ctx, []byte(fmt.Sprintf("entry%d", i)), nil)
+			require.NoError(t, err)
+
+			if i == 2 {
+				from = e.GetHash()
+			}
+		}
+
+		tail, err := l.Tail(ctx, from)
+		require.NoError(t, err)
+
+		require.Equal(t, []string{"entry3", "entry4"}, readTail(t, tail, 2))
+
+		_, err = l.Append(ctx, []byte("entry5"), nil)
+		require.NoError(t, err)
+
+		require.Equal(t, []string{"entry5"}, readTail(t, tail, 1))
+	})
+
+	t.Run("follows joins in sort order", func(t *testing.T) {
+		l1, err := ipfslog.NewLog(ipfs, identities[0], &ipfslog.LogOptions{ID: "X"})
+		require.NoError(t, err)
+
+		l2, err := ipfslog.NewLog(ipfs, identities[1], &ipfslog.LogOptions{ID: "X"})
+		require.NoError(t, err)
+
+		tail, err := l1.Tail(ctx, cid.Undef)
+		require.NoError(t, err)
+
+		for i := 0; i < 3; i++ {
+			_, err := l2.Append(ctx, []byte(fmt.Sprintf("entry%d", i)), nil)
+			require.NoError(t, err)
+		}
+
+		_, err = l1.Join(l2, -1)
+		require.NoError(t, err)
+
+		require.Equal(t, []string{"entry0", "entry1", "entry2"}, readTail(t, tail, 3))
+	})
+
+	t.Run("yields every entry once when lagging behind", func(t *testing.T) {
+		l, err := ipfslog.NewLog(ipfs, identities[0], &ipfslog.LogOptions{ID: "X"})
+		require.NoError(t, err)
+
+		tail, err := l.Tail(ctx, cid.Undef)
+		require.NoError(t, err)
+
+		// more appends than the events buffered for the tail
+		var expected []string
+		for i := 0; i < 100; i++ {
+			expected = append(expected, fmt.Sprintf("entry%d", i))
+			_, err := l.Append(ctx, []byte(expected[i]), nil)
+			require.NoError(t, err)
+		}
+
+		require.Equal(t, expected, readTail(t, tail, 100))
+
+		_, err = l.Append(ctx, []byte("entry100"), nil)
+		require.NoError(t, err)
+
+		require.Equal(t, []string{"entry100"}, readTail(t, tail, 1))
+	})
+
+	t.Run("ends when the context is done", func(t *testing.T) {
+		l, err := ipfslog.NewLog(ipfs, identities[0], &ipfslog.LogOptions{ID: "X"})
+		require.NoError(t, err)
+
+		tctx, tcancel := context.WithCancel(ctx)
+		tail, err := l.Tail(tctx, cid.Undef)
+		require.NoError(t, err)
+
+		tcancel()
+
+		select {
+		case _, ok := <-tail:
+			require.False(t, ok)
+		case <-time.After(time.Second * 5):
+			t.Fatal("tail not closed")
+		}
+	})
+
+	t.Run("fails when the entry is not in the log", func(t *testing.T) {
+		l, err := ipfslog.NewLog(ipfs, identities[0], &ipfslog.LogOptions{ID: "X"})
+		require.NoError(t, err)
+
+		other, err := ipfslog.NewLog(ipfs, identities[0], &ipfslog.LogOptions{ID: "Y"})
+		require.NoError(t, err)
+
+		e, err := other.Append(ctx, []byte("entry"), nil)
+		require.NoError(t, err)
+
+		_, err = l.Tail(ctx, e.GetHash())
+		require.Equal(t, errmsg.ErrTailEntryNotFound, err)
+	})
+}
@@ -0,0 +1,72 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	ipfslog "berty.tech/go-ipfs-log"
+	idp "berty.tech/go-ipfs-log/identityprovider"
+	"berty.tech/go-ipfs-log/iface"
+	ks "berty.tech/go-ipfs-log/keystore"
+	"berty.tech/go-ipfs-log/storage"
+	mdutils "github.com/ipfs/boxo/ipld/merkledag/test"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStorage(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	keystore, err := ks.NewKeystore(dssync.MutexWrap(NewIdentityDataStore(t)))
+	require.NoError(t, err)
+
+	identity, err := idp.CreateIdentity(ctx, &idp.CreateIdentityOptions{
+		Keystore: keystore,
+		ID:       "userA",
+		Type:     "orbitdb",
+	})
+	require.NoError(t, err)
+
+	storages := map[string]func() iface.Storage{
+		"datastore": func() iface.Storage {
+			return storage.NewDatastore(dssync.MutexWrap(datastore.NewMapDatastore()))
+		},
+		"dag service": func() iface.Storage {
+			return storage.NewDAGService(mdutils.Mock())
+		},
+	}
+
+	for name, newStorage := range storages {
+		t.Run(fmt.Sprintf("writes and loads a log using a %s", name), func(t *testing.T) {
+			s := newStorage()
+
+			l, err := ipfslog.NewLog(s, identity, &ipfslog.LogOptions{ID: "A"})
+			require.NoError(t, err)
+
+			for i := 0; i < 10; i++ {
+				_, err := l.Append(ctx, []byte(fmt.Sprintf("entry%d", i)), &ipfslog.AppendOptions{Pin: true})
+				require.NoError(t, err)
+			}
+
+			h, err := l.ToMultihash(ctx)
+			require.NoError(t, err)
+
+			loaded, err := ipfslog.NewFromMultihash(ctx, s, identity, h, &ipfslog.LogOptions{}, &ipfslog.FetchOptions{})
+			require.NoError(t, err)
+
+			require.Equal(t, 10, loaded.Len())
+			require.Equal(t, l.ToString(nil), loaded.ToString(nil))
+
+			nodes := s.GetMany(ctx, loaded.ToJSONLog().Heads)
+			count := 0
+			for n := range nodes {
+				require.NoError(t, n.Err)
+				count++
+			}
+			require.Equal(t, 1, count)
+		})
+	}
+}
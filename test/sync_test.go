@@ -0,0 +1,182 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	ipfslog "berty.tech/go-ipfs-log"
+	"berty.tech/go-ipfs-log/accesscontroller"
+	"berty.tech/go-ipfs-log/errmsg"
+	idp "berty.tech/go-ipfs-log/identityprovider"
+	ks "berty.tech/go-ipfs-log/keystore"
+	logsync "berty.tech/go-ipfs-log/sync"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/libp2p/go-libp2p/core/peer"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSync(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	m := mocknet.New()
+	defer m.Close()
+
+	ipfsA, closeNodeA := NewMemoryServices(ctx, t, m)
+	defer closeNodeA()
+
+	ipfsB, closeNodeB := NewMemoryServices(ctx, t, m)
+	defer closeNodeB()
+
+	hostA, err := m.GenPeer()
+	require.NoError(t, err)
+
+	hostB, err := m.GenPeer()
+	require.NoError(t, err)
+
+	require.NoError(t, m.LinkAll())
+	require.NoError(t, m.ConnectAllButSelf())
+
+	datastore := dssync.MutexWrap(NewIdentityDataStore(t))
+	keystore, err := ks.NewKeystore(datastore)
+	require.NoError(t, err)
+
+	var identities [2]*idp.Identity
+	for i, char := range []rune{'A', 'B'} {
+		identity, err := idp.CreateIdentity(ctx, &idp.CreateIdentityOptions{
+			Keystore: keystore,
+			ID:       fmt.Sprintf("user%c", char),
+			Type:     "orbitdb",
+		})
+		require.NoError(t, err)
+
+		identities[i] = identity
+	}
+
+	serviceA := logsync.NewService(hostA, &logsync.Options{Timeout: time.Second * 10})
+	defer serviceA.Close()
+
+	type syncError struct {
+		peer  peer.ID
+		logID string
+		err   error
+	}
+
+	errorsB := make(chan syncError, 10)
+	serviceB := logsync.NewService(hostB, &logsync.Options{
+		Timeout: time.Second * 10,
+		OnError: func(p peer.ID, logID string, err error) {
+			errorsB <- syncError{peer: p, logID: logID, err: err}
+		},
+	})
+	defer serviceB.Close()
+
+	t.Run("exchanges missing entries in both directions", func(t *testing.T) {
+		logA, err := ipfslog.NewLog(ipfsA, identities[0], &ipfslog.LogOptions{ID: "sync-both"})
+		require.NoError(t, err)
+
+		logB, err := ipfslog.NewLog(ipfsB, identities[1], &ipfslog.LogOptions{ID: "sync-both"})
+		require.NoError(t, err)
+
+		for i := 0; i < 10; i++ {
+			_, err := logA.Append(ctx, []byte(fmt.Sprintf("entryA%d", i)), nil)
+			require.NoError(t, err)
+		}
+
+		for i := 0; i < 5; i++ {
+			_, err := logB.Append(ctx, []byte(fmt.Sprintf("entryB%d", i)), nil)
+			require.NoError(t, err)
+		}
+
+		serviceA.Register(logA)
+		serviceB.Register(logB)
+
+		require.NoError(t, serviceA.Sync(ctx, hostB.ID(), "sync-both"))
+		require.Equal(t, 15, logA.Len())
+
+		require.Eventually(t, func() bool {
+			return logB.Len() == 15
+		}, time.Second*10, time.Millisecond*50)
+
+		require.Equal(t, logA.ToString(nil), logB.ToString(nil))
+		require.Equal(t, logA.ToJSONLog().Heads, logB.ToJSONLog().Heads)
+	})
+
+	t.Run("only fetches what is missing", func(t *testing.T) {
+		logA, err := ipfslog.NewLog(ipfsA, identities[0], &ipfslog.LogOptions{ID: "sync-incremental"})
+		require.NoError(t, err)
+
+		logB, err := ipfslog.NewLog(ipfsB, identities[1], &ipfslog.LogOptions{ID: "sync-incremental"})
+		require.NoError(t, err)
+
+		serviceA.Register(logA)
+		serviceB.Register(logB)
+
+		for i := 0; i < 5; i++ {
+			_, err := logA.Append(ctx, []byte(fmt.Sprintf("entryA%d", i)), nil)
+			require.NoError(t, err)
+		}
+
+		require.NoError(t, serviceB.Sync(ctx, hostA.ID(), "sync-incremental"))
+		require.Equal(t, 5, logB.Len())
+
+		for i := 5; i < 8; i++ {
+			_, err := logA.Append(ctx, []byte(fmt.Sprintf("entryA%d", i)), nil)
+			require.NoError(t, err)
+		}
+
+		require.NoError(t, serviceB.Sync(ctx, hostA.ID(), "sync-incremental"))
+		require.Equal(t, 8, logB.Len())
+		require.Equal(t, logA.ToString(nil), logB.ToString(nil))
+
+		// nothing to do when both sides are up to date
+		require.NoError(t, serviceB.Sync(ctx, hostA.ID(), "sync-incremental"))
+		require.Equal(t, 8, logB.Len())
+	})
+
+	t.Run("returns an error for unknown logs", func(t *testing.T) {
+		logA, err := ipfslog.NewLog(ipfsA, identities[0], &ipfslog.LogOptions{ID: "sync-unknown"})
+		require.NoError(t, err)
+
+		err = serviceA.Sync(ctx, hostB.ID(), "sync-unknown")
+		require.ErrorIs(t, err, errmsg.ErrSyncLogNotRegistered)
+
+		serviceA.Register(logA)
+
+		err = serviceA.Sync(ctx, hostB.ID(), "sync-unknown")
+		require.ErrorIs(t, err, errmsg.ErrSyncLogNotRegistered)
+	})
+	t.Run("reports the errors of the remote exchanges", func(t *testing.T) {
+		logA, err := ipfslog.NewLog(ipfsA, identities[0], &ipfslog.LogOptions{ID: "sync-denied"})
+		require.NoError(t, err)
+
+		// only identities[1] can write to logB
+		logB, err := ipfslog.NewLog(ipfsB, identities[1], &ipfslog.LogOptions{
+			ID:               "sync-denied",
+			AccessController: accesscontroller.NewInLog(identities[1].ID),
+		})
+		require.NoError(t, err)
+
+		_, err = logA.Append(ctx, []byte("entryA"), nil)
+		require.NoError(t, err)
+
+		serviceA.Register(logA)
+		serviceB.Register(logB)
+
+		require.NoError(t, serviceA.Sync(ctx, hostB.ID(), "sync-denied"))
+
+		select {
+		case reported := <-errorsB:
+			require.Equal(t, hostA.ID(), reported.peer)
+			require.Equal(t, "sync-denied", reported.logID)
+			require.ErrorContains(t, reported.err, errmsg.ErrSyncExchangeFailed.Error())
+		case <-time.After(time.Second * 10):
+			t.Fatal("error not reported")
+		}
+
+		require.Equal(t, 0, logB.Len())
+	})
+}
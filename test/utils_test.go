@@ -6,12 +6,12 @@ import (
 	"testing"
 
 	"berty.tech/go-ipfs-log/iface"
+	coreapistorage "berty.tech/go-ipfs-log/storage/coreapi"
 	"github.com/ipfs/go-datastore"
 	dssync "github.com/ipfs/go-datastore/sync"
 	config "github.com/ipfs/kubo/config"
 	ipfsCore "github.com/ipfs/kubo/core"
 	"github.com/ipfs/kubo/core/coreapi"
-	coreiface "github.com/ipfs/kubo/core/coreiface"
 	mock "github.com/ipfs/kubo/core/mock"
 	ipfs_repo "github.com/ipfs/kubo/repo"
 	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
@@ -41,7 +41,7 @@ func newRepo() (ipfs_repo.Repo, error) {
 	}, nil
 }
 
-func NewMemoryServices(ctx context.Context, t testing.TB, m mocknet.Mocknet) (coreiface.CoreAPI, func()) {
+func NewMemoryServices(ctx context.Context, t testing.TB, m mocknet.Mocknet) (iface.Storage, func()) {
 	t.Helper()
 
 	r, err := newRepo()
@@ -63,7 +63,7 @@ func NewMemoryServices(ctx context.Context, t testing.TB, m mocknet.Mocknet) (co
 	close := func() {
 		core.Close()
 	}
-	return api, close
+	return coreapistorage.New(api), close
 }
 
 func lastEntry(entries []iface.IPFSLogEntry) iface.IPFSLogEntry {
@@ -84,6 +84,15 @@ func entriesAsStrings(values iface.IPFSLogOrderedEntries) []string {
 	return foundEntries
 }
 
+func payloads(entries []iface.IPFSLogEntry) []string {
+	var ret []string
+	for _, e := range entries {
+		ret = append(ret, string(e.GetPayload()))
+	}
+
+	return ret
+}
+
 func getLastEntry(omap iface.IPFSLogOrderedEntries) iface.IPFSLogEntry {
 	lastKey := omap.Keys()[len(omap.Keys())-1]
 